@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/tui"
+)
+
+// appHooks are the steps of the interactive app carried out here, as they
+// need the vault or build connections like the commands do
+func appHooks() tui.AppHooks {
+	return tui.AppHooks{
+		UnlockVault:    unlockAppVault,
+		OpenSaved:      openSavedConnection,
+		OpenNew:        openNewConnection,
+		SaveConnection: saveConnection,
+		ConnectAdmin:   connectAdmin,
+		SaveAdmin:      saveAdminConnection,
+	}
+}
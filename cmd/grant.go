@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var (
+	grantSchemas []string
+	grantTables  []string
+)
+
+var grantCmd = &cobra.Command{
+	Use:   "grant <user> <database>",
+	Short: "Grant an existing user permissions on a database",
+	Long: `Grants an existing user all privileges on a database. On PostgreSQL they
+cover the objects of the schemas given with --schema, or of public when none
+are given, including the objects created in them later.
+
+With --table, only the given tables are granted; name a table outside the
+search path as schema.table.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		username, dbName := args[0], args[1]
+		if len(grantSchemas) > 0 && len(grantTables) > 0 {
+			fmt.Println("Error: give --schema or --table, not both")
+			os.Exit(1)
+		}
+
+		adminInfo := adminConnectionOrExit()
+		defer adminInfo.DB.Close()
+
+		if len(grantSchemas) > 0 && !hasSchemas(adminInfo.Params.DBType) {
+			fmt.Println("Error: --schema only applies to PostgreSQL, other engines have no schemas inside a database")
+			os.Exit(1)
+		}
+
+		if len(grantTables) > 0 {
+			tables := make([]db.TableName, len(grantTables))
+			for i, name := range grantTables {
+				tables[i] = parseTableName(name)
+			}
+			if err := db.GrantTablePermissions(adminInfo.DB, adminInfo.Params, dbName, username, tables); err != nil {
+				fmt.Printf("Error: failed to grant permissions: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Success: granted '%s' all privileges on %s in database '%s'.\n", username, strings.Join(grantTables, ", "), dbName)
+			return
+		}
+
+		if err := db.GrantPermissionsToUser(adminInfo.DB, adminInfo.Params, dbName, username, grantSchemas); err != nil {
+			fmt.Printf("Error: failed to grant permissions: %v\n", err)
+			os.Exit(1)
+		}
+		if len(grantSchemas) > 0 {
+			fmt.Printf("Success: granted '%s' all privileges on database '%s' and schemas %s.\n", username, dbName, strings.Join(grantSchemas, ", "))
+		} else {
+			fmt.Printf("Success: granted '%s' all privileges on database '%s'.\n", username, dbName)
+		}
+	},
+}
+
+func init() {
+	grantCmd.Flags().StringSliceVarP(&grantSchemas, "schema", "s", nil, "schema to grant privileges in, repeatable or comma-separated (PostgreSQL)")
+	grantCmd.Flags().StringSliceVarP(&grantTables, "table", "t", nil, "table to grant privileges on, as table or schema.table, repeatable or comma-separated")
+}
+
+// parseTableName splits schema.table, leaving a name without a dot
+// unqualified
+func parseTableName(name string) db.TableName {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return db.TableName{Schema: schema, Name: table}
+	}
+	return db.TableName{Name: name}
+}
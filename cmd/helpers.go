@@ -1,112 +1,207 @@
 package cmd
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
-	"syscall"
 
 	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
 	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
 	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/tui"
-	"golang.org/x/term"
 )
 
-// AdminConnectionInfo holds the database connection and admin credentials
-type AdminConnectionInfo struct {
-	DB       *sql.DB
-	User     string
-	Password string
-	Host     string
-	Port     string
+// connParams combines saved connection details with a password. For
+// PostgreSQL, missing values are resolved like libpq does from the service
+// file, the PG* environment variables and the password file.
+func connParams(details config.ConnectionDetails, password string) (db.ConnParams, error) {
+	details, password, err := config.ResolveLibpq(details, password)
+	if err != nil {
+		return db.ConnParams{}, err
+	}
+
+	var ssh *db.SSHParams
+	if details.SSH != nil {
+		ssh = &db.SSHParams{
+			Host:       details.SSH.Host,
+			Port:       details.SSH.Port,
+			User:       details.SSH.User,
+			KeyFile:    details.SSH.KeyFile,
+			KnownHosts: details.SSH.KnownHosts,
+		}
+	}
+
+	return db.ConnParams{
+		DBType:      details.Engine(),
+		Host:        details.Host,
+		Port:        details.Port,
+		SocketDir:   details.SocketDir,
+		User:        details.User,
+		Password:    password,
+		DBName:      details.DBName,
+		SSLMode:     details.SSLMode,
+		SSLRootCert: details.SSLRootCert,
+		SSLCert:     details.SSLCert,
+		SSLKey:      details.SSLKey,
+		Params:      details.Params,
+		SSH:         ssh,
+		ReadOnly:    details.ReadOnly,
+	}, nil
 }
 
-// getAdminConnection loads saved admin credentials or prompts the user to enter them.
-// It returns a connected database handle or exits on error.
-func getAdminConnection() (*sql.DB, error) {
-	info, err := getAdminConnectionInfo()
+// errCancelled is returned when the user closes a form instead of filling it in
+var errCancelled = errors.New("operation aborted by user")
+
+// adminConnectionOrExit is getAdminConnectionInfo for commands, which exit
+// when it fails or the user cancels
+func adminConnectionOrExit() *tui.AdminConnection {
+	adminInfo, err := getAdminConnectionInfo()
+	if errors.Is(err, errCancelled) {
+		fmt.Println("Cancelled: operation aborted by user.")
+		os.Exit(0)
+	}
 	if err != nil {
-		return nil, err
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-	return info.DB, nil
+	return adminInfo
 }
 
-// getAdminConnectionInfo loads saved admin credentials or prompts the user to enter them.
-// It returns both the connected database handle and admin credentials.
-func getAdminConnectionInfo() (*AdminConnectionInfo, error) {
-	details, err := config.LoadAdminConnection()
-	if err != nil {
-		// No saved credentials, prompt user for all details
+// getAdminConnectionInfo connects with the saved admin credentials, asking
+// on the terminal for a password no source has, or asks for the
+// credentials in the admin form and saves them when none are saved.
+func getAdminConnectionInfo() (*tui.AdminConnection, error) {
+	unlockVault()
+	adminInfo, err := connectAdmin(nil)
+	var needed *tui.PasswordNeededError
+	switch {
+	case errors.Is(err, tui.ErrNoAdminConnection):
 		fmt.Println("No saved superuser credentials found.")
-		fmt.Println("Please enter Postgres superuser credentials:")
+		fmt.Println("Please enter database superuser credentials:")
 
 		result, err := tui.RunAdminForm()
 		if err != nil {
 			return nil, fmt.Errorf("could not open credentials form: %w", err)
 		}
-
 		if result.Quitting {
-			fmt.Println("Cancelled: operation aborted by user.")
-			os.Exit(0)
+			return nil, errCancelled
 		}
 
-		// Try to connect with provided credentials (always use postgres database for superuser)
-		adminDB, err := db.ConnectAndVerify("psql", result.User, result.Password, "localhost", result.Port, "postgres")
+		adminInfo, status, err := saveAdminConnection(result)
 		if err != nil {
-			return nil, fmt.Errorf("connection failed: %w", err)
+			return nil, err
 		}
+		fmt.Println(status)
+		return adminInfo, nil
 
-		// Save credentials (except password) for future use
-		detailsToSave := config.ConnectionDetails{
-			Host:   "localhost",
-			Port:   result.Port,
-			User:   result.User,
-			DBName: "postgres",
+	case errors.As(err, &needed):
+		password, err := readSecret(fmt.Sprintf("Enter the password for superuser '%s': ", needed.User))
+		if err != nil {
+			return nil, err
 		}
+		return connectAdmin(&password)
+	}
+	return adminInfo, err
+}
 
-		if err := config.SaveAdminConnection(detailsToSave, result.Password); err != nil {
-			fmt.Printf("Warning: could not save credentials: %v\n", err)
-		} else {
-			fmt.Println("Superuser credentials saved successfully.")
-		}
+// connectAdmin is the ConnectAdmin hook of the app. It connects with the
+// saved admin credentials and the password of the vault, PGPASSWORD or the
+// password file, or with password when it is not nil. It returns
+// tui.ErrNoAdminConnection when no credentials are saved and a
+// *tui.PasswordNeededError when no source has the password.
+func connectAdmin(password *string) (*tui.AdminConnection, error) {
+	details, err := config.LoadAdminConnection()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, tui.ErrNoAdminConnection
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		return &AdminConnectionInfo{
-			DB:       adminDB,
-			User:     result.User,
-			Password: result.Password,
-			Host:     "localhost",
-			Port:     result.Port,
-		}, nil
+	known, _ := config.LoadPassword(config.AdminVaultEntry)
+	if password != nil {
+		known = strings.TrimSpace(*password)
+	}
+	params, err := connParams(*details, known)
+	if err != nil {
+		return nil, err
 	}
 
-	// Credentials found, prompt for password only
-	fmt.Printf("Enter the password for superuser '%s': ", details.User)
+	// Over a Unix socket peer authentication needs no password. Elsewhere an
+	// empty answer is still tried, for servers using trust authentication.
+	if password == nil && params.Password == "" && !params.UsesSocket() {
+		return nil, &tui.PasswordNeededError{User: details.User}
+	}
 
-	// Read password securely (hidden input)
-	passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
+	adminDB, err := db.ConnectAndVerify(params)
 	if err != nil {
-		return nil, fmt.Errorf("could not read password: %w", err)
+		return nil, fmt.Errorf("connection failed: %w", err)
 	}
-	fmt.Println() // New line after hidden input
+	return &tui.AdminConnection{DB: adminDB, Params: params}, nil
+}
 
-	password := strings.TrimSpace(string(passwordBytes))
-	if password == "" {
-		fmt.Println("Cancelled: no password entered.")
-		os.Exit(0)
+// saveAdminConnection is the SaveAdmin hook of the app. It connects with
+// the credentials of the admin form and saves them, with the password when
+// the vault is enabled. The status reports whether they were saved.
+func saveAdminConnection(result tui.AdminResult) (*tui.AdminConnection, string, error) {
+	dialect, err := db.GetDialect(result.DBType)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Connect with saved credentials + entered password
-	adminDB, err := db.ConnectAndVerify("psql", details.User, password, details.Host, details.Port, details.DBName)
+	tunnel, err := config.ParseSSHTarget(result.SSHHost)
 	if err != nil {
-		return nil, fmt.Errorf("connection failed: %w", err)
+		return nil, "", err
+	}
+	if tunnel != nil {
+		tunnel.KeyFile = result.SSHKey
 	}
 
-	return &AdminConnectionInfo{
-		DB:       adminDB,
-		User:     details.User,
-		Password: password,
-		Host:     details.Host,
-		Port:     details.Port,
-	}, nil
+	// Always use the maintenance database for superuser operations
+	details := config.ConnectionDetails{
+		DBType:      result.DBType,
+		Host:        result.Host,
+		Port:        result.Port,
+		SocketDir:   result.SocketDir,
+		User:        result.User,
+		DBName:      dialect.DefaultDatabase(),
+		SSLMode:     result.SSLMode,
+		SSLRootCert: result.SSLRootCert,
+		SSLCert:     result.SSLCert,
+		SSLKey:      result.SSLKey,
+		SSH:         tunnel,
+	}
+
+	// Try to connect with provided credentials
+	params, err := connParams(details, result.Password)
+	if err != nil {
+		return nil, "", err
+	}
+	adminDB, err := db.ConnectAndVerify(params)
+	if err != nil {
+		return nil, "", fmt.Errorf("connection failed: %w", err)
+	}
+
+	status := "Superuser credentials saved successfully."
+	if err := config.SaveAdminConnection(details, result.Password); err != nil {
+		status = fmt.Sprintf("Warning: could not save credentials: %v", err)
+	}
+	return &tui.AdminConnection{DB: adminDB, Params: params}, status, nil
+}
+
+// hasSchemas reports whether an engine groups the tables of a database into
+// schemas
+func hasSchemas(dbType string) bool {
+	dialect, err := db.GetDialect(dbType)
+	return err == nil && dialect.ListSchemasQuery() != ""
+}
+
+// statementContext bounds a query by the statement timeout of the
+// connection, if it has one
+func statementContext(details config.ConnectionDetails) (context.Context, context.CancelFunc) {
+	if timeout := details.Timeout(); timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
 }
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List, search and prune the query history",
+	Long: `Every statement run in the SQL editor is recorded in history.jsonl next to
+config.json, with the connection, database, time, duration, row count and
+outcome. In the editor, Ctrl+Y searches it and recalls a query.`,
+}
+
+var (
+	historyLimit      int
+	historyConnection string
+	historyErrors     bool
+)
+
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show the most recent queries",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		printHistory(loadHistoryOrExit(), nil)
+	},
+}
+
+var historyGrepCmd = &cobra.Command{
+	Use:   "grep <pattern>",
+	Short: "Show the queries matching a regular expression, ignoring case",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pattern, err := regexp.Compile("(?i)" + args[0])
+		if err != nil {
+			fmt.Printf("Error: invalid pattern: %v\n", err)
+			os.Exit(1)
+		}
+		printHistory(loadHistoryOrExit(), pattern)
+	},
+}
+
+var (
+	pruneOlderThan string
+	pruneKeep      int
+)
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old entries from the history",
+	Long: `Removes entries older than --older-than (such as 30d or 12h), keeps only the
+newest --keep entries, or both.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if pruneOlderThan == "" && !cmd.Flags().Changed("keep") {
+			fmt.Println("Error: give --older-than, --keep or both.")
+			os.Exit(1)
+		}
+
+		var cutoff time.Time
+		if pruneOlderThan != "" {
+			age, err := parseAge(pruneOlderThan)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			cutoff = time.Now().Add(-age)
+		}
+
+		removed, err := historyOrExit().Prune(func(i, total int, entry config.HistoryEntry) bool {
+			if !cutoff.IsZero() && entry.Time.Before(cutoff) {
+				return false
+			}
+			return !cmd.Flags().Changed("keep") || i >= total-pruneKeep
+		})
+		if err != nil {
+			fmt.Printf("Error: could not prune history: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %d entries.\n", removed)
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{historyListCmd, historyGrepCmd} {
+		c.Flags().IntVarP(&historyLimit, "limit", "n", 20, "number of entries to show, 0 for all")
+		c.Flags().StringVarP(&historyConnection, "connection", "c", "", "only show queries run on this saved connection")
+		c.Flags().BoolVar(&historyErrors, "errors", false, "only show queries that failed")
+	}
+	historyPruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "remove entries older than this, such as 30d or 12h")
+	historyPruneCmd.Flags().IntVar(&pruneKeep, "keep", 0, "keep only this many of the newest entries")
+
+	historyCmd.AddCommand(historyListCmd, historyGrepCmd, historyPruneCmd)
+}
+
+func historyOrExit() *config.History {
+	history, err := config.DefaultHistory()
+	if err != nil {
+		fmt.Printf("Error: could not locate history: %v\n", err)
+		os.Exit(1)
+	}
+	return history
+}
+
+func loadHistoryOrExit() []config.HistoryEntry {
+	entries, err := historyOrExit().Load()
+	if err != nil {
+		fmt.Printf("Error: could not read history: %v\n", err)
+		os.Exit(1)
+	}
+	return entries
+}
+
+// printHistory prints the newest matching entries, oldest first so the
+// most recent query ends up next to the prompt
+func printHistory(entries []config.HistoryEntry, pattern *regexp.Regexp) {
+	var matches []config.HistoryEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if historyConnection != "" && entry.Connection != historyConnection {
+			continue
+		}
+		if historyErrors && entry.Success {
+			continue
+		}
+		if pattern != nil && !pattern.MatchString(entry.Query) {
+			continue
+		}
+		matches = append(matches, entry)
+		if historyLimit > 0 && len(matches) == historyLimit {
+			break
+		}
+	}
+
+	if len(matches) == 0 {
+		fmt.Println("No queries found.")
+		return
+	}
+	for i := len(matches) - 1; i >= 0; i-- {
+		fmt.Println(formatHistoryEntry(matches[i]))
+	}
+}
+
+// formatHistoryEntry renders an entry on one line
+func formatHistoryEntry(entry config.HistoryEntry) string {
+	where := entry.Database
+	if entry.Connection != "" {
+		where = entry.Connection + "/" + entry.Database
+	}
+	outcome := fmt.Sprintf("%d rows", entry.Rows)
+	if !entry.Success {
+		outcome = "error: " + firstLine(entry.Error)
+	}
+	return fmt.Sprintf("%s  %s  %.1fs  %s  %s",
+		entry.Time.Local().Format("2006-01-02 15:04:05"), where, entry.Duration.Seconds(), outcome,
+		strings.Join(strings.Fields(entry.Query), " "))
+}
+
+func firstLine(s string) string {
+	s = strings.TrimPrefix(s, "Error executing query:\n")
+	s = strings.TrimPrefix(s, "Error executing statement:\n")
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// parseAge parses a duration such as 12h, also accepting a number of days
+// such as 30d
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q, use a duration such as 30d or 12h", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q, use a duration such as 30d or 12h", s)
+	}
+	return age, nil
+}
@@ -13,14 +13,10 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all databases on the connected server",
 	Run: func(cmd *cobra.Command, args []string) {
-		adminDB, err := getAdminConnection()
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
-		}
-		defer adminDB.Close()
+		adminInfo := adminConnectionOrExit()
+		defer adminInfo.DB.Close()
 
-		dbNames, err := db.ListDatabases(adminDB)
+		dbNames, err := db.ListDatabases(adminInfo.DB, adminInfo.Params.DBType)
 		if err != nil {
 			fmt.Printf("Could not fetch database list: %v\n", err)
 			os.Exit(1)
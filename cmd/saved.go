@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/tui"
+)
+
+// openSavedConnection is the OpenSaved hook of the app. It connects to a
+// saved connection and marks it used.
+func openSavedConnection(name string, password *string) (*tui.Connection, string, error) {
+	conn, details, err := connectSaved(name, password)
+	if err != nil {
+		return nil, "", err
+	}
+	status := ""
+	if err := config.TouchDatabaseConnection(name); err != nil {
+		status = fmt.Sprintf("Warning: could not update connection: %v", err)
+	}
+	return &tui.Connection{DB: conn, Name: name, Details: details}, status, nil
+}
+
+// openNewConnection is the OpenNew hook of the app. It connects with the
+// connect form result and saves it under a new name.
+func openNewConnection(result tui.ConnectResult) (*tui.Connection, string, error) {
+	params, err := connParams(result.Details, result.Password)
+	if err != nil {
+		return nil, "", err
+	}
+	conn, err := db.ConnectAndVerify(params)
+	if err != nil {
+		return nil, "", fmt.Errorf("connection failed: %w", err)
+	}
+
+	status := ""
+	name, err := saveNewConnection(result)
+	if err != nil {
+		status = fmt.Sprintf("Warning: connection not saved: %v", err)
+	} else if err := config.TouchDatabaseConnection(name); err != nil {
+		status = fmt.Sprintf("Warning: could not update connection: %v", err)
+	}
+	return &tui.Connection{DB: conn, Name: name, Details: result.Details}, status, nil
+}
+
+// openSaved connects to a saved connection like connectSaved, asking for
+// the vault passphrase and the password on the terminal when needed, and
+// exits when that fails
+func openSaved(name string) (*sql.DB, config.ConnectionDetails) {
+	unlockVault()
+	conn, details, err := connectSaved(name, nil)
+	var needed *tui.PasswordNeededError
+	if errors.As(err, &needed) {
+		password, readErr := readSecret(fmt.Sprintf("Enter the password for '%s': ", name))
+		if readErr != nil {
+			fmt.Printf("Error: %v\n", readErr)
+			os.Exit(1)
+		}
+		conn, details, err = connectSaved(name, &password)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return conn, details
+}
+
+// connectSaved connects to a saved connection with the password of the
+// vault or the libpq sources, or with password when it is not nil. It
+// returns a *tui.PasswordNeededError when the connection needs a password
+// and none of them has it.
+func connectSaved(name string, password *string) (*sql.DB, config.ConnectionDetails, error) {
+	details, err := config.LoadDatabaseConnection(name)
+	if err != nil {
+		return nil, config.ConnectionDetails{}, fmt.Errorf("could not load connection '%s': %w", name, err)
+	}
+
+	known, _ := config.LoadPassword(name)
+	if password != nil {
+		known = *password
+	}
+	params, err := connParams(*details, known)
+	if err != nil {
+		return nil, config.ConnectionDetails{}, err
+	}
+
+	dialect, err := db.GetDialect(params.DBType)
+	if err != nil {
+		return nil, config.ConnectionDetails{}, err
+	}
+	if password == nil && params.Password == "" && !dialect.FileBased() && !params.UsesSocket() {
+		return nil, config.ConnectionDetails{}, &tui.PasswordNeededError{User: params.User}
+	}
+
+	conn, err := db.ConnectAndVerify(params)
+	if err != nil {
+		return nil, config.ConnectionDetails{}, fmt.Errorf("connection failed: %w", err)
+	}
+	return conn, *details, nil
+}
+
+// saveConnection is the SaveConnection hook of the app. It saves the
+// connect form result over the saved connection name, or as a copy of it
+// with duplicate.
+func saveConnection(name string, result tui.ConnectResult, duplicate bool) (string, error) {
+	if duplicate {
+		newName, err := saveNewConnection(result)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Saved copy '%s'.", newName), nil
+	}
+
+	details, err := config.LoadDatabaseConnection(name)
+	if err != nil {
+		return "", fmt.Errorf("could not load connection '%s': %w", name, err)
+	}
+	newName := connectionName(result)
+	if newName != name {
+		if err := config.RenameDatabaseConnection(name, newName); err != nil {
+			return "", err
+		}
+	}
+	result.Details.LastUsed = details.LastUsed
+	if err := config.SaveDatabaseConnection(newName, result.Details, result.Password); err != nil {
+		return "", fmt.Errorf("could not save connection: %w", err)
+	}
+	return fmt.Sprintf("Saved '%s'.", newName), nil
+}
+
+// connectionName returns the name chosen in the connect form, or one built
+// from the server or the file for file-based engines
+func connectionName(result tui.ConnectResult) string {
+	if result.Name != "" {
+		return result.Name
+	}
+	details := result.Details
+	if dialect, err := db.GetDialect(details.Engine()); err == nil && dialect.FileBased() {
+		return details.DBName
+	}
+	host := details.Host
+	if details.SocketDir != "" {
+		host = details.SocketDir
+	}
+	return fmt.Sprintf("%s@%s:%s/%s", details.User, host, details.Port, details.DBName)
+}
+
+// saveNewConnection saves the connect form result under a name that is not
+// taken yet, so new entries never replace existing ones
+func saveNewConnection(result tui.ConnectResult) (string, error) {
+	name := connectionName(result)
+	if _, err := config.LoadDatabaseConnection(name); err == nil {
+		return "", fmt.Errorf("a connection named '%s' already exists", name)
+	}
+
+	if err := config.SaveDatabaseConnection(name, result.Details, result.Password); err != nil {
+		return "", err
+	}
+	return name, nil
+}
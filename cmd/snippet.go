@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/tui"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var snippetCmd = &cobra.Command{
+	Use:   "snippet",
+	Short: "Manage and run saved query snippets",
+	Long: `Snippets are named queries kept in config.json, either global or scoped to
+a saved connection. A query may hold placeholders such as :user_id or $1;
+their values are asked for when the snippet runs and are sent to the
+database as bound parameters, never written into the SQL.
+
+In the SQL editor, Ctrl+G picks a snippet to run.`,
+}
+
+var (
+	snippetConnection  string
+	snippetDescription string
+	snippetFile        string
+	snippetForce       bool
+	snippetParams      []string
+	snippetYes         bool
+	snippetContinue    bool
+)
+
+var snippetAddCmd = &cobra.Command{
+	Use:   "add <name> [query]",
+	Short: "Save a snippet",
+	Long: `Saves a snippet. The query is taken from the argument, from --file, or
+from standard input when neither is given.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		query, err := snippetQuery(args)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		snippet := config.Snippet{
+			Name:        args[0],
+			Connection:  snippetConnection,
+			Query:       query,
+			Description: snippetDescription,
+		}
+		if err := config.SaveSnippet(snippet, snippetForce); err != nil {
+			fmt.Printf("Error: could not save snippet: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved %s snippet '%s'.\n", snippet.Scope(), snippet.Name)
+	},
+}
+
+var snippetListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the saved snippets",
+	Long: `Lists every snippet, or with --connection the ones that can be used on that
+connection.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var snippets []config.Snippet
+		var err error
+		if snippetConnection != "" {
+			snippets, err = config.SnippetsFor(snippetConnection)
+		} else {
+			snippets, err = config.ListSnippets()
+		}
+		if err != nil {
+			fmt.Printf("Error: could not load snippets: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(snippets) == 0 {
+			fmt.Println("No snippets found.")
+			return
+		}
+		for _, snippet := range snippets {
+			about := snippet.Description
+			if about == "" {
+				about = strings.Join(strings.Fields(snippet.Query), " ")
+			}
+			fmt.Printf("%s  [%s]  %s\n", snippet.Name, snippet.Scope(), about)
+		}
+	},
+}
+
+var snippetRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Delete a snippet",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := config.DeleteSnippet(args[0], snippetConnection); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted snippet '%s'.\n", args[0])
+	},
+}
+
+var snippetRunCmd = &cobra.Command{
+	Use:   "run <name> --connection <connection>",
+	Short: "Run a snippet on a saved connection",
+	Long: `Runs a snippet on a saved connection and prints the results. Give the
+values of its placeholders with --param, such as --param user_id=42 or
+--param 1=42; the others are asked for in a form.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		snippet, err := config.FindSnippet(args[0], snippetConnection)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Error: no snippet named '%s' for connection '%s'\n", args[0], snippetConnection)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Printf("Error: could not load snippets: %v\n", err)
+			os.Exit(1)
+		}
+
+		conn, details := openSaved(snippetConnection)
+		defer conn.Close()
+
+		session, err := db.NewSession(context.Background(), conn, details.Engine(), details.ReadOnly)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer session.Close()
+
+		values, err := snippetValues(snippet, session.Params(snippet.Query))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if values == nil {
+			fmt.Println("Cancelled: nothing was run.")
+			return
+		}
+		if err := checkDestructive(session, snippet); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx, cancel := statementContext(details)
+		defer cancel()
+		result := session.ExecuteWithParams(ctx, snippet.Query, values, snippetContinue)
+
+		if history, err := config.DefaultHistory(); err == nil {
+			if err := history.Append(tui.HistoryEntries(result, snippetConnection, details.DBName)...); err != nil {
+				fmt.Printf("Warning: could not save query history: %v\n", err)
+			}
+		}
+
+		fmt.Println(tui.FormatScriptResult(result))
+		if result.Failed() > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	snippetAddCmd.Flags().StringVarP(&snippetConnection, "connection", "c", "", "scope the snippet to this saved connection instead of all of them")
+	snippetAddCmd.Flags().StringVarP(&snippetDescription, "description", "d", "", "what the snippet is for")
+	snippetAddCmd.Flags().StringVarP(&snippetFile, "file", "f", "", "read the query from this file")
+	snippetAddCmd.Flags().BoolVar(&snippetForce, "force", false, "replace a snippet with the same name and scope")
+
+	snippetListCmd.Flags().StringVarP(&snippetConnection, "connection", "c", "", "only list the snippets usable on this saved connection")
+
+	snippetRemoveCmd.Flags().StringVarP(&snippetConnection, "connection", "c", "", "delete the snippet scoped to this saved connection")
+
+	snippetRunCmd.Flags().StringVarP(&snippetConnection, "connection", "c", "", "saved connection to run the snippet on")
+	snippetRunCmd.Flags().StringArrayVarP(&snippetParams, "param", "p", nil, "value of a placeholder, as name=value")
+	snippetRunCmd.Flags().BoolVarP(&snippetYes, "yes", "y", false, "run DROP, TRUNCATE and unrestricted UPDATE or DELETE statements without asking")
+	snippetRunCmd.Flags().BoolVar(&snippetContinue, "continue", false, "keep running the statements after one fails")
+	snippetRunCmd.MarkFlagRequired("connection")
+
+	snippetCmd.AddCommand(snippetAddCmd, snippetListCmd, snippetRemoveCmd, snippetRunCmd)
+}
+
+// snippetQuery returns the query of a new snippet from the arguments, the
+// file flag or standard input
+func snippetQuery(args []string) (string, error) {
+	switch {
+	case len(args) == 2 && snippetFile != "":
+		return "", fmt.Errorf("give the query as an argument or with --file, not both")
+	case len(args) == 2:
+		return args[1], nil
+	case snippetFile != "":
+		data, err := os.ReadFile(snippetFile)
+		return string(data), err
+	}
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Enter the query, then press Ctrl+D:")
+	}
+	data, err := io.ReadAll(os.Stdin)
+	return string(data), err
+}
+
+// snippetValues collects the values of the placeholders of a snippet from
+// the --param flags, asking for the missing ones in a form. The values are
+// nil when the user quit the form.
+func snippetValues(snippet config.Snippet, names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	for _, param := range snippetParams {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --param %q, use name=value", param)
+		}
+		values[placeholderName(name)] = value
+	}
+
+	var missing []string
+	for _, name := range names {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("no value given for %s", strings.Join(missing, ", "))
+	}
+
+	entered, err := tui.RunParamForm(snippet.Name, missing)
+	if err != nil || entered == nil {
+		return nil, err
+	}
+	for name, value := range entered {
+		values[name] = value
+	}
+	return values, nil
+}
+
+// placeholderName turns the name given to --param into the placeholder as
+// written in the query: user_id is :user_id and 1 is $1
+func placeholderName(name string) string {
+	if strings.HasPrefix(name, ":") || strings.HasPrefix(name, "$") {
+		return name
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return "$" + name
+	}
+	return ":" + name
+}
+
+// checkDestructive refuses snippets with destructive statements unless
+// --yes was given. A read-only session refuses them anyway.
+func checkDestructive(session *db.Session, snippet config.Snippet) error {
+	if snippetYes || session.ReadOnly() {
+		return nil
+	}
+	for _, statement := range session.Split(snippet.Query) {
+		if class := session.Classify(statement); class.Destructive != "" {
+			what := class.Destructive
+			if class.Target != "" {
+				what += " on " + class.Target
+			}
+			return fmt.Errorf("snippet '%s' runs %s, rerun with --yes to run it", snippet.Name, what)
+		}
+	}
+	return nil
+}
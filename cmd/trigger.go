@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var schemaTriggerCmd = &cobra.Command{
+	Use:   "schema-trigger",
+	Short: "Install or remove the PostgreSQL schema change trigger",
+	Long: `The SQL editor keeps its completion schema in step with the database by
+checking a fingerprint of the catalog every few seconds. On PostgreSQL, an
+event trigger can notify it of schema changes instead.
+
+The trigger is only created by "install": it adds the event trigger
+maxim_schema_change and the function public.maxim_notify_schema_change()
+to the database of the saved connection, and fires after every DDL
+statement of every client until "uninstall" removes them. Both need a
+superuser connection.`,
+}
+
+var schemaTriggerInstallCmd = &cobra.Command{
+	Use:   "install <connection>",
+	Short: "Install the schema change trigger in the database of a saved connection",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, details := openSaved(args[0])
+		defer conn.Close()
+
+		if err := db.InstallSchemaTrigger(conn, details.Engine()); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Success: installed the schema change trigger in database '%s'.\n", details.DBName)
+	},
+}
+
+var schemaTriggerUninstallCmd = &cobra.Command{
+	Use:   "uninstall <connection>",
+	Short: "Remove the schema change trigger from the database of a saved connection",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, details := openSaved(args[0])
+		defer conn.Close()
+
+		if err := db.UninstallSchemaTrigger(conn, details.Engine()); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Success: removed the schema change trigger from database '%s'.\n", details.DBName)
+	},
+}
+
+func init() {
+	schemaTriggerCmd.AddCommand(schemaTriggerInstallCmd, schemaTriggerUninstallCmd)
+}
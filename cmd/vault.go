@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/tui"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Manage the encrypted password vault",
+	Long: `The vault keeps connection passwords encrypted with a master passphrase
+in vault.json next to config.json. It is off until you run 'maxim vault init'.
+
+Once unlocked, the key is kept for the rest of your login session so maxim
+asks for the passphrase only once. 'maxim vault lock' forgets it.`,
+}
+
+var vaultInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the vault and choose a master passphrase",
+	Run: func(cmd *cobra.Command, args []string) {
+		if config.VaultExists() {
+			fmt.Println("Error: a vault already exists. Use 'maxim vault change-passphrase' to change its passphrase.")
+			os.Exit(1)
+		}
+
+		passphrase, err := readNewPassphrase()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		vault, err := config.CreateVault(passphrase)
+		if err != nil {
+			fmt.Printf("Error: could not create vault: %v\n", err)
+			os.Exit(1)
+		}
+		if err := vault.SaveSession(); err != nil {
+			fmt.Printf("Warning: could not keep the vault unlocked: %v\n", err)
+		}
+		fmt.Println("Vault created. Passwords for connections you save from now on will be stored in it.")
+	},
+}
+
+var vaultUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock the vault for the rest of this login session",
+	Run: func(cmd *cobra.Command, args []string) {
+		vault := openVaultOrExit()
+		if err := promptUnlock(vault); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := vault.SaveSession(); err != nil {
+			fmt.Printf("Error: could not keep the vault unlocked: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Vault unlocked.")
+	},
+}
+
+var vaultLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Lock the vault so the passphrase is asked for again",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := config.LockSession(); err != nil {
+			fmt.Printf("Error: could not lock vault: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Vault locked.")
+	},
+}
+
+var vaultChangePassphraseCmd = &cobra.Command{
+	Use:   "change-passphrase",
+	Short: "Re-encrypt the vault with a new master passphrase",
+	Run: func(cmd *cobra.Command, args []string) {
+		vault := openVaultOrExit()
+		if err := promptUnlock(vault); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		passphrase, err := readNewPassphrase()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := vault.ChangePassphrase(passphrase); err != nil {
+			fmt.Printf("Error: could not change passphrase: %v\n", err)
+			os.Exit(1)
+		}
+
+		// The old session key no longer opens the vault
+		if err := vault.SaveSession(); err != nil {
+			fmt.Printf("Warning: could not keep the vault unlocked: %v\n", err)
+		}
+		fmt.Println("Vault passphrase changed.")
+	},
+}
+
+// vaultChecked is set once the vault was looked at, so it is unlocked, or
+// the passphrase asked for, at most once a run
+var vaultChecked bool
+
+// unlockVault makes the vault available to the config package when the user
+// has created one. The passphrase is asked for on the terminal only when the
+// login session has not unlocked it yet. Failures are warnings so the caller
+// can carry on without saved passwords. Only the first call in a run does
+// anything.
+func unlockVault() {
+	vault, err := lockedVault()
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return
+	}
+	if vault == nil {
+		return
+	}
+	if err := promptUnlock(vault); err != nil {
+		fmt.Printf("Warning: vault not unlocked: %v\n", err)
+		return
+	}
+	if err := useVault(vault); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// unlockAppVault is the UnlockVault hook of the app. The app asks for the
+// passphrase when the login session has not unlocked the vault, then calls
+// it again with the answer.
+func unlockAppVault(passphrase string) error {
+	if passphrase == "" {
+		vault, err := lockedVault()
+		if err != nil || vault == nil {
+			return err
+		}
+		return tui.ErrPassphraseNeeded
+	}
+
+	vault, err := config.OpenVault()
+	if err != nil {
+		return fmt.Errorf("could not open vault: %w", err)
+	}
+	if err := vault.Unlock(passphrase); err != nil {
+		return err
+	}
+	return useVault(vault)
+}
+
+// lockedVault uses the vault right away when the login session has unlocked
+// it and returns it when it still needs its passphrase. It returns nil
+// when there is no vault or after the first call in a run.
+func lockedVault() (*config.Vault, error) {
+	if vaultChecked {
+		return nil, nil
+	}
+	vaultChecked = true
+	if !config.VaultExists() {
+		return nil, nil
+	}
+	vault, err := config.OpenVault()
+	if err != nil {
+		return nil, fmt.Errorf("could not open vault: %w", err)
+	}
+	if vault.UnlockFromSession() {
+		config.UseVault(vault)
+		return nil, nil
+	}
+	return vault, nil
+}
+
+// useVault hands the unlocked vault to the config package and keeps its key
+// for the rest of the login session
+func useVault(vault *config.Vault) error {
+	config.UseVault(vault)
+	if err := vault.SaveSession(); err != nil {
+		return fmt.Errorf("could not keep the vault unlocked: %w", err)
+	}
+	return nil
+}
+
+func openVaultOrExit() *config.Vault {
+	if !config.VaultExists() {
+		fmt.Println("Error: no vault found. Create one with 'maxim vault init'.")
+		os.Exit(1)
+	}
+	vault, err := config.OpenVault()
+	if err != nil {
+		fmt.Printf("Error: could not open vault: %v\n", err)
+		os.Exit(1)
+	}
+	return vault
+}
+
+func promptUnlock(vault *config.Vault) error {
+	passphrase, err := readSecret("Vault passphrase: ")
+	if err != nil {
+		return err
+	}
+	return vault.Unlock(passphrase)
+}
+
+func readNewPassphrase() (string, error) {
+	passphrase, err := readSecret("New vault passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("vault passphrase cannot be empty")
+	}
+	confirm, err := readSecret("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirm {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// readSecret prints prompt and reads a line without echoing it
+func readSecret(prompt string) (string, error) {
+	fmt.Print(prompt)
+	secret, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Println() // New line after hidden input
+	if err != nil {
+		return "", fmt.Errorf("could not read input: %w", err)
+	}
+	return string(secret), nil
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultInitCmd)
+	vaultCmd.AddCommand(vaultUnlockCmd)
+	vaultCmd.AddCommand(vaultLockCmd)
+	vaultCmd.AddCommand(vaultChangePassphraseCmd)
+}
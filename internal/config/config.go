@@ -1,21 +1,125 @@
 package config
 
 import (
-	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ConnectionDetails struct {
+	DBType string `json:"dbtype,omitempty"`
 	Host   string `json:"host"`
 	Port   string `json:"port"`
 	User   string `json:"user"`
 	DBName string `json:"dbname"`
+
+	// SocketDir connects over a Unix-domain socket in this directory
+	// instead of TCP
+	SocketDir string `json:"socket_dir,omitempty"`
+
+	// TLS settings, using the libpq names and modes
+	SSLMode     string `json:"sslmode,omitempty"`
+	SSLRootCert string `json:"sslrootcert,omitempty"`
+	SSLCert     string `json:"sslcert,omitempty"`
+	SSLKey      string `json:"sslkey,omitempty"`
+
+	// Params holds extra driver parameters such as application_name or
+	// connect_timeout, usually taken from a connection URI
+	Params map[string]string `json:"params,omitempty"`
+
+	// SSH is an optional jump host the database is reached through
+	SSH *SSHTunnel `json:"ssh,omitempty"`
+
+	// StatementTimeout limits how long a query may run before it is
+	// canceled, such as 30s or 5m. Empty means no limit.
+	StatementTimeout string `json:"statement_timeout,omitempty"`
+
+	// ReadOnly opens read-only sessions and refuses statements that write
+	ReadOnly bool `json:"read_only,omitempty"`
+	// Environment labels the connection, such as production or staging.
+	// Production connections are shown with a red banner.
+	Environment string `json:"environment,omitempty"`
+
+	// LastUsed is when the connection was last opened from the picker
+	LastUsed time.Time `json:"last_used,omitzero"`
+}
+
+// SSHTunnel holds the jump host settings of a connection. Empty fields use
+// the ssh defaults: port 22, the current OS user, ssh-agent or the default
+// identities, and ~/.ssh/known_hosts.
+type SSHTunnel struct {
+	Host       string `json:"host"`
+	Port       string `json:"port,omitempty"`
+	User       string `json:"user,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+	KnownHosts string `json:"known_hosts,omitempty"`
+}
+
+// SavedConnection is a named entry from the database connections
+type SavedConnection struct {
+	Name    string
+	Details ConnectionDetails
 }
 
 type Config struct {
+	// Version is the schema version, see ConfigVersion
+	Version int `json:"version"`
+
 	AdminConnection     *ConnectionDetails            `json:"admin_connection"`
 	DatabaseConnections map[string]*ConnectionDetails `json:"database_connections"`
+
+	// Snippets are the saved queries, global or scoped to a connection
+	Snippets []Snippet `json:"snippets,omitempty"`
+}
+
+// Engine returns the database type of the connection, defaulting to PostgreSQL
+// for entries saved before other engines were supported
+func (d ConnectionDetails) Engine() string {
+	if d.DBType == "" {
+		return "psql"
+	}
+	return d.DBType
+}
+
+// IsProduction reports whether the connection is labeled as production
+func (d ConnectionDetails) IsProduction() bool {
+	switch strings.ToLower(strings.TrimSpace(d.Environment)) {
+	case "production", "prod":
+		return true
+	}
+	return false
+}
+
+// Timeout returns the statement timeout of the connection, or zero when it
+// has none
+func (d ConnectionDetails) Timeout() time.Duration {
+	timeout, err := ParseStatementTimeout(d.StatementTimeout)
+	if err != nil {
+		return 0
+	}
+	return timeout
+}
+
+// ParseStatementTimeout parses a statement timeout given as a duration such
+// as 30s or 1m30s, or as a plain number of seconds. Empty means no limit.
+func ParseStatementTimeout(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(s); err == nil {
+		s = strconv.Itoa(seconds) + "s"
+	}
+	timeout, err := time.ParseDuration(s)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid statement timeout %q, use a duration such as 30s or 5m", s)
+	}
+	return timeout, nil
 }
 
 func getConfigPath() (string, error) {
@@ -27,45 +131,30 @@ func getConfigPath() (string, error) {
 	return filepath.Join(maximDir, "config.json"), nil
 }
 
+// SaveAdminConnection saves the superuser connection. The password is kept
+// in the vault when one is unlocked and is otherwise not stored.
 func SaveAdminConnection(details ConnectionDetails, password string) error {
-	// Save all connection details except password
-	cfg := Config{
-		AdminConnection: &details,
-	}
-
-	configPath, err := getConfigPath()
+	store, err := DefaultStore()
 	if err != nil {
 		return err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
-		return err
-	}
-
-	file, err := json.MarshalIndent(cfg, "", "  ")
+	err = store.Update(func(cfg *Config) error {
+		cfg.AdminConnection = &details
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-
-	return os.WriteFile(configPath, file, 0600)
+	return storePassword(AdminVaultEntry, password)
 }
 
 func LoadAdminConnection() (*ConnectionDetails, error) {
-	configPath, err := getConfigPath()
-	if err != nil {
-		return nil, err
-	}
-
-	file, err := os.ReadFile(configPath)
+	cfg, err := loadConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(file, &cfg); err != nil {
-		return nil, err
-	}
-
 	if cfg.AdminConnection == nil {
 		return nil, os.ErrNotExist
 	}
@@ -73,60 +162,31 @@ func LoadAdminConnection() (*ConnectionDetails, error) {
 	return cfg.AdminConnection, nil
 }
 
-// SaveDatabaseConnection saves a regular database connection (not admin)
+// SaveDatabaseConnection saves a regular database connection (not admin).
+// The password is kept in the vault when one is unlocked.
 func SaveDatabaseConnection(connectionName string, details ConnectionDetails, password string) error {
-	configPath, err := getConfigPath()
+	store, err := DefaultStore()
 	if err != nil {
 		return err
 	}
 
-	// Load existing config or create new one
-	var cfg Config
-	if file, err := os.ReadFile(configPath); err == nil {
-		json.Unmarshal(file, &cfg)
-	}
-
-	// Initialize database connections map if nil
-	if cfg.DatabaseConnections == nil {
-		cfg.DatabaseConnections = make(map[string]*ConnectionDetails)
-	}
-
-	// Save the connection details (except password)
-	cfg.DatabaseConnections[connectionName] = &details
-
-	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
-		return err
-	}
-
-	file, err := json.MarshalIndent(cfg, "", "  ")
+	err = store.Update(func(cfg *Config) error {
+		cfg.DatabaseConnections[connectionName] = &details
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-
-	return os.WriteFile(configPath, file, 0600)
+	return storePassword(connectionName, password)
 }
 
 // LoadDatabaseConnection loads a regular database connection by name
 func LoadDatabaseConnection(connectionName string) (*ConnectionDetails, error) {
-	configPath, err := getConfigPath()
+	cfg, err := loadConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, err
-	}
-
-	var cfg Config
-	if err := json.Unmarshal(file, &cfg); err != nil {
-		return nil, err
-	}
-
-	if cfg.DatabaseConnections == nil {
-		return nil, os.ErrNotExist
-	}
-
 	details, exists := cfg.DatabaseConnections[connectionName]
 	if !exists {
 		return nil, os.ErrNotExist
@@ -137,29 +197,132 @@ func LoadDatabaseConnection(connectionName string) (*ConnectionDetails, error) {
 
 // ListDatabaseConnections returns all saved database connection names
 func ListDatabaseConnections() ([]string, error) {
-	configPath, err := getConfigPath()
+	cfg, err := loadConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := os.ReadFile(configPath)
+	names := []string{}
+	for name := range cfg.DatabaseConnections {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// ListSavedConnections returns the saved database connections, most
+// recently used first
+func ListSavedConnections() ([]SavedConnection, error) {
+	cfg, err := loadConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(file, &cfg); err != nil {
-		return nil, err
+	saved := make([]SavedConnection, 0, len(cfg.DatabaseConnections))
+	for name, details := range cfg.DatabaseConnections {
+		saved = append(saved, SavedConnection{Name: name, Details: *details})
 	}
+	sort.Slice(saved, func(i, j int) bool {
+		if !saved[i].Details.LastUsed.Equal(saved[j].Details.LastUsed) {
+			return saved[i].Details.LastUsed.After(saved[j].Details.LastUsed)
+		}
+		return saved[i].Name < saved[j].Name
+	})
+	return saved, nil
+}
 
-	if cfg.DatabaseConnections == nil {
-		return []string{}, nil
+// DeleteDatabaseConnection removes a saved connection and its vault entry
+func DeleteDatabaseConnection(connectionName string) error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
 	}
 
-	var names []string
-	for name := range cfg.DatabaseConnections {
-		names = append(names, name)
+	err = store.Update(func(cfg *Config) error {
+		if _, exists := cfg.DatabaseConnections[connectionName]; !exists {
+			return fmt.Errorf("no saved connection named '%s'", connectionName)
+		}
+		delete(cfg.DatabaseConnections, connectionName)
+		cfg.Snippets = slices.DeleteFunc(cfg.Snippets, func(s Snippet) bool {
+			return s.Connection == connectionName
+		})
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	if activeVault != nil {
+		return activeVault.DeletePassword(connectionName)
+	}
+	return nil
+}
 
-	return names, nil
+// RenameDatabaseConnection gives a saved connection a new name, moving its
+// vault entry along with it
+func RenameDatabaseConnection(oldName, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("connection name cannot be empty")
+	}
+	if oldName == newName {
+		return nil
+	}
+
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	err = store.Update(func(cfg *Config) error {
+		details, exists := cfg.DatabaseConnections[oldName]
+		if !exists {
+			return fmt.Errorf("no saved connection named '%s'", oldName)
+		}
+		if _, taken := cfg.DatabaseConnections[newName]; taken {
+			return fmt.Errorf("a connection named '%s' already exists", newName)
+		}
+		delete(cfg.DatabaseConnections, oldName)
+		cfg.DatabaseConnections[newName] = details
+		for i := range cfg.Snippets {
+			if cfg.Snippets[i].Connection == oldName {
+				cfg.Snippets[i].Connection = newName
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if password, ok := LoadPassword(oldName); ok {
+		if err := activeVault.SetPassword(newName, password); err != nil {
+			return err
+		}
+		return activeVault.DeletePassword(oldName)
+	}
+	return nil
+}
+
+// TouchDatabaseConnection records that a saved connection was just used
+func TouchDatabaseConnection(connectionName string) error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Update(func(cfg *Config) error {
+		details, exists := cfg.DatabaseConnections[connectionName]
+		if !exists {
+			return os.ErrNotExist
+		}
+		details.LastUsed = time.Now().UTC()
+		return nil
+	})
+}
+
+func loadConfig() (Config, error) {
+	store, err := DefaultStore()
+	if err != nil {
+		return Config{}, err
+	}
+	return store.Load()
 }
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HistoryEntry is one executed statement
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+	// Connection is the saved connection name, empty for a connection
+	// opened from a URI
+	Connection string        `json:"connection,omitempty"`
+	Database   string        `json:"database,omitempty"`
+	Query      string        `json:"query"`
+	Duration   time.Duration `json:"duration_ns"`
+	// Rows is the number of rows returned, or affected for statements that
+	// change rows
+	Rows    int64  `json:"rows"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// History is the query history, kept as one JSON entry per line in
+// history.jsonl next to config.json. Writers take the same kind of lock as
+// the config store so several maxim processes can share it.
+type History struct {
+	path string
+}
+
+// NewHistory returns the history kept in the file at path
+func NewHistory(path string) *History {
+	return &History{path: path}
+}
+
+// DefaultHistory returns the user's history
+func DefaultHistory() (*History, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return NewHistory(filepath.Join(filepath.Dir(configPath), "history.jsonl")), nil
+}
+
+// Path returns the location of the history file
+func (h *History) Path() string {
+	return h.path
+}
+
+// Append adds entries to the end of the history
+func (h *History) Append(entries ...HistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	return withFileLock(h.path, func() error {
+		f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(buf.Bytes()); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// Load returns the history, oldest entry first. A missing file gives an
+// empty history, and lines that cannot be read are skipped.
+func (h *History) Load() ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	err := withFileLock(h.path, func() error {
+		var err error
+		entries, err = h.read()
+		return err
+	})
+	return entries, err
+}
+
+// Prune removes the entries keep returns false for and returns how many
+// were removed. keep is given the index of the entry, oldest first, and the
+// number of entries, both read under the lock.
+func (h *History) Prune(keep func(i, total int, entry HistoryEntry) bool) (int, error) {
+	removed := 0
+	err := withFileLock(h.path, func() error {
+		entries, err := h.read()
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		for i, entry := range entries {
+			if !keep(i, len(entries), entry) {
+				removed++
+				continue
+			}
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+		if removed == 0 {
+			return nil
+		}
+		return writeFileAtomic(h.path, buf.Bytes(), 0600)
+	})
+	return removed, err
+}
+
+func (h *History) read() ([]HistoryEntry, error) {
+	f, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		var entry HistoryEntry
+		if len(bytes.TrimSpace(line)) > 0 && json.Unmarshal(line, &entry) == nil {
+			entries = append(entries, entry)
+		}
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
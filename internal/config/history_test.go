@@ -0,0 +1,46 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestHistoryPruneKeepsNewest(t *testing.T) {
+	h := NewHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+	for _, query := range []string{"SELECT 1", "SELECT 2", "SELECT 3"} {
+		if err := h.Append(HistoryEntry{Query: query}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// keep is told how many entries there are, so the newest can be kept
+	// without reading the history first
+	removed, err := h.Prune(func(i, total int, entry HistoryEntry) bool {
+		return i >= total-2
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d entries, want 1", removed)
+	}
+	if err := h.Append(HistoryEntry{Query: "SELECT 4"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Prune(func(i, total int, entry HistoryEntry) bool { return i >= total-2 }); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := h.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries []string
+	for _, entry := range entries {
+		queries = append(queries, entry.Query)
+	}
+	if want := []string{"SELECT 3", "SELECT 4"}; !slices.Equal(queries, want) {
+		t.Errorf("kept %q, want %q", queries, want)
+	}
+}
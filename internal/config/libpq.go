@@ -0,0 +1,296 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// libpqEnvironment maps the libpq environment variables to the parameter
+// names understood by setConnectionParam
+var libpqEnvironment = []struct{ env, param string }{
+	{"PGHOST", "host"},
+	{"PGPORT", "port"},
+	{"PGUSER", "user"},
+	{"PGDATABASE", "dbname"},
+	{"PGSSLMODE", "sslmode"},
+	{"PGSSLROOTCERT", "sslrootcert"},
+	{"PGSSLCERT", "sslcert"},
+	{"PGSSLKEY", "sslkey"},
+	{"PGAPPNAME", "application_name"},
+	{"PGCONNECT_TIMEOUT", "connect_timeout"},
+}
+
+// LibpqDefaults returns the PostgreSQL connection details and password that
+// libpq would use without any explicit parameters. It is used to pre-fill
+// the forms.
+func LibpqDefaults() (ConnectionDetails, string, error) {
+	return ResolveLibpq(ConnectionDetails{DBType: "psql"}, "")
+}
+
+// ResolveLibpq fills the gaps in PostgreSQL connection details the way libpq
+// does: explicit values win, then the entry of the service named by the
+// "service" parameter or PGSERVICE, then the PG* environment variables. An
+// empty password is looked up in PGPASSWORD and then in the password file.
+// Details for other engines are returned unchanged.
+func ResolveLibpq(details ConnectionDetails, password string) (ConnectionDetails, string, error) {
+	if details.Engine() != "psql" {
+		return details, password, nil
+	}
+
+	// Copy the params so the caller's map is left alone
+	params := make(map[string]string, len(details.Params))
+	for key, value := range details.Params {
+		params[key] = value
+	}
+	service := params["service"]
+	delete(params, "service")
+	details.Params = params
+
+	if service == "" {
+		service = os.Getenv("PGSERVICE")
+	}
+	if service != "" {
+		entry, servicePassword, err := LookupService(service)
+		if err != nil {
+			return ConnectionDetails{}, "", err
+		}
+		details = mergeMissing(details, entry)
+		if password == "" {
+			password = servicePassword
+		}
+	}
+
+	var fromEnv ConnectionDetails
+	var envPassword string
+	for _, variable := range libpqEnvironment {
+		if value := os.Getenv(variable.env); value != "" {
+			setConnectionParam(&fromEnv, &envPassword, variable.param, value)
+		}
+	}
+	details = mergeMissing(details, fromEnv)
+
+	if password == "" {
+		password = os.Getenv("PGPASSWORD")
+	}
+	if password == "" {
+		password, _ = LookupPgpass(details)
+	}
+
+	if len(details.Params) == 0 {
+		details.Params = nil
+	}
+	return details, password, nil
+}
+
+// mergeMissing copies every value of fallback that is empty in details
+func mergeMissing(details, fallback ConnectionDetails) ConnectionDetails {
+	fill := func(value *string, from string) {
+		if *value == "" {
+			*value = from
+		}
+	}
+	fill(&details.Host, fallback.Host)
+	fill(&details.Port, fallback.Port)
+	fill(&details.User, fallback.User)
+	fill(&details.DBName, fallback.DBName)
+	fill(&details.SSLMode, fallback.SSLMode)
+	fill(&details.SSLRootCert, fallback.SSLRootCert)
+	fill(&details.SSLCert, fallback.SSLCert)
+	fill(&details.SSLKey, fallback.SSLKey)
+
+	for key, value := range fallback.Params {
+		if _, exists := details.Params[key]; !exists {
+			if details.Params == nil {
+				details.Params = make(map[string]string)
+			}
+			details.Params[key] = value
+		}
+	}
+	return details
+}
+
+// LookupService reads the named entry from the per-user service file
+// (PGSERVICEFILE or ~/.pg_service.conf) or, when it is not defined there,
+// from the system-wide pg_service.conf
+func LookupService(name string) (ConnectionDetails, string, error) {
+	for _, path := range serviceFiles() {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		details, password, found, err := parseServiceFile(file, name)
+		file.Close()
+		if err != nil {
+			return ConnectionDetails{}, "", fmt.Errorf("%s: %w", path, err)
+		}
+		if found {
+			return details, password, nil
+		}
+	}
+	return ConnectionDetails{}, "", fmt.Errorf("definition of service '%s' not found", name)
+}
+
+// serviceFiles lists the service files in the order libpq searches them
+func serviceFiles() []string {
+	var files []string
+	if path := os.Getenv("PGSERVICEFILE"); path != "" {
+		files = append(files, path)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".pg_service.conf"))
+	}
+
+	if dir := os.Getenv("PGSYSCONFDIR"); dir != "" {
+		files = append(files, filepath.Join(dir, "pg_service.conf"))
+	} else {
+		files = append(files, "/etc/postgresql-common/pg_service.conf", "/etc/pg_service.conf")
+	}
+	return files
+}
+
+// parseServiceFile reads an INI-style service file and returns the
+// parameters of the [name] section
+func parseServiceFile(file io.Reader, name string) (ConnectionDetails, string, bool, error) {
+	details := ConnectionDetails{DBType: "psql"}
+	var password string
+	found, inSection := false, false
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if found {
+				break
+			}
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == name
+			found = inSection
+			continue
+		}
+		if !inSection {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return ConnectionDetails{}, "", false, fmt.Errorf("syntax error on line %d", lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		if key == "service" {
+			return ConnectionDetails{}, "", false, fmt.Errorf("nested service specifications are not supported (line %d)", lineNumber)
+		}
+		if err := setConnectionParam(&details, &password, key, strings.TrimSpace(value)); err != nil {
+			return ConnectionDetails{}, "", false, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ConnectionDetails{}, "", false, err
+	}
+	return details, password, found, nil
+}
+
+// LookupPgpass finds the password for a connection in PGPASSFILE or
+// ~/.pgpass. Like libpq, the file is ignored when it is not a plain file or
+// when group or others can access it. Empty host, port and user fall back
+// to localhost, 5432 and the operating system user.
+func LookupPgpass(details ConnectionDetails) (string, bool) {
+	path := os.Getenv("PGPASSFILE")
+	if path == "" {
+		if runtime.GOOS == "windows" {
+			path = filepath.Join(os.Getenv("APPDATA"), "postgresql", "pgpass.conf")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".pgpass")
+		} else {
+			return "", false
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: password file %s has group or world access; permissions should be u=rw (0600) or less\n", path)
+		return "", false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	host := details.Host
+	if host == "" || strings.HasPrefix(host, "/") {
+		host = "localhost"
+	}
+	port := details.Port
+	if port == "" {
+		port = "5432"
+	}
+	username := details.User
+	if username == "" {
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		}
+	}
+	dbname := details.DBName
+	if dbname == "" {
+		dbname = username
+	}
+	want := []string{host, port, dbname, username}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitPgpassLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+
+		matches := true
+		for i, value := range want {
+			if fields[i] != "*" && fields[i] != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return fields[4], true
+		}
+	}
+	return "", false
+}
+
+// splitPgpassLine splits a password file line on unescaped colons, removing
+// the backslashes that escape : and \ inside fields
+func splitPgpassLine(line string) []string {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			field.WriteByte(line[i])
+		case line[i] == ':' && len(fields) < 4:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(line[i])
+		}
+	}
+	return append(fields, field.String())
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitPgpassLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"db:5432:shop:app:secret", []string{"db", "5432", "shop", "app", "secret"}},
+		{"*:*:*:*:secret", []string{"*", "*", "*", "*", "secret"}},
+		{`db:5432:shop:app:pass\:word`, []string{"db", "5432", "shop", "app", "pass:word"}},
+		{`db:5432:shop:app:back\\slash`, []string{"db", "5432", "shop", "app", `back\slash`}},
+		{`db\:1:5432:shop:app:secret`, []string{"db:1", "5432", "shop", "app", "secret"}},
+		// The password is the rest of the line, colons included
+		{"db:5432:shop:app:a:b", []string{"db", "5432", "shop", "app", "a:b"}},
+		{"db:5432:shop", []string{"db", "5432", "shop"}},
+		{`db:5432:shop:app:trailing\`, []string{"db", "5432", "shop", "app", `trailing\`}},
+	}
+
+	for _, test := range tests {
+		if got := splitPgpassLine(test.line); !slices.Equal(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+// writePgpass writes a password file and points PGPASSFILE at it
+func writePgpass(t *testing.T, content string, perm os.FileMode) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pgpass")
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PGPASSFILE", path)
+}
+
+func TestLookupPgpass(t *testing.T) {
+	writePgpass(t, strings.Join([]string{
+		"# comment:line:that:looks:like-an-entry",
+		"db.internal:5432:shop:app:first",
+		"db.internal:5432:shop:app:second",
+		"db.internal:*:*:reporting:any-port",
+		`db\:colon:5432:shop:app:escaped`,
+		"localhost:5432:shop:app:local",
+		"*:*:*:*:fallback",
+	}, "\n"), 0600)
+
+	tests := []struct {
+		details ConnectionDetails
+		want    string
+	}{
+		// The first matching line wins
+		{ConnectionDetails{Host: "db.internal", Port: "5432", DBName: "shop", User: "app"}, "first"},
+		{ConnectionDetails{Host: "db.internal", Port: "6432", DBName: "sales", User: "reporting"}, "any-port"},
+		{ConnectionDetails{Host: "db:colon", Port: "5432", DBName: "shop", User: "app"}, "escaped"},
+		// An empty host or a socket directory is localhost, and the port
+		// defaults to 5432
+		{ConnectionDetails{DBName: "shop", User: "app"}, "local"},
+		{ConnectionDetails{Host: "/var/run/postgresql", DBName: "shop", User: "app"}, "local"},
+		{ConnectionDetails{Host: "elsewhere", DBName: "shop", User: "app"}, "fallback"},
+	}
+
+	for _, test := range tests {
+		got, ok := LookupPgpass(test.details)
+		if !ok || got != test.want {
+			t.Errorf("%+v: got %q, %v, want %q", test.details, got, ok, test.want)
+		}
+	}
+}
+
+func TestLookupPgpassNoMatch(t *testing.T) {
+	writePgpass(t, "db.internal:5432:shop:app:secret\n", 0600)
+	if got, ok := LookupPgpass(ConnectionDetails{Host: "db.internal", Port: "5432", DBName: "shop", User: "other"}); ok {
+		t.Errorf("got %q for a user without an entry", got)
+	}
+}
+
+func TestLookupPgpassRejectsOpenPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the password file permissions are not checked on Windows")
+	}
+	details := ConnectionDetails{Host: "db.internal", Port: "5432", DBName: "shop", User: "app"}
+	for _, perm := range []os.FileMode{0640, 0604, 0644} {
+		writePgpass(t, "*:*:*:*:secret\n", perm)
+		if got, ok := LookupPgpass(details); ok {
+			t.Errorf("mode %04o: got %q from a password file others can read", perm, got)
+		}
+	}
+
+	// Not a plain file
+	t.Setenv("PGPASSFILE", t.TempDir())
+	if _, ok := LookupPgpass(details); ok {
+		t.Error("a directory was read as the password file")
+	}
+}
+
+func TestParseServiceFile(t *testing.T) {
+	const file = `
+# Shared settings
+[reporting]
+host=replica.internal
+dbname=sales
+
+[shop]
+host = db.internal
+port=5433
+user=app
+password=secret
+sslmode=verify-full
+application_name=maxim
+
+[other]
+host=other.internal
+`
+	details, password, found, err := parseServiceFile(strings.NewReader(file), "shop")
+	if err != nil || !found {
+		t.Fatalf("found %v, err %v", found, err)
+	}
+	want := ConnectionDetails{
+		DBType: "psql", Host: "db.internal", Port: "5433", User: "app",
+		SSLMode: "verify-full", Params: map[string]string{"application_name": "maxim"},
+	}
+	if !reflect.DeepEqual(details, want) {
+		t.Errorf("got %+v, want %+v", details, want)
+	}
+	if password != "secret" {
+		t.Errorf("password %q, want %q", password, "secret")
+	}
+
+	if _, _, found, err := parseServiceFile(strings.NewReader(file), "missing"); found || err != nil {
+		t.Errorf("missing service: found %v, err %v", found, err)
+	}
+
+	for _, bad := range []string{"[shop]\nhost db.internal\n", "[shop]\nservice=other\n"} {
+		if _, _, _, err := parseServiceFile(strings.NewReader(bad), "shop"); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+	// Errors in other sections are not reported
+	if _, _, found, err := parseServiceFile(strings.NewReader("[other]\nbroken\n[shop]\nhost=db\n"), "shop"); !found || err != nil {
+		t.Errorf("found %v, err %v with an error in another section", found, err)
+	}
+}
+
+func TestLookupService(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PGSERVICEFILE", "")
+	sysconf := t.TempDir()
+	t.Setenv("PGSYSCONFDIR", sysconf)
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(home, ".pg_service.conf"), "[shop]\nhost=home.internal\n")
+	write(filepath.Join(sysconf, "pg_service.conf"), "[shop]\nhost=system.internal\n[legacy]\nhost=legacy.internal\n")
+
+	lookupHost := func(name string) string {
+		t.Helper()
+		details, _, err := LookupService(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return details.Host
+	}
+
+	// The per-user file comes before the system-wide one
+	if got := lookupHost("shop"); got != "home.internal" {
+		t.Errorf("got host %q, want the one of ~/.pg_service.conf", got)
+	}
+
+	// PGSERVICEFILE replaces ~/.pg_service.conf
+	custom := filepath.Join(t.TempDir(), "services.conf")
+	write(custom, "[shop]\nhost=custom.internal\n")
+	t.Setenv("PGSERVICEFILE", custom)
+	if got := lookupHost("shop"); got != "custom.internal" {
+		t.Errorf("got host %q, want the one of PGSERVICEFILE", got)
+	}
+
+	// Services missing from the user file are read from the system one
+	if got := lookupHost("legacy"); got != "legacy.internal" {
+		t.Errorf("got host %q, want the one of the system file", got)
+	}
+	if _, _, err := LookupService("missing"); err == nil {
+		t.Error("no error for an undefined service")
+	}
+
+	// The service parameter fills what the connection leaves out
+	t.Setenv("PGHOST", "")
+	details, _, err := ResolveLibpq(ConnectionDetails{DBType: "psql", DBName: "shop", Params: map[string]string{"service": "shop"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Host != "custom.internal" || details.DBName != "shop" || details.Params["service"] != "" {
+		t.Errorf("ResolveLibpq() = %+v", details)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// noFollow makes opening a symbolic link fail instead of following it
+const noFollow = unix.O_NOFOLLOW
+
+// checkPrivateDir rejects a directory that is not owned by the user or that
+// other users may read or write
+func checkPrivateDir(dir string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("cannot check the owner of %s", dir)
+	}
+	if int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is owned by another user, refusing to keep the vault key there", dir)
+	}
+	if info.Mode().Perm() != 0700 {
+		return fmt.Errorf("%s has mode %04o instead of 0700, refusing to keep the vault key there", dir, info.Mode().Perm())
+	}
+	return nil
+}
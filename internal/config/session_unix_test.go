@@ -0,0 +1,124 @@
+//go:build unix
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVaultSession(t *testing.T) {
+	useTestConfigDir(t)
+	v, err := CreateVault("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SaveSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := getSessionKeyPath()
+	for _, name := range []string{filepath.Dir(path), path} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := os.FileMode(0600)
+		if info.IsDir() {
+			want = 0700
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s has mode %04o, want %04o", name, info.Mode().Perm(), want)
+		}
+	}
+
+	reopened, err := OpenVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.UnlockFromSession() {
+		t.Fatal("UnlockFromSession() did not use the saved key")
+	}
+
+	if err := LockSession(); err != nil {
+		t.Fatal(err)
+	}
+	reopened.Lock()
+	if reopened.UnlockFromSession() {
+		t.Error("UnlockFromSession() unlocked after LockSession()")
+	}
+}
+
+func TestVaultSessionRefusesSharedDirectory(t *testing.T) {
+	useTestConfigDir(t)
+	v, err := CreateVault("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SaveSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Dir(getSessionKeyPath())
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SaveSession(); err == nil {
+		t.Error("SaveSession() wrote to a directory other users can read")
+	}
+	reopened, err := OpenVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.UnlockFromSession() {
+		t.Error("UnlockFromSession() read a key from a directory other users can read")
+	}
+}
+
+func TestVaultSessionRefusesSymlinks(t *testing.T) {
+	useTestConfigDir(t)
+	v, err := CreateVault("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SaveSession(); err != nil {
+		t.Fatal(err)
+	}
+	path := getSessionKeyPath()
+
+	// A key file replaced by a link to a key kept elsewhere
+	elsewhere := filepath.Join(t.TempDir(), "vault.key")
+	if err := os.Rename(path, elsewhere); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(elsewhere, path); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.UnlockFromSession() {
+		t.Error("UnlockFromSession() followed a symbolic link to the key")
+	}
+
+	// A key directory replaced by a link to another directory
+	dir := filepath.Dir(path)
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	target := t.TempDir()
+	if err := os.Chmod(target, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SaveSession(); err == nil {
+		t.Error("SaveSession() wrote through a symbolic link")
+	}
+	if _, err := os.Stat(filepath.Join(target, "vault.key")); err == nil {
+		t.Error("the key was written to the linked directory")
+	}
+}
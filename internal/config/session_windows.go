@@ -0,0 +1,16 @@
+//go:build windows
+
+package config
+
+import (
+	"os"
+)
+
+// noFollow is not needed on Windows, where the temp dir is per user
+const noFollow = 0
+
+// checkPrivateDir accepts any directory: the temp dir is already private to
+// the user on Windows
+func checkPrivateDir(dir string, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Snippet is a saved query run by name. Its query may hold placeholders
+// such as :user_id or $1, whose values are asked for each time it runs.
+type Snippet struct {
+	Name string `json:"name"`
+	// Connection is the saved connection the snippet belongs to, empty for
+	// a snippet available on every connection
+	Connection  string `json:"connection,omitempty"`
+	Query       string `json:"query"`
+	Description string `json:"description,omitempty"`
+}
+
+// Scope describes where the snippet can be used
+func (s Snippet) Scope() string {
+	if s.Connection == "" {
+		return "global"
+	}
+	return s.Connection
+}
+
+// SaveSnippet saves a snippet, replacing the one with the same name and
+// scope when replace is set and failing otherwise
+func SaveSnippet(snippet Snippet, replace bool) error {
+	snippet.Name = strings.TrimSpace(snippet.Name)
+	if snippet.Name == "" {
+		return fmt.Errorf("snippet name cannot be empty")
+	}
+	snippet.Query = strings.TrimSpace(snippet.Query)
+	if snippet.Query == "" {
+		return fmt.Errorf("snippet query cannot be empty")
+	}
+
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Update(func(cfg *Config) error {
+		if snippet.Connection != "" {
+			if _, exists := cfg.DatabaseConnections[snippet.Connection]; !exists {
+				return fmt.Errorf("no saved connection named '%s'", snippet.Connection)
+			}
+		}
+
+		i := indexSnippet(cfg.Snippets, snippet.Name, snippet.Connection)
+		switch {
+		case i < 0:
+			cfg.Snippets = append(cfg.Snippets, snippet)
+		case replace:
+			cfg.Snippets[i] = snippet
+		default:
+			return fmt.Errorf("a %s snippet named '%s' already exists", snippet.Scope(), snippet.Name)
+		}
+		return nil
+	})
+}
+
+// DeleteSnippet removes the snippet with the given name and scope
+func DeleteSnippet(name, connection string) error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Update(func(cfg *Config) error {
+		i := indexSnippet(cfg.Snippets, name, connection)
+		if i < 0 {
+			return fmt.Errorf("no %s snippet named '%s'", Snippet{Connection: connection}.Scope(), name)
+		}
+		cfg.Snippets = slices.Delete(cfg.Snippets, i, i+1)
+		return nil
+	})
+}
+
+// ListSnippets returns every saved snippet, global ones first, then by
+// connection and name
+func ListSnippets() ([]Snippet, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	snippets := slices.Clone(cfg.Snippets)
+	sort.Slice(snippets, func(i, j int) bool {
+		if snippets[i].Connection != snippets[j].Connection {
+			return snippets[i].Connection < snippets[j].Connection
+		}
+		return snippets[i].Name < snippets[j].Name
+	})
+	return snippets, nil
+}
+
+// SnippetsFor returns the snippets that can be used on a connection, sorted
+// by name: the global ones and those of the connection, which take the place
+// of a global snippet with the same name. An empty connection name gives
+// the global snippets only.
+func SnippetsFor(connection string) ([]Snippet, error) {
+	all, err := ListSnippets()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]Snippet)
+	for _, snippet := range all {
+		switch snippet.Connection {
+		case "":
+			if _, scoped := byName[snippet.Name]; !scoped {
+				byName[snippet.Name] = snippet
+			}
+		case connection:
+			byName[snippet.Name] = snippet
+		}
+	}
+
+	snippets := make([]Snippet, 0, len(byName))
+	for _, snippet := range byName {
+		snippets = append(snippets, snippet)
+	}
+	sort.Slice(snippets, func(i, j int) bool {
+		return snippets[i].Name < snippets[j].Name
+	})
+	return snippets, nil
+}
+
+// FindSnippet returns the snippet with the given name that can be used on
+// a connection, see SnippetsFor
+func FindSnippet(name, connection string) (Snippet, error) {
+	snippets, err := SnippetsFor(connection)
+	if err != nil {
+		return Snippet{}, err
+	}
+	for _, snippet := range snippets {
+		if snippet.Name == name {
+			return snippet, nil
+		}
+	}
+	return Snippet{}, os.ErrNotExist
+}
+
+func indexSnippet(snippets []Snippet, name, connection string) int {
+	return slices.IndexFunc(snippets, func(s Snippet) bool {
+		return s.Name == name && s.Connection == connection
+	})
+}
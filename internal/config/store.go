@@ -0,0 +1,232 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ConfigVersion is the config.json schema version written by this build
+const ConfigVersion = 1
+
+// migrations[i] upgrades a decoded config from version i to i+1. They work
+// on the raw JSON so fields can be renamed or reshaped.
+var migrations = []func(raw map[string]any) error{
+	// 0 -> 1: connections saved before other engines were supported are
+	// PostgreSQL, record that explicitly
+	func(raw map[string]any) error {
+		setDefaultDBType(raw["admin_connection"])
+		if conns, ok := raw["database_connections"].(map[string]any); ok {
+			for _, details := range conns {
+				setDefaultDBType(details)
+			}
+		}
+		return nil
+	},
+}
+
+func setDefaultDBType(details any) {
+	if m, ok := details.(map[string]any); ok {
+		if dbType, _ := m["dbtype"].(string); dbType == "" {
+			m["dbtype"] = "psql"
+		}
+	}
+}
+
+// warnings are the problems met with the config files that did not stop
+// the operation, kept until the app takes them
+var (
+	warningsMu sync.Mutex
+	warnings   []string
+)
+
+// TakeWarnings returns the problems met with the config files since the
+// last call, such as a corrupt config.json that was moved aside, for the
+// caller to show
+func TakeWarnings() []string {
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+	taken := warnings
+	warnings = nil
+	return taken
+}
+
+func addWarning(warning string) {
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+	warnings = append(warnings, warning)
+}
+
+// Store reads and writes config.json. Changes go through Update, which holds
+// a lock across maxim processes while it loads, modifies and saves the file,
+// and replaces the file atomically so a crash never leaves it half written.
+type Store struct {
+	path string
+}
+
+// NewStore returns a store for the config file at path
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// DefaultStore returns the store for the user's config.json
+func DefaultStore() (*Store, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(configPath), nil
+}
+
+// Load returns the current config. A missing file gives an empty config, and
+// so does a corrupt one, which is moved aside with a warning.
+func (s *Store) Load() (Config, error) {
+	var cfg Config
+	err := s.withLock(func() error {
+		var err error
+		cfg, err = s.read()
+		return err
+	})
+	return cfg, err
+}
+
+// Update loads the config, applies fn and writes the result back. Nothing is
+// written when fn returns an error.
+func (s *Store) Update(fn func(cfg *Config) error) error {
+	return s.withLock(func() error {
+		cfg, err := s.read()
+		if err != nil {
+			return err
+		}
+		if err := fn(&cfg); err != nil {
+			return err
+		}
+
+		cfg.Version = ConfigVersion
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(s.path, data, 0600)
+	})
+}
+
+// read decodes and migrates the config file, refusing one written by a
+// newer maxim. The caller holds the lock.
+func (s *Store) read() (Config, error) {
+	cfg := Config{DatabaseConnections: make(map[string]*ConnectionDetails)}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return cfg, s.moveCorrupt(err)
+	}
+
+	version, _ := raw["version"].(float64)
+	if int(version) > ConfigVersion {
+		return cfg, fmt.Errorf("%s was written by a newer version of maxim (schema %d), upgrade maxim to use it", s.path, int(version))
+	}
+	for v := int(version); v < len(migrations); v++ {
+		if err := migrations[v](raw); err != nil {
+			return cfg, fmt.Errorf("could not migrate %s from version %d: %w", s.path, v, err)
+		}
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(migrated, &cfg); err != nil {
+		return Config{DatabaseConnections: make(map[string]*ConnectionDetails)}, s.moveCorrupt(err)
+	}
+	if cfg.DatabaseConnections == nil {
+		cfg.DatabaseConnections = make(map[string]*ConnectionDetails)
+	}
+	return cfg, nil
+}
+
+// moveCorrupt moves an unparsable config aside and keeps the warning from
+// backupCorrupt for TakeWarnings
+func (s *Store) moveCorrupt(parseErr error) error {
+	warning, err := s.backupCorrupt(parseErr)
+	if err != nil {
+		return err
+	}
+	addWarning(warning)
+	return nil
+}
+
+// backupCorrupt moves an unparsable config aside so the next save starts
+// fresh without destroying what the user had. It returns a warning telling
+// where the file went.
+func (s *Store) backupCorrupt(parseErr error) (string, error) {
+	backup := s.path + ".corrupt-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(s.path, backup); err != nil {
+		return "", fmt.Errorf("could not parse %s (%v) or move it aside: %w", s.path, parseErr, err)
+	}
+	return fmt.Sprintf("could not parse %s (%v), it was moved to %s", s.path, parseErr, backup), nil
+}
+
+func (s *Store) withLock(fn func() error) error {
+	return withFileLock(s.path, fn)
+}
+
+// withFileLock runs fn holding an exclusive lock on path.lock, shared with
+// other maxim processes
+func withFileLock(path string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("could not lock %s: %w", path, err)
+	}
+	defer unlockFile(lock)
+
+	return fn()
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over path
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestStore returns a store for config.json in a temporary directory,
+// holding content when it is not empty
+func newTestStore(t *testing.T, content string) *Store {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	TakeWarnings()
+	return NewStore(path)
+}
+
+func TestStoreMissingFile(t *testing.T) {
+	cfg, err := newTestStore(t, "").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DatabaseConnections == nil || len(cfg.DatabaseConnections) != 0 || cfg.AdminConnection != nil {
+		t.Errorf("got %+v, want an empty config", cfg)
+	}
+}
+
+func TestStoreMigratesVersion0(t *testing.T) {
+	s := newTestStore(t, `{
+		"admin_connection": {"host": "localhost", "user": "postgres", "dbname": "postgres"},
+		"database_connections": {
+			"shop": {"host": "db.internal", "user": "app", "dbname": "shop"},
+			"cache": {"dbtype": "mysql", "host": "cache.internal", "dbname": "cache"}
+		}
+	}`)
+
+	cfg, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.AdminConnection.DBType; got != "psql" {
+		t.Errorf("admin connection type %q, want psql", got)
+	}
+	if got := cfg.DatabaseConnections["shop"].DBType; got != "psql" {
+		t.Errorf("shop type %q, want psql", got)
+	}
+	if got := cfg.DatabaseConnections["cache"].DBType; got != "mysql" {
+		t.Errorf("a type already set was changed to %q", got)
+	}
+
+	// Writing the config records the version it was migrated to
+	if err := s.Update(func(cfg *Config) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved struct {
+		Version             int
+		DatabaseConnections map[string]ConnectionDetails `json:"database_connections"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Version != ConfigVersion || saved.DatabaseConnections["shop"].DBType != "psql" {
+		t.Errorf("saved %+v, want version %d with the types filled in", saved, ConfigVersion)
+	}
+}
+
+func TestStoreRefusesNewerVersion(t *testing.T) {
+	s := newTestStore(t, `{"version": 99, "database_connections": {}}`)
+	if _, err := s.Load(); err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("Load() = %v, want a newer version error", err)
+	}
+	err := s.Update(func(cfg *Config) error {
+		t.Error("Update() changed a config written by a newer version")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("Update() = %v, want a newer version error", err)
+	}
+	data, _ := os.ReadFile(s.path)
+	if !strings.Contains(string(data), "99") {
+		t.Error("the newer config was overwritten")
+	}
+}
+
+func TestStoreBacksUpCorruptFile(t *testing.T) {
+	for _, content := range []string{`{"database_connections": {`, `{"database_connections": []}`} {
+		s := newTestStore(t, content)
+		cfg, err := s.Load()
+		if err != nil {
+			t.Fatalf("%q: %v", content, err)
+		}
+		if len(cfg.DatabaseConnections) != 0 {
+			t.Errorf("%q: got %+v, want an empty config", content, cfg)
+		}
+
+		backups, _ := filepath.Glob(s.path + ".corrupt-*")
+		if len(backups) != 1 {
+			t.Fatalf("%q: backups %q, want one", content, backups)
+		}
+		if data, _ := os.ReadFile(backups[0]); string(data) != content {
+			t.Errorf("%q: the backup holds %q", content, data)
+		}
+		if _, err := os.Stat(s.path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%q: the corrupt file was left in place", content)
+		}
+
+		warnings := TakeWarnings()
+		if len(warnings) != 1 || !strings.Contains(warnings[0], backups[0]) {
+			t.Errorf("%q: warnings %q, want one naming the backup", content, warnings)
+		}
+		if again := TakeWarnings(); again != nil {
+			t.Errorf("%q: the warnings were given twice: %q", content, again)
+		}
+	}
+}
+
+func TestStoreWritesAtomically(t *testing.T) {
+	s := newTestStore(t, "")
+	err := s.Update(func(cfg *Config) error {
+		cfg.DatabaseConnections["shop"] = &ConnectionDetails{DBType: "psql", Host: "db.internal"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("config.json has mode %04o, want 0600", info.Mode().Perm())
+	}
+	if temps, _ := filepath.Glob(s.path + ".tmp-*"); len(temps) != 0 {
+		t.Errorf("temporary files were left behind: %q", temps)
+	}
+
+	// A failing change writes nothing
+	before, _ := os.ReadFile(s.path)
+	failure := errors.New("no")
+	err = s.Update(func(cfg *Config) error {
+		delete(cfg.DatabaseConnections, "shop")
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Update() = %v, want the error of the change", err)
+	}
+	if after, _ := os.ReadFile(s.path); string(after) != string(before) {
+		t.Error("a failed update changed the file")
+	}
+
+	// The file is replaced, never written in place, so a reader holding
+	// the old one still sees it whole
+	old, err := os.Open(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	err = s.Update(func(cfg *Config) error {
+		cfg.DatabaseConnections["cache"] = &ConnectionDetails{DBType: "mysql"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept Config
+	if err := json.NewDecoder(old).Decode(&kept); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := kept.DatabaseConnections["cache"]; ok || len(kept.DatabaseConnections) != 1 {
+		t.Errorf("the old file was written in place: %+v", kept.DatabaseConnections)
+	}
+}
@@ -0,0 +1,456 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// AdminVaultEntry is the vault entry holding the superuser password
+const AdminVaultEntry = "@admin"
+
+// vaultCheckValue is encrypted with the vault key so a wrong passphrase can
+// be told apart from a corrupt entry
+const vaultCheckValue = "maxim-vault"
+
+const vaultKeyLength = chacha20poly1305.KeySize
+
+// Argon2id parameters for new vaults and passphrase changes. Tests lower
+// them; vaults keep the parameters they were created with.
+var (
+	vaultKDFTime    uint32 = 3
+	vaultKDFMemory  uint32 = 64 * 1024 // KiB
+	vaultKDFThreads uint8  = 4
+)
+
+var (
+	// ErrVaultLocked is returned when the vault is used before Unlock
+	ErrVaultLocked = errors.New("vault is locked")
+	// ErrWrongPassphrase is returned when the passphrase does not open the vault
+	ErrWrongPassphrase = errors.New("wrong vault passphrase")
+)
+
+// Vault stores connection passwords in vault.json next to config.json. Each
+// entry is sealed with XChaCha20-Poly1305 using a key derived from a master
+// passphrase with Argon2id, and bound to its connection name.
+type Vault struct {
+	path string
+	file vaultFile
+	key  []byte
+}
+
+type vaultFile struct {
+	Version int               `json:"version"`
+	KDF     vaultKDF          `json:"kdf"`
+	Check   string            `json:"check"`
+	Entries map[string]string `json:"entries"`
+}
+
+type vaultKDF struct {
+	Algorithm string `json:"algorithm"`
+	Salt      string `json:"salt"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"`
+	Threads   uint8  `json:"threads"`
+}
+
+// activeVault is the vault used by the Save and Load functions, set with UseVault
+var activeVault *Vault
+
+// UseVault makes the save and load functions store passwords in v. Passing
+// nil disables password storage.
+func UseVault(v *Vault) {
+	activeVault = v
+}
+
+// storePassword saves a password in the active vault when it is unlocked,
+// and otherwise drops it as before the vault existed
+func storePassword(name, password string) error {
+	if activeVault == nil || activeVault.Locked() || password == "" {
+		return nil
+	}
+	return activeVault.SetPassword(name, password)
+}
+
+// LoadPassword returns the password saved for a connection in the active vault
+func LoadPassword(connectionName string) (string, bool) {
+	if activeVault == nil || activeVault.Locked() {
+		return "", false
+	}
+	password, ok, err := activeVault.Password(connectionName)
+	if err != nil {
+		return "", false
+	}
+	return password, ok
+}
+
+func getVaultPath() (string, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "vault.json"), nil
+}
+
+// VaultExists reports whether the user has created a vault
+func VaultExists() bool {
+	path, err := getVaultPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// CreateVault creates an empty vault protected by passphrase and returns it unlocked
+func CreateVault(passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, errors.New("vault passphrase cannot be empty")
+	}
+	path, err := getVaultPath()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Vault{path: path, file: vaultFile{Version: 1, Entries: make(map[string]string)}}
+	err = withFileLock(path, func() error {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("a vault already exists at %s", path)
+		}
+		if err := v.rekey(passphrase); err != nil {
+			return err
+		}
+		return v.write()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// OpenVault loads the vault file. The returned vault is locked.
+func OpenVault() (*Vault, error) {
+	path, err := getVaultPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := readVaultFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{path: path, file: file}, nil
+}
+
+func readVaultFile(path string) (vaultFile, error) {
+	var file vaultFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("could not parse vault %s: %w", path, err)
+	}
+	if file.KDF.Algorithm != "argon2id" {
+		return file, fmt.Errorf("unsupported vault key derivation '%s'", file.KDF.Algorithm)
+	}
+	if file.Entries == nil {
+		file.Entries = make(map[string]string)
+	}
+	return file, nil
+}
+
+// Locked reports whether the vault still needs its passphrase
+func (v *Vault) Locked() bool {
+	return v.key == nil
+}
+
+// Unlock derives the key from passphrase and checks it against the vault
+func (v *Vault) Unlock(passphrase string) error {
+	salt, err := base64.StdEncoding.DecodeString(v.file.KDF.Salt)
+	if err != nil {
+		return fmt.Errorf("corrupt vault salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(passphrase), salt, v.file.KDF.Time, v.file.KDF.Memory, v.file.KDF.Threads, vaultKeyLength)
+	if !v.checkKey(key) {
+		return ErrWrongPassphrase
+	}
+	v.key = key
+	return nil
+}
+
+// Lock forgets the key held in memory
+func (v *Vault) Lock() {
+	v.key = nil
+}
+
+// Password returns the password stored for name
+func (v *Vault) Password(name string) (string, bool, error) {
+	if v.Locked() {
+		return "", false, ErrVaultLocked
+	}
+	sealed, exists := v.file.Entries[name]
+	if !exists {
+		return "", false, nil
+	}
+	plaintext, err := open(v.key, sealed, name)
+	if err != nil {
+		return "", false, fmt.Errorf("could not decrypt vault entry '%s': %w", name, err)
+	}
+	return string(plaintext), true, nil
+}
+
+// SetPassword stores the password for name and writes the vault
+func (v *Vault) SetPassword(name, password string) error {
+	if v.Locked() {
+		return ErrVaultLocked
+	}
+	sealed, err := seal(v.key, []byte(password), name)
+	if err != nil {
+		return err
+	}
+	return v.update(func() error {
+		v.file.Entries[name] = sealed
+		return nil
+	})
+}
+
+// DeletePassword removes the entry for name and writes the vault
+func (v *Vault) DeletePassword(name string) error {
+	return v.update(func() error {
+		delete(v.file.Entries, name)
+		return nil
+	})
+}
+
+// ChangePassphrase re-encrypts every entry under a key derived from the new
+// passphrase with a fresh salt
+func (v *Vault) ChangePassphrase(newPassphrase string) error {
+	if v.Locked() {
+		return ErrVaultLocked
+	}
+	if newPassphrase == "" {
+		return errors.New("vault passphrase cannot be empty")
+	}
+
+	return v.update(func() error {
+		passwords := make(map[string][]byte, len(v.file.Entries))
+		for name, sealed := range v.file.Entries {
+			plaintext, err := open(v.key, sealed, name)
+			if err != nil {
+				return fmt.Errorf("could not decrypt vault entry '%s': %w", name, err)
+			}
+			passwords[name] = plaintext
+		}
+
+		if err := v.rekey(newPassphrase); err != nil {
+			return err
+		}
+		for name, plaintext := range passwords {
+			sealed, err := seal(v.key, plaintext, name)
+			if err != nil {
+				return err
+			}
+			v.file.Entries[name] = sealed
+		}
+		return nil
+	})
+}
+
+// rekey derives a new key with a fresh salt and updates the check value
+func (v *Vault) rekey(passphrase string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	v.file.KDF = vaultKDF{
+		Algorithm: "argon2id",
+		Salt:      base64.StdEncoding.EncodeToString(salt),
+		Time:      vaultKDFTime,
+		Memory:    vaultKDFMemory,
+		Threads:   vaultKDFThreads,
+	}
+	v.key = argon2.IDKey([]byte(passphrase), salt, vaultKDFTime, vaultKDFMemory, vaultKDFThreads, vaultKeyLength)
+
+	check, err := seal(v.key, []byte(vaultCheckValue), "")
+	if err != nil {
+		return err
+	}
+	v.file.Check = check
+	return nil
+}
+
+func (v *Vault) checkKey(key []byte) bool {
+	plaintext, err := open(key, v.file.Check, "")
+	return err == nil && string(plaintext) == vaultCheckValue
+}
+
+// update reloads the vault file, applies change to it and writes it back,
+// all under the lock shared with other maxim processes, so entries they
+// saved in the meantime are kept. When another process changed the
+// passphrase, the key no longer opens the file and the vault is locked.
+func (v *Vault) update(change func() error) error {
+	return withFileLock(v.path, func() error {
+		file, err := readVaultFile(v.path)
+		if err != nil {
+			return err
+		}
+		v.file = file
+		if !v.Locked() && !v.checkKey(v.key) {
+			v.Lock()
+			return fmt.Errorf("%w: its passphrase was changed by another maxim process", ErrVaultLocked)
+		}
+		if err := change(); err != nil {
+			return err
+		}
+		return v.write()
+	})
+}
+
+// write replaces the vault file with the copy in memory, holding the lock
+func (v *Vault) write() error {
+	data, err := json.MarshalIndent(v.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(v.path, data, 0600)
+}
+
+// seal encrypts plaintext with a random nonce, binding it to name as
+// additional data so entries cannot be swapped between connections
+func seal(key, plaintext []byte, name string) (string, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(name))), nil
+}
+
+func open(key []byte, sealed, name string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+}
+
+// getSessionKeyDirs returns the directories an unlocked vault key is kept
+// in between maxim runs, outermost first, the key going in the last one.
+// XDG_RUNTIME_DIR is private to the user and cleared at logout; elsewhere
+// a per-user directory in the temp dir is used, which anyone could have
+// created first, so every directory returned is checked before use.
+func getSessionKeyDirs() []string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return []string{filepath.Join(dir, "maxim")}
+	}
+	base := filepath.Join(os.TempDir(), "maxim-"+strconv.Itoa(os.Getuid()))
+	return []string{base, filepath.Join(base, "maxim")}
+}
+
+func getSessionKeyPath() string {
+	dirs := getSessionKeyDirs()
+	return filepath.Join(dirs[len(dirs)-1], "vault.key")
+}
+
+// checkSessionKeyDirs makes sure the session key directories are real
+// directories owned by the user and closed to everyone else, creating the
+// missing ones when create is set
+func checkSessionKeyDirs(create bool) error {
+	for _, dir := range getSessionKeyDirs() {
+		if create {
+			if err := os.Mkdir(dir, 0700); err != nil && !errors.Is(err, os.ErrExist) {
+				return err
+			}
+		}
+		info, err := os.Lstat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory, refusing to keep the vault key there", dir)
+		}
+		if err := checkPrivateDir(dir, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveSession keeps the unlocked key for later maxim runs in this login
+// session. It refuses to when the session key directory could be read or
+// replaced by another user.
+func (v *Vault) SaveSession() error {
+	if v.Locked() {
+		return ErrVaultLocked
+	}
+	if err := checkSessionKeyDirs(true); err != nil {
+		return err
+	}
+
+	// The key is written to a new file, never through one found in place
+	path := getSessionKeyPath()
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|noFollow, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(v.key)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// UnlockFromSession unlocks the vault with the key saved by SaveSession. It
+// returns false when there is no session, the passphrase has changed or the
+// session key directory is not private.
+func (v *Vault) UnlockFromSession() bool {
+	if err := checkSessionKeyDirs(false); err != nil {
+		return false
+	}
+	f, err := os.OpenFile(getSessionKeyPath(), os.O_RDONLY|noFollow, 0)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return false
+	}
+	key, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil || !v.checkKey(key) {
+		return false
+	}
+	v.key = key
+	return true
+}
+
+// LockSession removes the saved session key so the next run asks for the passphrase
+func LockSession() error {
+	err := os.Remove(getSessionKeyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
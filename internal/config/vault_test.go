@@ -0,0 +1,227 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useTestConfigDir points the config directory and the session key
+// directory at temporary directories and makes key derivation cheap
+func useTestConfigDir(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	kdfTime, kdfMemory, kdfThreads := vaultKDFTime, vaultKDFMemory, vaultKDFThreads
+	vaultKDFTime, vaultKDFMemory, vaultKDFThreads = 1, 64, 1
+	t.Cleanup(func() {
+		vaultKDFTime, vaultKDFMemory, vaultKDFThreads = kdfTime, kdfMemory, kdfThreads
+	})
+}
+
+// openTestVault opens the vault file again, as another maxim process would
+func openTestVault(t *testing.T, passphrase string) *Vault {
+	t.Helper()
+	v, err := OpenVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Unlock(passphrase); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func checkPassword(t *testing.T, v *Vault, name, want string) {
+	t.Helper()
+	got, ok, err := v.Password(name)
+	if err != nil || !ok || got != want {
+		t.Errorf("Password(%q) = %q, %v, %v, want %q", name, got, ok, err, want)
+	}
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	useTestConfigDir(t)
+	v, err := CreateVault("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SetPassword("prod", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	checkPassword(t, v, "prod", "s3cret")
+
+	path, err := getVaultPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Error("the vault file holds the password in clear")
+	}
+	if _, err := CreateVault("other"); err == nil {
+		t.Error("CreateVault() replaced an existing vault")
+	}
+
+	reopened, err := OpenVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Locked() {
+		t.Fatal("an opened vault is unlocked before its passphrase is given")
+	}
+	if _, _, err := reopened.Password("prod"); !errors.Is(err, ErrVaultLocked) {
+		t.Errorf("Password() on a locked vault = %v, want ErrVaultLocked", err)
+	}
+	if err := reopened.Unlock("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	checkPassword(t, reopened, "prod", "s3cret")
+	if _, ok, err := reopened.Password("staging"); ok || err != nil {
+		t.Errorf("Password() of a missing entry = %v, %v", ok, err)
+	}
+
+	// Entries are bound to their connection name
+	if _, err := open(reopened.key, reopened.file.Entries["prod"], "staging"); err == nil {
+		t.Error("an entry opened under another connection name")
+	}
+
+	if err := reopened.DeletePassword("prod"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := openTestVault(t, "correct horse").Password("prod"); ok {
+		t.Error("a deleted entry is still in the vault")
+	}
+}
+
+func TestVaultWrongPassphrase(t *testing.T) {
+	useTestConfigDir(t)
+	if _, err := CreateVault("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := OpenVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Unlock("battery staple"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Unlock() with a wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+	if !v.Locked() {
+		t.Error("a wrong passphrase unlocked the vault")
+	}
+	if err := v.SetPassword("prod", "s3cret"); !errors.Is(err, ErrVaultLocked) {
+		t.Errorf("SetPassword() on a locked vault = %v, want ErrVaultLocked", err)
+	}
+}
+
+func TestVaultChangePassphrase(t *testing.T) {
+	useTestConfigDir(t)
+	v, err := CreateVault("old passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, password := range map[string]string{"prod": "p1", "staging": "p2", AdminVaultEntry: "p3"} {
+		if err := v.SetPassword(name, password); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := v.file
+	other := openTestVault(t, "old passphrase")
+
+	if err := v.ChangePassphrase("new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if v.file.KDF.Salt == before.KDF.Salt {
+		t.Error("the salt was kept")
+	}
+	for name, sealed := range before.Entries {
+		if v.file.Entries[name] == sealed {
+			t.Errorf("entry %q was not encrypted again", name)
+		}
+	}
+
+	reopened, err := OpenVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Unlock("old passphrase"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Unlock() with the old passphrase = %v, want ErrWrongPassphrase", err)
+	}
+	if err := reopened.Unlock("new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	checkPassword(t, reopened, "prod", "p1")
+	checkPassword(t, reopened, "staging", "p2")
+	checkPassword(t, reopened, AdminVaultEntry, "p3")
+
+	// A process still holding the old key must not write entries the new
+	// one cannot read
+	if err := other.SetPassword("dev", "p4"); !errors.Is(err, ErrVaultLocked) {
+		t.Errorf("SetPassword() with the old key = %v, want ErrVaultLocked", err)
+	}
+	if !other.Locked() {
+		t.Error("the vault holding the old key was not locked")
+	}
+	if _, ok, _ := openTestVault(t, "new passphrase").Password("dev"); ok {
+		t.Error("an entry sealed with the old key was written")
+	}
+}
+
+func TestVaultConcurrentUpdates(t *testing.T) {
+	useTestConfigDir(t)
+	if _, err := CreateVault("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each vault stands for a maxim process that loaded the file before
+	// the others wrote to it
+	a := openTestVault(t, "correct horse")
+	b := openTestVault(t, "correct horse")
+	if err := a.SetPassword("prod", "p1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetPassword("staging", "p2"); err != nil {
+		t.Fatal(err)
+	}
+	v := openTestVault(t, "correct horse")
+	checkPassword(t, v, "prod", "p1")
+	checkPassword(t, v, "staging", "p2")
+
+	const writers = 4
+	vaults := make([]*Vault, writers)
+	for i := range vaults {
+		vaults[i] = openTestVault(t, "correct horse")
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i, v := range vaults {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 10 {
+				if err := v.SetPassword(fmt.Sprintf("conn-%d-%d", i, j), "pw"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	v = openTestVault(t, "correct horse")
+	if got, want := len(v.file.Entries), 2+writers*10; got != want {
+		t.Errorf("the vault holds %d entries after concurrent updates, want %d", got, want)
+	}
+}
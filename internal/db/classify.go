@@ -0,0 +1,361 @@
+package db
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// StatementClass describes what a statement may do, as far as can be told
+// from its text
+type StatementClass struct {
+	// Write is set for statements that may change data, schema or session
+	// settings guarding them. Statements that are not recognized count as
+	// writes.
+	Write bool
+
+	// Destructive names a statement that needs confirmation before it runs,
+	// such as "DROP TABLE" or "DELETE without WHERE", and is empty otherwise
+	Destructive string
+	// Target is the object a destructive statement acts on, as written, or
+	// empty when it could not be found
+	Target string
+}
+
+// sqlToken is a word, quoted name or punctuation character of a statement.
+// Strings and comments are dropped.
+type sqlToken struct {
+	text string
+	// word is the upper-cased text of an unquoted word, empty otherwise
+	word string
+	// depth is the parenthesis nesting level the token is at
+	depth int
+	// pos is the byte offset of the token in the statement
+	pos int
+}
+
+// literalRange is a string or comment dropped by scanTokens. open is set
+// when it runs up to and including end, as a line comment or a string left
+// unterminated does.
+type literalRange struct {
+	start, end int
+	open       bool
+}
+
+// readOnlyVerbs start statements that only read, unless they also touch
+// the read-only setting itself
+var readOnlyVerbs = map[string]bool{
+	"SELECT": true, "SHOW": true, "VALUES": true, "TABLE": true, "DESCRIBE": true, "DESC": true,
+	"USE": true, "SET": true, "RESET": true, "FETCH": true, "LISTEN": true, "UNLISTEN": true,
+	"BEGIN": true, "START": true, "COMMIT": true, "END": true, "ROLLBACK": true, "ABORT": true,
+	"SAVEPOINT": true, "RELEASE": true,
+}
+
+// ClassifyStatement tells whether a statement may write and whether it is
+// destructive: DROP and TRUNCATE statements, and UPDATE or DELETE without a
+// WHERE clause, including those inside a WITH query
+func ClassifyStatement(statement string, syntax ScriptSyntax) StatementClass {
+	tokens := tokenize(statement, syntax)
+	if len(tokens) == 0 {
+		return StatementClass{}
+	}
+
+	class := StatementClass{Write: isWrite(tokens)}
+	if tokens[0].word == "EXPLAIN" {
+		// EXPLAIN ANALYZE runs the statement it explains
+		if start, analyze := explained(tokens); start > 0 && analyze {
+			inner := ClassifyStatement(statement[tokens[start].pos:], syntax)
+			class.Destructive, class.Target = inner.Destructive, inner.Target
+		}
+		return class
+	}
+
+	with := tokens[0].word == "WITH"
+	for i, token := range tokens {
+		// Only look at words that start a statement or a parenthesized
+		// query, or follow the queries of a WITH, so FOR UPDATE and ON
+		// DELETE CASCADE are not mistaken for statements
+		if i > 0 && tokens[i-1].text != "(" && !(with && token.depth == 0 && tokens[i-1].text == ")") {
+			continue
+		}
+
+		switch token.word {
+		case "DROP":
+			class.Destructive = "DROP"
+			if i+1 < len(tokens) && tokens[i+1].word != "" {
+				class.Destructive = "DROP " + tokens[i+1].word
+			}
+			if i+2 <= len(tokens) {
+				class.Target = objectName(tokens[i+2:], "IF", "EXISTS", "CONCURRENTLY", "VIEW")
+			}
+		case "TRUNCATE":
+			class.Destructive = "TRUNCATE"
+			class.Target = objectName(tokens[i+1:], "TABLE", "ONLY")
+		case "DELETE":
+			if !hasWhere(tokens[i:]) {
+				class.Destructive = "DELETE without WHERE"
+				if from := indexWord(tokens[i:], "FROM"); from >= 0 {
+					class.Target = objectName(tokens[i+from+1:], "ONLY")
+				}
+			}
+		case "UPDATE":
+			if !hasWhere(tokens[i:]) {
+				class.Destructive = "UPDATE without WHERE"
+				class.Target = objectName(tokens[i+1:], "ONLY", "LOW_PRIORITY", "IGNORE")
+			}
+		}
+		if class.Destructive != "" {
+			return class
+		}
+	}
+	return class
+}
+
+// isWrite reports whether a statement may write
+func isWrite(tokens []sqlToken) bool {
+	verb := tokens[0].word
+	switch {
+	case touchesReadOnly(tokens):
+		return true
+	case verb == "EXPLAIN":
+		// EXPLAIN ANALYZE runs the statement it explains
+		start, analyze := explained(tokens)
+		switch {
+		case !analyze:
+			return false
+		case start > 0:
+			return isWrite(tokens[start:])
+		}
+		return true
+	case verb == "WITH":
+		// Data-modifying WITH queries write, at any depth
+		for i, token := range tokens {
+			if token.depth == 0 || (i > 0 && tokens[i-1].text == "(") {
+				switch token.word {
+				case "INSERT", "UPDATE", "DELETE", "MERGE":
+					return true
+				}
+			}
+		}
+		return hasTopLevelWord(tokens, "INTO")
+	case verb == "SELECT":
+		// SELECT INTO creates a table in PostgreSQL and writes a file in MySQL
+		return hasTopLevelWord(tokens, "INTO")
+	case verb == "PRAGMA":
+		// Pragmas that set a value write
+		for _, token := range tokens {
+			if token.text == "=" {
+				return true
+			}
+		}
+		return false
+	}
+	return !readOnlyVerbs[verb]
+}
+
+// touchesReadOnly reports whether a statement changes the read-only setting
+// of the session or transaction, such as SET default_transaction_read_only
+// or BEGIN READ WRITE
+func touchesReadOnly(tokens []sqlToken) bool {
+	for i, token := range tokens {
+		if strings.Contains(token.word, "READ_ONLY") || token.word == "QUERY_ONLY" {
+			return true
+		}
+		if token.word == "READ" && i+1 < len(tokens) && tokens[i+1].word == "WRITE" {
+			return true
+		}
+	}
+	return false
+}
+
+// explained returns the index of the statement an EXPLAIN explains, or -1
+// when it cannot be found, and whether the options before it ask for
+// ANALYZE, which runs the statement
+func explained(tokens []sqlToken) (int, bool) {
+	start := -1
+	for i, token := range tokens {
+		if i > 0 && token.depth == 0 && startsQuery(token.word) {
+			start = i
+			break
+		}
+	}
+	options := tokens
+	if start >= 0 {
+		options = tokens[:start]
+	}
+	return start, indexWord(options, "ANALYZE") >= 0
+}
+
+func startsQuery(word string) bool {
+	switch word {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "MERGE", "WITH", "VALUES", "TABLE", "CREATE", "EXECUTE":
+		return true
+	}
+	return false
+}
+
+// hasWhere reports whether the statement starting at tokens[0] has a WHERE
+// clause at its own depth, before a closing parenthesis ends it
+func hasWhere(tokens []sqlToken) bool {
+	depth := tokens[0].depth
+	for _, token := range tokens[1:] {
+		if token.depth < depth {
+			return false
+		}
+		if token.depth == depth && token.word == "WHERE" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTopLevelWord(tokens []sqlToken, word string) bool {
+	for _, token := range tokens {
+		if token.depth == 0 && token.word == word {
+			return true
+		}
+	}
+	return false
+}
+
+// indexWord returns the index of the first token that is word, or -1
+func indexWord(tokens []sqlToken, word string) int {
+	for i, token := range tokens {
+		if token.word == word {
+			return i
+		}
+	}
+	return -1
+}
+
+// objectName returns the possibly qualified name at the start of tokens,
+// after skipping the given keywords
+func objectName(tokens []sqlToken, skip ...string) string {
+	i := 0
+	for i < len(tokens) && tokens[i].word != "" && containsString(skip, tokens[i].word) {
+		i++
+	}
+
+	var name strings.Builder
+	for ; i < len(tokens); i++ {
+		text := tokens[i].text
+		wantName := name.Len() == 0 || strings.HasSuffix(name.String(), ".")
+		switch {
+		case wantName && text != "." && !isPunctuation(text):
+			name.WriteString(text)
+		case !wantName && text == ".":
+			name.WriteString(text)
+		default:
+			return name.String()
+		}
+	}
+	return name.String()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func isPunctuation(text string) bool {
+	r, width := utf8.DecodeRuneInString(text)
+	return text != "" && width == len(text) && !IsIdentifierRune(r) && r != '"' && r != '`'
+}
+
+// tokenize splits a statement into words, quoted names and punctuation,
+// following the quoting and comment rules of syntax
+func tokenize(statement string, syntax ScriptSyntax) []sqlToken {
+	tokens, _ := scanTokens(statement, syntax)
+	return tokens
+}
+
+// scanTokens is tokenize, also returning where the strings and comments it
+// dropped are
+func scanTokens(statement string, syntax ScriptSyntax) ([]sqlToken, []literalRange) {
+	var tokens []sqlToken
+	var literals []literalRange
+	depth := 0
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		next := byte(0)
+		if i+1 < len(statement) {
+			next = statement[i+1]
+		}
+
+		switch {
+		case isSpace(c):
+			i++
+		case c == '\'':
+			escapes := syntax.BackslashEscapes || (syntax.EscapeStrings && isEscapeStringPrefix(statement, i))
+			end := skipQuoted(statement, i, '\'', escapes)
+			literals = append(literals, stringRange(statement, i, end))
+			i = end
+		case c == '"' && syntax.BackslashEscapes:
+			// A string in MySQL
+			end := skipQuoted(statement, i, '"', true)
+			literals = append(literals, stringRange(statement, i, end))
+			i = end
+		case c == '"' || c == '`':
+			end := skipQuoted(statement, i, c, false)
+			tokens = append(tokens, sqlToken{text: statement[i:end], depth: depth, pos: i})
+			i = end
+		case c == '-' && next == '-', c == '#' && syntax.HashComments:
+			end := skipLine(statement, i)
+			literals = append(literals, literalRange{start: i, end: end, open: true})
+			i = end
+		case c == '/' && next == '*':
+			end := skipBlockComment(statement, i, syntax.NestedComments)
+			literals = append(literals, literalRange{start: i, end: end, open: !strings.HasSuffix(statement[:end], "*/") || end-i < 4})
+			i = end
+		case c == '$' && syntax.DollarQuotes:
+			if tag, ok := dollarTag(statement, i); ok {
+				start := i
+				end := strings.Index(statement[i+len(tag):], tag)
+				if end < 0 {
+					i = len(statement)
+				} else {
+					i += len(tag) + end + len(tag)
+				}
+				literals = append(literals, literalRange{start: start, end: i, open: end < 0})
+				continue
+			}
+			i = scanWord(statement, i, depth, &tokens)
+		case identWidth(statement, i) > 0:
+			i = scanWord(statement, i, depth, &tokens)
+		case c == '(':
+			tokens = append(tokens, sqlToken{text: "(", depth: depth, pos: i})
+			depth++
+			i++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+			tokens = append(tokens, sqlToken{text: ")", depth: depth, pos: i})
+			i++
+		default:
+			_, width := utf8.DecodeRuneInString(statement[i:])
+			tokens = append(tokens, sqlToken{text: statement[i : i+width], depth: depth, pos: i})
+			i += width
+		}
+	}
+	return tokens, literals
+}
+
+// stringRange describes the quoted string from start to end, which is open
+// when its closing quote is missing
+func stringRange(s string, start, end int) literalRange {
+	closed := end-start >= 2 && s[end-1] == s[start]
+	return literalRange{start: start, end: end, open: !closed}
+}
+
+// scanWord appends the word starting at i and returns the index after it
+func scanWord(s string, i, depth int, tokens *[]sqlToken) int {
+	start := i
+	i = skipIdent(s, i)
+	text := s[start:i]
+	*tokens = append(*tokens, sqlToken{text: text, word: strings.ToUpper(text), depth: depth, pos: start})
+	return i
+}
@@ -0,0 +1,44 @@
+package db
+
+import "testing"
+
+func TestClassifyStatement(t *testing.T) {
+	syntax := postgresDialect{}.ScriptSyntax()
+	tests := []struct {
+		statement string
+		want      StatementClass
+	}{
+		{"SELECT * FROM orders", StatementClass{}},
+		{"DELETE FROM orders WHERE id = 1", StatementClass{Write: true}},
+		{"DELETE FROM orders", StatementClass{Write: true, Destructive: "DELETE without WHERE", Target: "orders"}},
+		{"UPDATE orders SET paid = true", StatementClass{Write: true, Destructive: "UPDATE without WHERE", Target: "orders"}},
+		{"DROP TABLE IF EXISTS public.orders", StatementClass{Write: true, Destructive: "DROP TABLE", Target: "public.orders"}},
+		{"TRUNCATE TABLE orders", StatementClass{Write: true, Destructive: "TRUNCATE", Target: "orders"}},
+		{"SELECT * FROM orders FOR UPDATE", StatementClass{}},
+
+		// Partial input
+		{"DROP", StatementClass{Write: true, Destructive: "DROP"}},
+		{"(DROP", StatementClass{Write: true, Destructive: "DROP"}},
+		{"DROP TABLE", StatementClass{Write: true, Destructive: "DROP TABLE"}},
+
+		// WITH queries
+		{"WITH x AS (SELECT 1) DELETE FROM orders", StatementClass{Write: true, Destructive: "DELETE without WHERE", Target: "orders"}},
+		{"WITH x AS (SELECT 1), y AS (SELECT 2) UPDATE orders SET paid = true", StatementClass{Write: true, Destructive: "UPDATE without WHERE", Target: "orders"}},
+		{"WITH x AS (SELECT 1) DELETE FROM orders WHERE id IN (SELECT * FROM x)", StatementClass{Write: true}},
+		{"WITH gone AS (DELETE FROM orders RETURNING id) SELECT * FROM gone", StatementClass{Write: true, Destructive: "DELETE without WHERE", Target: "orders"}},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", StatementClass{}},
+
+		// EXPLAIN runs the statement only with ANALYZE
+		{"EXPLAIN DELETE FROM orders", StatementClass{}},
+		{"EXPLAIN ANALYZE DELETE FROM orders", StatementClass{Write: true, Destructive: "DELETE without WHERE", Target: "orders"}},
+		{"EXPLAIN (ANALYZE, BUFFERS) UPDATE orders SET paid = true", StatementClass{Write: true, Destructive: "UPDATE without WHERE", Target: "orders"}},
+		{"EXPLAIN ANALYZE DELETE FROM orders WHERE id = 1", StatementClass{Write: true}},
+		{"EXPLAIN ANALYZE SELECT * FROM orders", StatementClass{}},
+	}
+
+	for _, test := range tests {
+		if got := ClassifyStatement(test.statement, syntax); got != test.want {
+			t.Errorf("ClassifyStatement(%q) = %+v, want %+v", test.statement, got, test.want)
+		}
+	}
+}
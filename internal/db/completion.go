@@ -0,0 +1,493 @@
+package db
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CompletionKind tells what a completion names
+type CompletionKind int
+
+const (
+	CompletionKeyword CompletionKind = iota
+	CompletionTable
+	CompletionColumn
+	CompletionFunction
+	CompletionAlias
+	CompletionSchema
+	// CompletionJoin is a table and the ON clause joining it to a table in
+	// scope through a foreign key
+	CompletionJoin
+)
+
+func (k CompletionKind) String() string {
+	switch k {
+	case CompletionTable:
+		return "table"
+	case CompletionColumn:
+		return "column"
+	case CompletionFunction:
+		return "function"
+	case CompletionAlias:
+		return "alias"
+	case CompletionSchema:
+		return "schema"
+	case CompletionJoin:
+		return "join"
+	}
+	return "keyword"
+}
+
+// Completion is a suggestion for the word at the cursor
+type Completion struct {
+	// Text replaces the word, quoted when the name needs it
+	Text string
+	Kind CompletionKind
+	// Detail is the table of a column or alias, the schema of a table
+	// outside the search path, the foreign key of a join, or empty
+	Detail string
+}
+
+// maxCompletions caps the number of suggestions Complete returns
+const maxCompletions = 50
+
+// statementVerbs are suggested at the start of a statement
+var statementVerbs = []string{
+	"SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "CREATE", "ALTER", "DROP", "TRUNCATE",
+	"EXPLAIN", "BEGIN", "COMMIT", "ROLLBACK", "GRANT", "REVOKE",
+}
+
+// Clause is the part of a statement the cursor is in, which decides what
+// can be completed there
+type Clause int
+
+const (
+	// ClauseStart is the start of a statement, where a verb is expected
+	ClauseStart Clause = iota
+	// ClauseSelect is the SELECT list
+	ClauseSelect
+	// ClauseTable follows FROM, JOIN, UPDATE or INTO, where a table name
+	// is expected
+	ClauseTable
+	// ClauseAfterTable follows a table name, where an alias or the next
+	// clause is expected
+	ClauseAfterTable
+	// ClauseAlias follows AS, where a new name is typed
+	ClauseAlias
+	// ClauseCondition is a WHERE, ON or HAVING condition
+	ClauseCondition
+	ClauseGroupBy
+	ClauseOrderBy
+	// ClauseSet is the SET list of an UPDATE
+	ClauseSet
+	// ClauseInsertColumns is the column list of INSERT INTO table (...)
+	ClauseInsertColumns
+	ClauseValues
+	ClauseReturning
+	// ClauseOther is anywhere else
+	ClauseOther
+)
+
+// TableRef is a table named in a statement, as written
+type TableRef struct {
+	Schema string
+	Name   string
+	// Alias is empty when the table has none. A subquery in FROM has an
+	// alias but no name.
+	Alias string
+
+	// keyword is the word that introduced the table, such as FROM or UPDATE
+	keyword string
+}
+
+// CompletionContext describes what surrounds the cursor in a query
+type CompletionContext struct {
+	// Word is the part of the name or keyword typed before the cursor,
+	// without any opening quote
+	Word string
+	// Quoted is set when Word follows an opening quote
+	Quoted bool
+	// Qualifier holds the names before Word, such as [o] in o.id or
+	// [public orders] in public.orders.id
+	Qualifier []string
+	Clause    Clause
+	// Join is set when the table expected in ClauseTable follows JOIN
+	Join bool
+	// Tables are the tables the statement at the cursor refers to, in
+	// any of its subqueries
+	Tables []TableRef
+	// Target is the table of an INSERT column list, an UPDATE SET list or
+	// a RETURNING clause, when known
+	Target *TableRef
+	// CTEs are the names of the WITH queries of the statement
+	CTEs []string
+	// InLiteral is set when the cursor is inside a string or comment
+	InLiteral bool
+}
+
+// notAliases are words that can follow a table name in FROM without being
+// its alias
+var notAliases = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true,
+	"NATURAL": true, "OUTER": true, "STRAIGHT_JOIN": true, "ON": true, "USING": true, "GROUP": true,
+	"ORDER": true, "HAVING": true, "LIMIT": true, "OFFSET": true, "UNION": true, "INTERSECT": true,
+	"EXCEPT": true, "SET": true, "VALUES": true, "SELECT": true, "RETURNING": true, "WINDOW": true,
+	"FOR": true, "FETCH": true, "DEFAULT": true, "AS": true, "LATERAL": true, "TABLESAMPLE": true,
+	"WITH": true, "OVERRIDING": true, "ON_CONFLICT": true, "PARTITION": true,
+}
+
+// AnalyzeCompletion finds the word at a byte offset in a script and the
+// context it is in: the clause, the tables of its statement and their
+// aliases. Names may hold any Unicode letters, and quoted names are
+// unquoted.
+func AnalyzeCompletion(query string, cursor int, syntax ScriptSyntax) CompletionContext {
+	cursor = max(0, min(cursor, len(query)))
+	tokens, literals := scanTokens(query, syntax)
+
+	var ctx CompletionContext
+	for _, literal := range literals {
+		if literal.start < cursor && (cursor < literal.end || (cursor == literal.end && literal.open)) {
+			ctx.InLiteral = true
+			return ctx
+		}
+	}
+
+	// Keep the statement the cursor is in
+	lo, hi := 0, len(tokens)
+	for i, token := range tokens {
+		if token.text != ";" {
+			continue
+		}
+		if token.pos < cursor {
+			lo = i + 1
+		} else {
+			hi = i
+			break
+		}
+	}
+	statement := tokens[lo:hi]
+
+	// Find the word being typed and the tokens before it
+	before, rest := statement, []sqlToken(nil)
+	wordStart := cursor
+	for i, token := range statement {
+		if token.pos >= cursor {
+			before, rest = statement[:i], statement[i:]
+			break
+		}
+		if end := token.pos + len(token.text); cursor <= end && isNameToken(token) {
+			ctx.Word = unquoteName(query[token.pos:cursor])
+			ctx.Quoted = isQuote(token.text)
+			before, rest = statement[:i], statement[i+1:]
+			wordStart = token.pos
+			break
+		}
+	}
+
+	// Collect the qualifier, o in o.id, written without spaces
+	end := len(before)
+	for end >= 2 && before[end-1].text == "." && before[end-1].pos+1 == wordStart && isNameToken(before[end-2]) &&
+		before[end-2].pos+len(before[end-2].text) == before[end-1].pos {
+		ctx.Qualifier = append([]string{unquoteName(before[end-2].text)}, ctx.Qualifier...)
+		wordStart = before[end-2].pos
+		end -= 2
+	}
+	before = before[:end]
+
+	// The tables are read from the whole statement, without the word being
+	// typed, which is not a name yet, and without the subqueries the cursor
+	// is not in
+	scope := visibleTokens(append(append([]sqlToken{}, before...), rest...), cursor)
+	ctx.Tables = tableRefs(scope)
+	ctx.CTEs = cteNames(scope)
+	ctx.Clause, ctx.Target = clauseAt(before, ctx.Tables)
+	ctx.Join = ctx.Clause == ClauseTable && len(before) > 0 && before[len(before)-1].word == "JOIN"
+	return ctx
+}
+
+// clauseAt finds the clause the end of tokens is in by walking back to the
+// nearest clause keyword at the same depth. Inside parentheses with no
+// clause of their own, such as function arguments or IN lists, the clause
+// around the parentheses applies.
+func clauseAt(tokens []sqlToken, tables []TableRef) (Clause, *TableRef) {
+	if len(tokens) == 0 {
+		return ClauseStart, nil
+	}
+
+	last := tokens[len(tokens)-1]
+	depth := last.depth
+	if last.text == "(" {
+		depth++
+	}
+
+	for i := len(tokens) - 1; i >= 0; i-- {
+		token := tokens[i]
+		if token.depth > depth {
+			continue
+		}
+		if token.depth < depth {
+			// token opens the parentheses the cursor is in
+			if table, ok := insertTarget(tokens[:i]); ok {
+				return ClauseInsertColumns, &table
+			}
+			depth = token.depth
+			continue
+		}
+
+		switch token.word {
+		case "SELECT":
+			return ClauseSelect, nil
+		case "FROM", "JOIN", "UPDATE", "INTO":
+			return tableClause(tokens[i:], depth), nil
+		case "ON", "WHERE", "HAVING":
+			return ClauseCondition, nil
+		case "BY":
+			if i > 0 && tokens[i-1].word == "ORDER" {
+				return ClauseOrderBy, nil
+			}
+			return ClauseGroupBy, nil
+		case "SET":
+			return ClauseSet, targetTable(tables, "UPDATE")
+		case "VALUES":
+			return ClauseValues, nil
+		case "RETURNING":
+			return ClauseReturning, targetTable(tables, "UPDATE", "INTO", "FROM")
+		case "LIMIT", "OFFSET":
+			return ClauseOther, nil
+		}
+	}
+	return ClauseOther, nil
+}
+
+// tableClause tells whether a table name or what follows one is expected
+// after the keyword at tokens[0]
+func tableClause(tokens []sqlToken, depth int) Clause {
+	last := tokens[len(tokens)-1]
+	switch {
+	case last.depth > depth || last.text == "(":
+		return ClauseOther
+	case len(tokens) == 1, last.text == ",", last.word == "ONLY", last.word == "LATERAL":
+		return ClauseTable
+	case last.word == "AS":
+		return ClauseAlias
+	}
+	return ClauseAfterTable
+}
+
+// insertTarget returns the table of INSERT INTO table when tokens end with
+// it
+func insertTarget(tokens []sqlToken) (TableRef, bool) {
+	end := len(tokens)
+	start := end - 1
+	if start < 1 || !isNameToken(tokens[start]) {
+		return TableRef{}, false
+	}
+	for start >= 2 && tokens[start-1].text == "." && isNameToken(tokens[start-2]) {
+		start -= 2
+	}
+	if start == 0 || tokens[start-1].word != "INTO" {
+		return TableRef{}, false
+	}
+	ref, next := readTableRef(tokens, start, "INTO")
+	return ref, ref.Name != "" && next == end
+}
+
+// targetTable returns the first table introduced by one of the keywords
+func targetTable(tables []TableRef, keywords ...string) *TableRef {
+	for _, keyword := range keywords {
+		for i := range tables {
+			if tables[i].keyword == keyword && tables[i].Name != "" {
+				return &tables[i]
+			}
+		}
+	}
+	return nil
+}
+
+// tableRefs returns the tables named after FROM, JOIN, UPDATE and INTO,
+// including every table of a FROM list
+func tableRefs(tokens []sqlToken) []TableRef {
+	var refs []TableRef
+	for i, token := range tokens {
+		switch token.word {
+		case "FROM", "JOIN", "UPDATE", "INTO":
+		default:
+			continue
+		}
+
+		next := i + 1
+		for next < len(tokens) {
+			ref, end := readTableRef(tokens, next, token.word)
+			if ref.Name != "" || ref.Alias != "" {
+				refs = append(refs, ref)
+			}
+			if token.word != "FROM" || end >= len(tokens) || tokens[end].text != "," || tokens[end].depth != token.depth {
+				break
+			}
+			next = end + 1
+		}
+	}
+	return refs
+}
+
+// readTableRef reads a possibly qualified table name, or a parenthesized
+// subquery, and its alias starting at tokens[i]. It returns the index after
+// them.
+func readTableRef(tokens []sqlToken, i int, keyword string) (TableRef, int) {
+	ref := TableRef{keyword: keyword}
+	for i < len(tokens) && (tokens[i].word == "ONLY" || tokens[i].word == "LATERAL") {
+		i++
+	}
+	if i >= len(tokens) {
+		return ref, i
+	}
+
+	if tokens[i].text == "(" {
+		if keyword == "INTO" {
+			return ref, i
+		}
+		i = skipParens(tokens, i)
+	} else {
+		if !isNameToken(tokens[i]) || notAliases[tokens[i].word] {
+			return ref, i
+		}
+		parts := []string{unquoteName(tokens[i].text)}
+		i++
+		for i+1 < len(tokens) && tokens[i].text == "." && isNameToken(tokens[i+1]) {
+			parts = append(parts, unquoteName(tokens[i+1].text))
+			i += 2
+		}
+		ref.Name = parts[len(parts)-1]
+		if len(parts) > 1 {
+			ref.Schema = parts[len(parts)-2]
+		}
+
+		// A function in FROM, such as generate_series(1, 10)
+		if i < len(tokens) && tokens[i].text == "(" && keyword != "INTO" {
+			i = skipParens(tokens, i)
+		}
+	}
+
+	if i < len(tokens) && tokens[i].word == "AS" {
+		i++
+	}
+	if i < len(tokens) && isNameToken(tokens[i]) && !notAliases[tokens[i].word] {
+		ref.Alias = unquoteName(tokens[i].text)
+		i++
+	}
+	return ref, i
+}
+
+// skipParens returns the index after the parenthesis matching tokens[i]
+func skipParens(tokens []sqlToken, i int) int {
+	depth := tokens[i].depth
+	for i++; i < len(tokens); i++ {
+		if tokens[i].text == ")" && tokens[i].depth == depth {
+			return i + 1
+		}
+	}
+	return i
+}
+
+// visibleTokens drops what is inside the parentheses that do not hold the
+// cursor, such as the bodies of WITH queries and other subqueries, whose
+// tables are not in scope at the cursor. The parentheses are kept.
+func visibleTokens(tokens []sqlToken, cursor int) []sqlToken {
+	var visible []sqlToken
+	for i := 0; i < len(tokens); {
+		token := tokens[i]
+		visible = append(visible, token)
+		if token.text != "(" {
+			i++
+			continue
+		}
+		end := skipParens(tokens, i)
+		closing := tokens[end-1]
+		closed := end-1 > i && closing.text == ")" && closing.depth == token.depth
+		if token.pos < cursor && (!closed || closing.pos >= cursor) {
+			// The cursor is inside
+			i++
+			continue
+		}
+		if closed {
+			visible = append(visible, closing)
+		}
+		i = end
+	}
+	return visible
+}
+
+// cteNames returns the names of the WITH queries of a statement
+func cteNames(tokens []sqlToken) []string {
+	if len(tokens) == 0 || tokens[0].word != "WITH" {
+		return nil
+	}
+
+	var names []string
+	depth := tokens[0].depth
+	for i := 1; i+1 < len(tokens); i++ {
+		if tokens[i].depth != depth || tokens[i].word != "AS" {
+			continue
+		}
+		// name AS (, name (columns) AS ( or name AS [NOT] MATERIALIZED (
+		j := i - 1
+		if tokens[j].text == ")" {
+			for j > 0 && !(tokens[j].text == "(" && tokens[j].depth == depth) {
+				j--
+			}
+			j--
+		}
+		if j >= 0 && isNameToken(tokens[j]) {
+			names = append(names, unquoteName(tokens[j].text))
+		}
+	}
+	return names
+}
+
+// isNameToken reports whether a token is a word or a quoted name
+func isNameToken(token sqlToken) bool {
+	return token.word != "" || isQuote(token.text)
+}
+
+func isQuote(s string) bool {
+	return s != "" && (s[0] == '"' || s[0] == '`')
+}
+
+// unquoteName removes the quotes around a name, undoubling quotes inside it.
+// A name still being typed may lack its closing quote.
+func unquoteName(name string) string {
+	if !isQuote(name) {
+		return name
+	}
+	quote := name[:1]
+	name = name[1:]
+	if strings.HasSuffix(name, quote) {
+		name = name[:len(name)-1]
+	}
+	return strings.ReplaceAll(name, quote+quote, quote)
+}
+
+// IsIdentifierRune reports whether r can be part of an unquoted name
+func IsIdentifierRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isPlainIdentifier reports whether name can be written without quotes.
+// With foldsToLower, names holding upper-case letters cannot, as they
+// would be looked up lower-cased.
+func isPlainIdentifier(name string, foldsToLower bool) bool {
+	first, _ := utf8.DecodeRuneInString(name)
+	if name == "" || !(first == '_' || unicode.IsLetter(first)) {
+		return false
+	}
+	if foldsToLower && strings.ToLower(name) != name {
+		return false
+	}
+	for _, r := range name {
+		if !IsIdentifierRune(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,239 @@
+package db
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// splitCursor removes the | marking the cursor from query and returns its
+// byte offset
+func splitCursor(t *testing.T, query string) (string, int) {
+	t.Helper()
+	cursor := strings.Index(query, "|")
+	if cursor < 0 {
+		t.Fatalf("query %q has no cursor", query)
+	}
+	return query[:cursor] + query[cursor+1:], cursor
+}
+
+func TestAnalyzeCompletion(t *testing.T) {
+	syntax := postgresDialect{}.ScriptSyntax()
+	tests := []struct {
+		query     string
+		word      string
+		quoted    bool
+		qualifier []string
+		clause    Clause
+		join      bool
+		tables    []TableRef
+		inLiteral bool
+	}{
+		{query: "SEL|", word: "SEL", clause: ClauseStart},
+		{query: "SELECT | FROM orders", clause: ClauseSelect, tables: []TableRef{{Name: "orders"}}},
+		{query: "SELECT * FROM ord|", word: "ord", clause: ClauseTable},
+		{query: "SELECT * FROM orders o JOIN |", clause: ClauseTable, join: true, tables: []TableRef{{Name: "orders", Alias: "o"}}},
+		{query: "SELECT o.| FROM orders o", qualifier: []string{"o"}, clause: ClauseSelect, tables: []TableRef{{Name: "orders", Alias: "o"}}},
+		{query: "SELECT * FROM billing.invoices i WHERE i.to|", word: "to", qualifier: []string{"i"}, clause: ClauseCondition, tables: []TableRef{{Schema: "billing", Name: "invoices", Alias: "i"}}},
+		{query: `SELECT * FROM "Order|`, word: "Order", quoted: true, clause: ClauseTable},
+		{query: "SELECT * FROM orders WHERE note = 'ab|", inLiteral: true},
+		{query: "SELECT 1; UPDATE orders SET |", clause: ClauseSet, tables: []TableRef{{Name: "orders"}}},
+		{query: "SELECT * FROM orders ORDER BY |", clause: ClauseOrderBy, tables: []TableRef{{Name: "orders"}}},
+		{query: "SELECT * FROM orders GROUP BY cu|", word: "cu", clause: ClauseGroupBy, tables: []TableRef{{Name: "orders"}}},
+		{query: "INSERT INTO orders (id, |) VALUES (1, 2)", clause: ClauseInsertColumns, tables: []TableRef{{Name: "orders"}}},
+		{query: "SELECT * FROM orders o, billing.invoices i WHERE |", clause: ClauseCondition, tables: []TableRef{{Name: "orders", Alias: "o"}, {Schema: "billing", Name: "invoices", Alias: "i"}}},
+
+		// A subquery sees the tables around it, but not the other way round
+		{query: "SELECT * FROM orders WHERE id IN (SELECT | FROM invoices)", clause: ClauseSelect, tables: []TableRef{{Name: "orders"}, {Name: "invoices"}}},
+		{query: "SELECT | FROM orders WHERE id IN (SELECT order_id FROM invoices)", clause: ClauseSelect, tables: []TableRef{{Name: "orders"}}},
+		{query: "WITH recent AS (SELECT id FROM orders) SELECT | FROM recent", clause: ClauseSelect, tables: []TableRef{{Name: "recent"}}},
+		{query: "WITH recent AS (SELECT | FROM orders) SELECT * FROM recent", clause: ClauseSelect, tables: []TableRef{{Name: "orders"}, {Name: "recent"}}},
+
+		// Names are made of letters and digits of any script, other
+		// characters end them
+		{query: "SELECT * FROM 注文 WHERE 金|", word: "金", clause: ClauseCondition, tables: []TableRef{{Name: "注文"}}},
+		{query: "SELECT * FROM café c WHERE c.prix|", word: "prix", qualifier: []string{"c"}, clause: ClauseCondition, tables: []TableRef{{Name: "café", Alias: "c"}}},
+		{query: "SELECT total…|", clause: ClauseSelect},
+		{query: "SELECT total\u00a0|", clause: ClauseSelect},
+	}
+
+	for _, test := range tests {
+		query, cursor := splitCursor(t, test.query)
+		ctx := AnalyzeCompletion(query, cursor, syntax)
+		if ctx.InLiteral != test.inLiteral {
+			t.Errorf("%q: InLiteral = %v, want %v", test.query, ctx.InLiteral, test.inLiteral)
+			continue
+		}
+		if test.inLiteral {
+			continue
+		}
+		if ctx.Word != test.word || ctx.Quoted != test.quoted {
+			t.Errorf("%q: word %q quoted %v, want %q quoted %v", test.query, ctx.Word, ctx.Quoted, test.word, test.quoted)
+		}
+		if !slices.Equal(ctx.Qualifier, test.qualifier) {
+			t.Errorf("%q: qualifier %q, want %q", test.query, ctx.Qualifier, test.qualifier)
+		}
+		if ctx.Clause != test.clause || ctx.Join != test.join {
+			t.Errorf("%q: clause %d join %v, want %d join %v", test.query, ctx.Clause, ctx.Join, test.clause, test.join)
+		}
+		tables := make([]TableRef, len(ctx.Tables))
+		for i, ref := range ctx.Tables {
+			tables[i] = TableRef{Schema: ref.Schema, Name: ref.Name, Alias: ref.Alias}
+		}
+		if len(tables) == 0 {
+			tables = nil
+		}
+		if !reflect.DeepEqual(tables, test.tables) {
+			t.Errorf("%q: tables %+v, want %+v", test.query, tables, test.tables)
+		}
+	}
+}
+
+// newTestCache builds a loaded cache for dialect holding the given tables
+func newTestCache(dialect Dialect, columns map[TableName][]string, schemas, searchPath []string) *SchemaCache {
+	sc := &SchemaCache{dialect: dialect, Schemas: schemas, Columns: columns, initialized: true}
+	for table := range columns {
+		sc.allTables = append(sc.allTables, table)
+	}
+	slices.SortFunc(sc.allTables, func(a, b TableName) int {
+		return strings.Compare(a.Schema+"."+a.Name, b.Schema+"."+b.Name)
+	})
+	sc.setPredefinedData()
+	sc.setSearchPath(searchPath)
+	return sc
+}
+
+func TestComplete(t *testing.T) {
+	postgres := newTestCache(postgresDialect{}, map[TableName][]string{
+		{Schema: "public", Name: "orders"}:      {"id", "customer_id", "Total"},
+		{Schema: "public", Name: "OrderItems"}:  {"id", "order_id"},
+		{Schema: "billing", Name: "invoices"}:   {"id", "order_id"},
+		{Schema: "public", Name: "order notes"}: {"id"},
+	}, []string{"billing", "public"}, []string{"public"})
+	unicode := newTestCache(postgresDialect{}, map[TableName][]string{
+		{Schema: "public", Name: "注文"}:     {"金額", "id"},
+		{Schema: "public", Name: "Straße"}: {"id"},
+	}, []string{"public"}, []string{"public"})
+	mysql := newTestCache(mysqlDialect{}, map[TableName][]string{
+		{Name: "Orders"}: {"ID", "Total"},
+	}, nil, nil)
+
+	tests := []struct {
+		cache *SchemaCache
+		query string
+		want  []string
+	}{
+		// Tables of the search path, and schemas
+		{postgres, "SELECT * FROM ord|", []string{`"OrderItems"`, `"order notes"`, "orders"}},
+		{postgres, "SELECT * FROM bil|", []string{"billing"}},
+		{postgres, "SELECT * FROM billing.|", []string{"invoices"}},
+		// A name that is not all lower-case is quoted on PostgreSQL, and
+		// completing inside quotes keeps the quotes
+		{postgres, `SELECT * FROM "Ord|`, []string{`"OrderItems"`, `"order notes"`, `"orders"`}},
+		{postgres, "SELECT o.to| FROM orders o", []string{`"Total"`}},
+		// Aliases are given back as the query spells them
+		{postgres, "SELECT O| FROM orders O", []string{`"OrderItems"`, `"order notes"`, "O", "orders"}},
+		// Other engines do not fold names, so they stay unquoted
+		{mysql, "SELECT * FROM Ord|", []string{"Orders"}},
+		{mysql, "SELECT o.to| FROM Orders o", []string{"Total"}},
+		// Columns of the tables in scope, nothing inside a string
+		{postgres, "SELECT cust| FROM orders", []string{"customer_id"}},
+		{postgres, "SELECT * FROM orders WHERE 'cust|", nil},
+		{postgres, "SELECT * FROM orders ORDER BY cu|", []string{"customer_id"}},
+		{postgres, "SELECT customer_id, count(*) FROM orders GROUP BY cu|", []string{"customer_id"}},
+		{postgres, "INSERT INTO orders (id, |", []string{`"Total"`, "customer_id", "id"}},
+		{postgres, "UPDATE orders SET |", []string{`"Total"`, "customer_id", "id"}},
+		{postgres, `UPDATE orders o SET "Total" = 0 WHERE o.|`, []string{`"Total"`, "customer_id", "id"}},
+		{postgres, "SELECT * FROM orders o, billing.invoices i WHERE i.|", []string{"id", "order_id"}},
+		{postgres, "SELECT * FROM orders o, billing.invoices i WHERE or|", []string{`"OrderItems"`, `"order notes"`, "order_id", "orders"}},
+		// Columns of a subquery are offered inside it only
+		{postgres, "SELECT * FROM orders o WHERE id IN (SELECT ord| FROM billing.invoices)", []string{`"OrderItems"`, `"order notes"`, "order_id", "orders"}},
+		{postgres, "SELECT ord| FROM orders WHERE id IN (SELECT order_id FROM billing.invoices)", []string{`"OrderItems"`, `"order notes"`, "orders"}},
+		{postgres, "WITH recent AS (SELECT id FROM orders) SELECT cu| FROM recent", nil},
+		{postgres, "WITH recent AS (SELECT id FROM orders) SELECT * FROM rec|", []string{"recent"}},
+		// Names in any script
+		{unicode, "SELECT * FROM 注|", []string{"注文"}},
+		{unicode, "SELECT * FROM 注文 WHERE 金|", []string{"金額"}},
+		{unicode, "SELECT * FROM str|", []string{`"Straße"`}},
+	}
+
+	for _, test := range tests {
+		query, cursor := splitCursor(t, test.query)
+		var got []string
+		for _, completion := range test.cache.Complete(query, cursor) {
+			if completion.Kind != CompletionKeyword && completion.Kind != CompletionFunction {
+				got = append(got, completion.Text)
+			}
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestCompleteJoins(t *testing.T) {
+	sc := newTestCache(postgresDialect{}, map[TableName][]string{
+		{Schema: "public", Name: "orders"}:      {"id"},
+		{Schema: "public", Name: "order_items"}: {"id", "order_id"},
+		{Schema: "public", Name: "customers"}:   {"id"},
+	}, []string{"public"}, []string{"public"})
+	sc.ForeignKeys = []ForeignKey{{
+		Name:       "items_order_fk",
+		Table:      TableName{Schema: "public", Name: "order_items"},
+		Columns:    []string{"order_id"},
+		RefTable:   TableName{Schema: "public", Name: "orders"},
+		RefColumns: []string{"id"},
+	}}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// From the referenced table to the referencing one, and back
+		{"SELECT * FROM orders o JOIN |", []string{"order_items oi ON oi.order_id = o.id"}},
+		{"SELECT * FROM order_items i JOIN |", []string{"orders o ON o.id = i.order_id"}},
+		{"SELECT * FROM order_items JOIN |", []string{"orders o ON o.id = order_items.order_id"}},
+		{"SELECT * FROM customers JOIN |", nil},
+	}
+
+	for _, test := range tests {
+		query, cursor := splitCursor(t, test.query)
+		var joins []string
+		for _, completion := range sc.Complete(query, cursor) {
+			if completion.Kind == CompletionJoin {
+				joins = append(joins, completion.Text)
+			}
+		}
+		if !slices.Equal(joins, test.want) {
+			t.Errorf("%q: got %q, want %q", test.query, joins, test.want)
+		}
+	}
+}
+
+func TestCompleteJoinQuotesCatalogNames(t *testing.T) {
+	sc := newTestCache(postgresDialect{}, map[TableName][]string{
+		{Schema: "public", Name: "Orders"}:     {"id"},
+		{Schema: "public", Name: "OrderItems"}: {"id", "OrderID"},
+	}, []string{"public"}, []string{"public"})
+	sc.ForeignKeys = []ForeignKey{{
+		Name:       "items_order_fk",
+		Table:      TableName{Schema: "public", Name: "OrderItems"},
+		Columns:    []string{"OrderID"},
+		RefTable:   TableName{Schema: "public", Name: "Orders"},
+		RefColumns: []string{"id"},
+	}}
+
+	query, cursor := splitCursor(t, `SELECT * FROM "Orders" JOIN |`)
+	var joins []string
+	for _, completion := range sc.Complete(query, cursor) {
+		if completion.Kind == CompletionJoin {
+			joins = append(joins, completion.Text)
+		}
+	}
+	want := []string{`"OrderItems" o ON o."OrderID" = "Orders".id`}
+	if !slices.Equal(joins, want) {
+		t.Errorf("joins = %q, want %q", joins, want)
+	}
+}
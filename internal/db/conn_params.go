@@ -0,0 +1,121 @@
+package db
+
+import (
+	"fmt"
+	"os/user"
+	"sort"
+	"strings"
+)
+
+// ConnParams holds everything needed to open a connection to a database
+type ConnParams struct {
+	DBType   string
+	Host     string
+	Port     string
+	User     string
+	Password string
+	// DBName is the path of the database file for file-based dialects
+	DBName string
+
+	// SocketDir connects over a Unix-domain socket instead of TCP. It is the
+	// directory holding the server socket, or for MySQL also the socket file
+	// itself. A Host starting with "/" is taken as a socket directory, as
+	// libpq does.
+	SocketDir string
+
+	// SSLMode is one of disable, require, verify-ca or verify-full. An empty
+	// mode means disable.
+	SSLMode string
+	// SSLRootCert is the CA bundle used to verify the server certificate
+	SSLRootCert string
+	// SSLCert and SSLKey are the client certificate and its private key
+	SSLCert string
+	SSLKey  string
+
+	// Params holds extra driver parameters such as application_name or
+	// connect_timeout, passed through using the libpq names
+	Params map[string]string
+
+	// SSH, when set, is a jump host the connection is forwarded through
+	SSH *SSHParams
+
+	// ReadOnly asks the server to refuse writes on every connection where
+	// the driver allows it, see Dialect.ReadOnlySessionStatement for the rest
+	ReadOnly bool
+
+	// serverName is the real database host when Host points at the local
+	// end of an SSH tunnel, used to verify the server certificate
+	serverName string
+}
+
+// SSLModes lists the accepted values for ConnParams.SSLMode
+var SSLModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// WithDBName returns a copy of the parameters pointing at another database
+func (p ConnParams) WithDBName(dbName string) ConnParams {
+	p.DBName = dbName
+	return p
+}
+
+// withDefaults fills in an empty host and port with the dialect defaults
+func (p ConnParams) withDefaults(dialect Dialect) ConnParams {
+	if dialect.FileBased() {
+		return p
+	}
+	if p.SocketDir == "" && strings.HasPrefix(p.Host, "/") {
+		p.SocketDir, p.Host = p.Host, ""
+	}
+	if p.Host == "" && p.SocketDir == "" {
+		p.Host = "localhost"
+	}
+	if p.Port == "" {
+		p.Port = dialect.DefaultPort()
+	}
+	return p
+}
+
+// tlsServerName returns the host name the server certificate must match
+func (p ConnParams) tlsServerName() string {
+	if p.serverName != "" {
+		return p.serverName
+	}
+	return p.Host
+}
+
+// UsesSocket reports whether the connection goes over a Unix-domain socket,
+// where peer authentication usually needs no password
+func (p ConnParams) UsesSocket() bool {
+	return p.SocketDir != "" || strings.HasPrefix(p.Host, "/")
+}
+
+// sslMode returns the validated SSL mode, defaulting to disable
+func (p ConnParams) sslMode() (string, error) {
+	if p.SSLMode == "" {
+		return "disable", nil
+	}
+	for _, mode := range SSLModes {
+		if p.SSLMode == mode {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("invalid SSL mode '%s': expected one of disable, require, verify-ca, verify-full", p.SSLMode)
+}
+
+// osUsername returns the name of the user running maxim, which is what peer
+// authentication and ssh default to
+func osUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// paramKeys returns the keys of Params in a stable order
+func (p ConnParams) paramKeys() []string {
+	keys := make([]string, 0, len(p.Params))
+	for key := range p.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,135 +1,207 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-
-	"github.com/charmbracelet/bubbles/table"
-	"github.com/lib/pq"
+	"slices"
+	"sync"
 )
 
-func ConnectAndVerify(dbType, user, password, host, port, dbname string) (*sql.DB, error) {
-	var dsn string
-	driverName := dbType
+// dsns remembers the DSN each handle was opened with, for the features that
+// need a connection outside its pool, such as listening for notifications
+var dsns sync.Map // *sql.DB -> string
 
-	switch dbType {
-	case "psql":
-		driverName = "postgres"
-		dsn = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+func ConnectAndVerify(params ConnParams) (*sql.DB, error) {
+	dialect, err := GetDialect(params.DBType)
+	if err != nil {
+		return nil, err
 	}
+	params = params.withDefaults(dialect)
 
-	db, err := sql.Open(driverName, dsn)
+	db, err := openDB(dialect, params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database connection: %w", err)
+		return nil, err
 	}
 
 	if err = db.Ping(); err != nil {
-		db.Close()
-		// Parse PostgreSQL error to provide more specific messages
-		if pqErr, ok := err.(*pq.Error); ok {
-			switch pqErr.Code {
-			case "28P01": // Invalid password
-				return nil, fmt.Errorf("authentication failed: invalid password for user '%s'", user)
-			case "3D000": // Invalid database name
-				return nil, fmt.Errorf("database '%s' does not exist", dbname)
-			case "08006": // Connection failure
-				return nil, fmt.Errorf("connection failed: unable to connect to host '%s' on port '%s' - check if PostgreSQL is running", host, port)
-			case "08001": // SQL client unable to establish SQL connection
-				return nil, fmt.Errorf("connection refused: unable to connect to host '%s' on port '%s' - check if PostgreSQL is running and port is correct", host, port)
-			case "08003": // Connection does not exist
-				return nil, fmt.Errorf("connection lost: unable to maintain connection to host '%s' on port '%s'", host, port)
-			default:
-				return nil, fmt.Errorf("database connection failed: %s", pqErr.Message)
-			}
+		closeDB(db)
+		if sshErr := tunnelError(params); sshErr != nil {
+			return nil, sshErr
 		}
-		return nil, fmt.Errorf("database connection failed: %w", err)
+		if tlsErr := translateTLSError(err, params); tlsErr != nil {
+			return nil, tlsErr
+		}
+		return nil, dialect.TranslateError(err, params)
 	}
 
 	return db, nil
 }
 
-func ListDatabases(db *sql.DB) ([]string, error) {
-	query := "SELECT datname FROM pg_database WHERE datistemplate = false;"
+// openDB builds the DSN for params and opens a handle without pinging it.
+// Connections with SSH settings go through a tunnel opened here.
+func openDB(dialect Dialect, params ConnParams) (*sql.DB, error) {
+	params = params.withDefaults(dialect)
+	if params.SSH != nil && dialect.FileBased() {
+		return nil, fmt.Errorf("SSH tunnels do not apply to %s databases", dialect.Name())
+	}
+	if params.SSH != nil && params.SocketDir != "" {
+		return nil, fmt.Errorf("SSH tunnels need a TCP host, not a Unix socket")
+	}
+	params, err := throughTunnel(params)
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := db.Query(query)
+	dsn, err := dialect.DSN(params)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var dbNames []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return nil, err
-		}
-		dbNames = append(dbNames, name)
+	db, err := sql.Open(dialect.DriverName(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
+	dsns.Store(db, dsn)
+	return db, nil
+}
 
-	return dbNames, nil
+// closeDB closes a handle opened by openDB that is not handed out
+func closeDB(db *sql.DB) {
+	dsns.Delete(db)
+	db.Close()
 }
 
-func GetTables(db *sql.DB) ([]string, error) {
-	query := "SELECT tablename FROM pg_catalog.pg_tables WHERE schemaname = 'public';"
-	rows, err := db.Query(query)
+func ListDatabases(db *sql.DB, dbType string) ([]string, error) {
+	return ListDatabasesContext(context.Background(), db, dbType)
+}
+
+// ListDatabasesContext is ListDatabases, stopped when ctx is done
+func ListDatabasesContext(ctx context.Context, db *sql.DB, dbType string) ([]string, error) {
+	dialect, err := GetDialect(dbType)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return queryStrings(ctx, db, dialect.ListDatabasesQuery())
+}
 
-	var tableNames []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return nil, err
-		}
-		tableNames = append(tableNames, name)
+// TableName is a table and the schema that holds it. Schema is empty for
+// engines without schemas.
+type TableName struct {
+	Schema string
+	Name   string
+}
+
+// String returns the table name, qualified by its schema when it has one
+func (t TableName) String() string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// QuoteTable quotes a table name and its schema for use in a statement
+func QuoteTable(dialect Dialect, table TableName) string {
+	if table.Schema == "" {
+		return dialect.QuoteIdentifier(table.Name)
 	}
-	return tableNames, nil
+	return dialect.QuoteIdentifier(table.Schema) + "." + dialect.QuoteIdentifier(table.Name)
+}
+
+// ListSchemas returns the schemas of the current database, none for engines
+// without schemas
+func ListSchemas(db *sql.DB, dbType string) ([]string, error) {
+	return ListSchemasContext(context.Background(), db, dbType)
 }
 
-func GetTableData(db *sql.DB, tableName string) ([]table.Column, []table.Row, error) {
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 100", pq.QuoteIdentifier(tableName)))
+// ListSchemasContext is ListSchemas, stopped when ctx is done
+func ListSchemasContext(ctx context.Context, db *sql.DB, dbType string) ([]string, error) {
+	dialect, err := GetDialect(dbType)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	if dialect.ListSchemasQuery() == "" {
+		return nil, nil
+	}
+	return queryStrings(ctx, db, dialect.ListSchemasQuery())
+}
 
-	defer rows.Close()
+// GetTables returns the tables of the current database in the given schemas,
+// or in every schema when none are given
+func GetTables(db *sql.DB, dbType string, schemas []string) ([]TableName, error) {
+	return GetTablesContext(context.Background(), db, dbType, schemas)
+}
 
-	colNames, err := rows.Columns()
+// GetTablesContext is GetTables, stopped when ctx is done
+func GetTablesContext(ctx context.Context, db *sql.DB, dbType string, schemas []string) ([]TableName, error) {
+	dialect, err := GetDialect(dbType)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	tables, err := queryTables(ctx, db, dialect)
+	if err != nil || len(schemas) == 0 {
+		return tables, err
+	}
+	return slices.DeleteFunc(tables, func(t TableName) bool {
+		return !slices.Contains(schemas, t.Schema)
+	}), nil
+}
 
-	cols := make([]table.Column, len(colNames))
-	for i, colName := range colNames {
-		cols[i] = table.Column{Title: colName, Width: 15}
+// queryTables runs the ListTablesQuery of a dialect
+func queryTables(ctx context.Context, db *sql.DB, dialect Dialect) ([]TableName, error) {
+	rows, err := db.QueryContext(ctx, dialect.ListTablesQuery())
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	var tableRows []table.Row
+	var tables []TableName
 	for rows.Next() {
-		rowVals := make([]interface{}, len(colNames))
-		scanArgs := make([]interface{}, len(colNames))
-
-		for i := range rowVals {
-			scanArgs[i] = &rowVals[i]
+		var table TableName
+		if err := rows.Scan(&table.Schema, &table.Name); err != nil {
+			return nil, err
 		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
 
-		if err := rows.Scan(scanArgs...); err != nil {
-			return nil, nil, err
-		}
+// queryStrings runs a catalog query that returns a single text column
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		row := make(table.Row, len(colNames))
-		for i, val := range rowVals {
-			if val == nil {
-				row[i] = "NULL"
-			} else {
-				row[i] = fmt.Sprintf("%s", val)
-			}
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
 		}
-		tableRows = append(tableRows, row)
+		values = append(values, value)
 	}
-	return cols, tableRows, nil
+	return values, rows.Err()
+}
+
+// GetTableData returns the first MaxResultRows rows of a table
+func GetTableData(db *sql.DB, dbType string, table TableName) (*ResultSet, error) {
+	return GetTableDataContext(context.Background(), db, dbType, table)
+}
+
+// GetTableDataContext is GetTableData, stopped when ctx is done
+func GetTableDataContext(ctx context.Context, db *sql.DB, dbType string, table TableName) (*ResultSet, error) {
+	dialect, err := GetDialect(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT %d", QuoteTable(dialect, table), MaxResultRows+1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanResultSet(rows)
 }
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"fmt"
+)
+
+// Dialect describes everything engine-specific maxim needs to talk to a
+// database: how to connect, how to quote names, which catalog queries to
+// run and which statements create users and grant privileges.
+type Dialect interface {
+	// Name is the human readable engine name shown in the forms
+	Name() string
+	// DriverName is the database/sql driver used to open connections
+	DriverName() string
+	// DefaultPort and DefaultUser are used when the forms are left empty
+	DefaultPort() string
+	DefaultUser() string
+	// DefaultDatabase is the maintenance database a superuser connects to
+	DefaultDatabase() string
+	// FileBased reports whether the database is a local file addressed by its
+	// path (passed as the database name) rather than a server with users
+	FileBased() bool
+
+	// DSN builds the driver connection string, including the TLS settings
+	DSN(p ConnParams) (string, error)
+	// TranslateError turns a failed ping into an actionable message
+	TranslateError(err error, p ConnParams) error
+	// QuoteIdentifier quotes a table, column or database name
+	QuoteIdentifier(name string) string
+	// ScriptSyntax describes the quoting and comment rules used to split a
+	// script into statements
+	ScriptSyntax() ScriptSyntax
+	// AbortsTransactionOnError reports whether a failed statement leaves the
+	// open transaction unusable until it is rolled back
+	AbortsTransactionOnError() bool
+	// ReadOnlySessionStatement makes a session read-only when the DSN cannot
+	// ask for it with ConnParams.ReadOnly, and is empty otherwise
+	ReadOnlySessionStatement() string
+	// Placeholder is the driver placeholder for the n-th argument of a
+	// statement, counting from 1
+	Placeholder(n int) string
+
+	// ListDatabasesQuery returns one database name per row
+	ListDatabasesQuery() string
+	// ListSchemasQuery returns one schema name per row for the current
+	// database, leaving out the system schemas. It is empty for engines
+	// whose tables are not grouped into schemas inside a database.
+	ListSchemasQuery() string
+	// SearchPathQuery returns the schemas unqualified names are looked up
+	// in, one per row in order, and is empty when ListSchemasQuery is
+	SearchPathQuery() string
+	// ListTablesQuery returns the schema and name of each table of the
+	// current database, with an empty schema for engines without schemas
+	ListTablesQuery() string
+	// ListColumnsQuery takes a schema, empty for engines without schemas,
+	// and a table name as its parameters and returns one column name per
+	// row in ordinal order
+	ListColumnsQuery() string
+	// ListFunctionsQuery returns one function name per row, for the
+	// functions that can be called without a schema
+	ListFunctionsQuery() string
+	// ListKeysQuery returns one row per column of each primary key, unique
+	// key and foreign key of the current database: the constraint name, its
+	// type ('p', 'u' or 'f'), the schema, table and column, the referenced
+	// schema, table and column of a foreign key, empty otherwise, and the
+	// position of the column in the key. The referenced column may also be
+	// empty when it is the matching column of the referenced primary key.
+	ListKeysQuery() string
+	// SchemaFingerprintQuery returns the schema and name of each table of
+	// ListTablesQuery with a fingerprint of its definition, which changes
+	// whenever its columns or keys do
+	SchemaFingerprintQuery() string
+
+	// CreateDatabaseStatements create the database and the user, run as admin
+	CreateDatabaseStatements(dbName, user, password string) []Statement
+	// DatabaseGrantStatements grant database-level privileges, run as admin
+	DatabaseGrantStatements(dbName, user string) []Statement
+	// CreateSchemaStatements create the schemas that do not exist yet,
+	// owned by user, run as admin while connected to the database
+	CreateSchemaStatements(schemas []string, user string) []Statement
+	// SchemaGrantStatements grant privileges on the objects inside the given
+	// schemas of a database, or its default schema when there are none, run
+	// as admin while connected to that database
+	SchemaGrantStatements(user string, schemas []string) []Statement
+	// TableGrantStatements grant privileges on a single table, run as admin
+	// while connected to the database that holds it
+	TableGrantStatements(dbName string, table TableName, user string) []Statement
+}
+
+// Statement is a SQL statement together with a short description of what it
+// does, used to build error messages such as "could not create user"
+type Statement struct {
+	SQL    string
+	Action string
+}
+
+var (
+	dialects     = make(map[string]Dialect)
+	dialectTypes []string
+)
+
+func init() {
+	RegisterDialect("psql", postgresDialect{})
+	RegisterDialect("mysql", mysqlDialect{})
+	RegisterDialect("sqlite", sqliteDialect{})
+}
+
+// RegisterDialect makes a dialect available under the given dbType. Dialects
+// are listed in the forms in registration order.
+func RegisterDialect(dbType string, dialect Dialect) {
+	if _, exists := dialects[dbType]; !exists {
+		dialectTypes = append(dialectTypes, dbType)
+	}
+	dialects[dbType] = dialect
+}
+
+// GetDialect returns the dialect registered for dbType
+func GetDialect(dbType string) (Dialect, error) {
+	dialect, exists := dialects[dbType]
+	if !exists {
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	return dialect, nil
+}
+
+// requireServer rejects file-based dialects for operations that need server-side users
+func requireServer(dialect Dialect) error {
+	if dialect.FileBased() {
+		return fmt.Errorf("not applicable: %s databases have no users or privileges", dialect.Name())
+	}
+	return nil
+}
+
+// DialectTypes returns all registered dbTypes in registration order
+func DialectTypes() []string {
+	types := make([]string, len(dialectTypes))
+	copy(types, dialectTypes)
+	return types
+}
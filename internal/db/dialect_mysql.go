@@ -0,0 +1,299 @@
+package db
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDialect implements Dialect for MySQL and MariaDB using go-sql-driver
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string            { return "MySQL/MariaDB" }
+func (mysqlDialect) DriverName() string      { return "mysql" }
+func (mysqlDialect) DefaultPort() string     { return "3306" }
+func (mysqlDialect) DefaultUser() string     { return "root" }
+func (mysqlDialect) DefaultDatabase() string { return "" }
+func (mysqlDialect) FileBased() bool         { return false }
+
+// mysqlParams are the parameters passed on in the DSN besides the libpq ones
+// DSN maps: options of the driver, and session variables commonly set when
+// connecting. The TLS and connection attribute options are left out, as
+// DSN sets them from the connection settings.
+var mysqlParams = map[string]bool{
+	"allowCleartextPasswords": true,
+	"allowNativePasswords":    true,
+	"allowOldPasswords":       true,
+	"charset":                 true,
+	"checkConnLiveness":       true,
+	"clientFoundRows":         true,
+	"collation":               true,
+	"columnsWithAlias":        true,
+	"compress":                true,
+	"interpolateParams":       true,
+	"loc":                     true,
+	"maxAllowedPacket":        true,
+	"multiStatements":         true,
+	"parseTime":               true,
+	"readTimeout":             true,
+	"rejectReadOnly":          true,
+	"timeTruncate":            true,
+	"writeTimeout":            true,
+
+	"autocommit":            true,
+	"max_execution_time":    true,
+	"sql_mode":              true,
+	"time_zone":             true,
+	"transaction_isolation": true,
+	"wait_timeout":          true,
+}
+
+// DSN builds a go-sql-driver DSN. The driver has no notion of sslmode, so the
+// TLS settings are turned into a tls.Config registered under a name derived
+// from them and referenced from the DSN.
+func (mysqlDialect) DSN(p ConnParams) (string, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = p.User
+	cfg.Passwd = p.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(p.Host, p.Port)
+	if p.SocketDir != "" {
+		cfg.Net = "unix"
+		cfg.Addr = mysqlSocketPath(p.SocketDir)
+	}
+	cfg.DBName = p.DBName
+
+	// Map the libpq parameters that have a driver equivalent and pass on the
+	// MySQL ones. Others, such as the libpq options or
+	// target_session_attrs, mean nothing to MySQL and are refused.
+	for _, key := range p.paramKeys() {
+		value := p.Params[key]
+		switch key {
+		case "connect_timeout":
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return "", fmt.Errorf("invalid connect_timeout '%s': expected seconds", value)
+			}
+			cfg.Timeout = time.Duration(seconds) * time.Second
+		case "application_name":
+			cfg.ConnectionAttributes = "program_name:" + value
+		default:
+			if !mysqlParams[key] {
+				return "", fmt.Errorf("connection parameter '%s' is not supported by MySQL", key)
+			}
+			if cfg.Params == nil {
+				cfg.Params = make(map[string]string)
+			}
+			cfg.Params[key] = value
+		}
+	}
+
+	tlsConfig, err := buildTLSConfig(p)
+	if err != nil {
+		return "", err
+	}
+	if tlsConfig != nil {
+		// Tunnelled servers all share the local host, so the name tells them
+		// apart by the host their certificate is verified against
+		name := fmt.Sprintf("maxim-%x", sha256.Sum256([]byte(strings.Join([]string{p.tlsServerName(), p.Host, p.Port, p.SSLMode, p.SSLRootCert, p.SSLCert, p.SSLKey}, "\x00"))))
+		if err := mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+			return "", err
+		}
+		cfg.TLSConfig = name
+	}
+
+	return cfg.FormatDSN(), nil
+}
+
+func (mysqlDialect) TranslateError(err error, p ConnParams) error {
+	user, host, port, dbname := p.User, p.Host, p.Port, p.DBName
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1045: // ER_ACCESS_DENIED_ERROR
+			return fmt.Errorf("authentication failed: invalid password for user '%s'", user)
+		case 1044: // ER_DBACCESS_DENIED_ERROR
+			return fmt.Errorf("access denied: user '%s' cannot access database '%s'", user, dbname)
+		case 1049: // ER_BAD_DB_ERROR
+			return fmt.Errorf("database '%s' does not exist", dbname)
+		case 1130: // ER_HOST_NOT_PRIVILEGED
+			return fmt.Errorf("connection rejected: host is not allowed to connect to the MySQL server on '%s'", host)
+		case 1698: // ER_ACCESS_DENIED_NO_PASSWORD_ERROR, e.g. auth_socket accounts
+			return fmt.Errorf("authentication failed: user '%s' uses socket (peer) authentication - connect over the Unix socket as the OS user of the same name (you are '%s')", user, osUsername())
+		case 1040: // ER_CON_COUNT_ERROR
+			return fmt.Errorf("connection failed: too many connections on host '%s'", host)
+		default:
+			return fmt.Errorf("database connection failed: %s", myErr.Message)
+		}
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		if p.SocketDir != "" {
+			return fmt.Errorf("connection refused: no server socket at '%s' - check if MySQL is running and the socket path is correct", mysqlSocketPath(p.SocketDir))
+		}
+		return fmt.Errorf("connection refused: unable to connect to host '%s' on port '%s' - check if MySQL is running and port is correct", host, port)
+	}
+
+	return fmt.Errorf("database connection failed: %w", err)
+}
+
+// QuoteIdentifier quotes a name with backticks
+func (mysqlDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// ScriptSyntax follows the MySQL defaults: backslashes escape quotes in
+// strings and # starts a comment
+func (mysqlDialect) ScriptSyntax() ScriptSyntax {
+	return ScriptSyntax{BackslashEscapes: true, HashComments: true}
+}
+
+func (mysqlDialect) AbortsTransactionOnError() bool { return false }
+
+// ReadOnlySessionStatement works on both MySQL and MariaDB, unlike the
+// transaction_read_only variable the DSN could set
+func (mysqlDialect) ReadOnlySessionStatement() string {
+	return "SET SESSION TRANSACTION READ ONLY"
+}
+
+func (mysqlDialect) Placeholder(n int) string { return "?" }
+
+func (mysqlDialect) ListDatabasesQuery() string {
+	return `
+		SELECT schema_name
+		FROM information_schema.schemata
+		WHERE schema_name NOT IN ('information_schema', 'mysql', 'performance_schema', 'sys')
+		ORDER BY schema_name
+	`
+}
+
+// ListSchemasQuery is empty, a MySQL schema is a database
+func (mysqlDialect) ListSchemasQuery() string { return "" }
+
+func (mysqlDialect) SearchPathQuery() string { return "" }
+
+func (mysqlDialect) ListTablesQuery() string {
+	return `
+		SELECT '', table_name
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE()
+		AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`
+}
+
+// ListColumnsQuery looks in the current database when the schema is empty
+func (mysqlDialect) ListColumnsQuery() string {
+	return `
+		SELECT column_name
+		FROM information_schema.columns
+		WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE())
+		AND table_name = ?
+		ORDER BY ordinal_position
+	`
+}
+
+func (mysqlDialect) ListFunctionsQuery() string {
+	return `
+		SELECT routine_name
+		FROM information_schema.routines
+		WHERE routine_schema = DATABASE()
+		AND routine_type = 'FUNCTION'
+		ORDER BY routine_name
+	`
+}
+
+// ListKeysQuery leaves out foreign keys to tables of other databases
+func (mysqlDialect) ListKeysQuery() string {
+	return `
+		SELECT k.constraint_name,
+			CASE tc.constraint_type WHEN 'PRIMARY KEY' THEN 'p' WHEN 'UNIQUE' THEN 'u' ELSE 'f' END,
+			'', k.table_name, k.column_name,
+			'', COALESCE(k.referenced_table_name, ''), COALESCE(k.referenced_column_name, ''), k.ordinal_position
+		FROM information_schema.key_column_usage k
+		JOIN information_schema.table_constraints tc
+			ON tc.constraint_schema = k.constraint_schema
+			AND tc.table_name = k.table_name
+			AND tc.constraint_name = k.constraint_name
+		WHERE k.table_schema = DATABASE()
+		AND tc.constraint_type IN ('PRIMARY KEY', 'UNIQUE', 'FOREIGN KEY')
+		AND (k.referenced_table_schema IS NULL OR k.referenced_table_schema = DATABASE())
+		ORDER BY k.table_name, k.constraint_name, k.ordinal_position
+	`
+}
+
+// SchemaFingerprintQuery sums checksums rather than concatenating the
+// definitions, as GROUP_CONCAT truncates long results
+func (mysqlDialect) SchemaFingerprintQuery() string {
+	return `
+		SELECT '', t.table_name, CONCAT(
+			(SELECT CONCAT(COUNT(*), ':', COALESCE(SUM(CRC32(CONCAT_WS(' ', c.ordinal_position, c.column_name, c.column_type))), 0))
+			FROM information_schema.columns c
+			WHERE c.table_schema = t.table_schema AND c.table_name = t.table_name),
+			':',
+			(SELECT COALESCE(SUM(CRC32(CONCAT_WS(' ', k.constraint_name, k.column_name, k.ordinal_position, k.referenced_table_name, k.referenced_column_name))), 0)
+			FROM information_schema.key_column_usage k
+			WHERE k.table_schema = t.table_schema AND k.table_name = t.table_name))
+		FROM information_schema.tables t
+		WHERE t.table_schema = DATABASE()
+		AND t.table_type = 'BASE TABLE'
+	`
+}
+
+func (d mysqlDialect) CreateDatabaseStatements(dbName, user, password string) []Statement {
+	return []Statement{
+		{SQL: fmt.Sprintf("CREATE DATABASE %s", d.QuoteIdentifier(dbName)), Action: "create database"},
+		{SQL: fmt.Sprintf("CREATE USER %s IDENTIFIED BY %s", mysqlAccount(user), quoteMySQLLiteral(password)), Action: "create user"},
+	}
+}
+
+func (d mysqlDialect) DatabaseGrantStatements(dbName, user string) []Statement {
+	return []Statement{
+		{SQL: fmt.Sprintf("GRANT ALL PRIVILEGES ON %s.* TO %s", d.QuoteIdentifier(dbName), mysqlAccount(user)), Action: "grant database privileges"},
+	}
+}
+
+func (mysqlDialect) CreateSchemaStatements(schemas []string, user string) []Statement {
+	return nil
+}
+
+// SchemaGrantStatements is empty because the database grant already covers
+// every object in the database
+func (mysqlDialect) SchemaGrantStatements(user string, schemas []string) []Statement {
+	return nil
+}
+
+func (d mysqlDialect) TableGrantStatements(dbName string, table TableName, user string) []Statement {
+	return []Statement{
+		{SQL: fmt.Sprintf("GRANT ALL PRIVILEGES ON %s.%s TO %s", d.QuoteIdentifier(dbName), d.QuoteIdentifier(table.Name), mysqlAccount(user)), Action: "grant privileges on table " + table.Name},
+	}
+}
+
+// quoteMySQLLiteral quotes a string literal such as a password
+func quoteMySQLLiteral(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// mysqlAccount formats a user as 'name'@'%' so it can connect from any host
+func mysqlAccount(user string) string {
+	return quoteMySQLLiteral(user) + "@'%'"
+}
+
+// mysqlSocketPath returns the socket file for a socket setting, which may
+// name the file itself or the directory it is in
+func mysqlSocketPath(socket string) string {
+	if info, err := os.Stat(socket); err == nil && info.IsDir() {
+		return filepath.Join(socket, "mysqld.sock")
+	}
+	return socket
+}
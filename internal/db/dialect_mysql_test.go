@@ -0,0 +1,33 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMySQLDSNParams(t *testing.T) {
+	p := ConnParams{Host: "db.internal", Port: "3306", User: "app", DBName: "shop", Params: map[string]string{
+		"application_name": "maxim",
+		"connect_timeout":  "5",
+		"charset":          "utf8mb4",
+		"sql_mode":         "'ANSI'",
+	}}
+	dsn, err := mysqlDialect{}.DSN(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"timeout=5s", "charset=utf8mb4", "sql_mode=", "connectionAttributes=program_name%3Amaxim"} {
+		if !strings.Contains(dsn, want) {
+			t.Errorf("DSN %q lacks %q", dsn, want)
+		}
+	}
+
+	// Parameters of other engines are refused, not sent as session variables
+	for _, key := range []string{"options", "service", "target_session_attrs", "tls", "allowAllFiles"} {
+		p.Params = map[string]string{key: "x"}
+		_, err := mysqlDialect{}.DSN(p)
+		if err == nil || !strings.Contains(err.Error(), "'"+key+"' is not supported") {
+			t.Errorf("%s: got error %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresDialect implements Dialect for PostgreSQL using lib/pq
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string            { return "PostgreSQL" }
+func (postgresDialect) DriverName() string      { return "postgres" }
+func (postgresDialect) DefaultPort() string     { return "5432" }
+func (postgresDialect) DefaultUser() string     { return "postgres" }
+func (postgresDialect) DefaultDatabase() string { return "postgres" }
+func (postgresDialect) FileBased() bool         { return false }
+
+// DSN builds a libpq keyword/value string. lib/pq handles the SSL modes and
+// certificate files itself, so they are passed through unchanged.
+func (postgresDialect) DSN(p ConnParams) (string, error) {
+	sslMode, err := p.sslMode()
+	if err != nil {
+		return "", err
+	}
+
+	// lib/pq takes a socket directory as the host. Like libpq, never use
+	// SSL over a local socket.
+	host := p.Host
+	if p.SocketDir != "" {
+		host = p.SocketDir
+		sslMode = "disable"
+	}
+
+	// Empty values are left out so lib/pq applies its own defaults
+	pairs := []string{pqPair("sslmode", sslMode)}
+	for _, pair := range [][2]string{
+		{"host", host},
+		{"port", p.Port},
+		{"user", p.User},
+		{"password", p.Password},
+		{"dbname", p.DBName},
+		{"sslrootcert", p.SSLRootCert},
+		{"sslcert", p.SSLCert},
+		{"sslkey", p.SSLKey},
+	} {
+		if pair[1] != "" {
+			pairs = append(pairs, pqPair(pair[0], pair[1]))
+		}
+	}
+	options := p.Params["options"]
+	if p.ReadOnly {
+		options = strings.TrimSpace(options + " -c default_transaction_read_only=on")
+	}
+	if options != "" {
+		pairs = append(pairs, pqPair("options", options))
+	}
+	for _, key := range p.paramKeys() {
+		if key != "options" {
+			pairs = append(pairs, pqPair(key, p.Params[key]))
+		}
+	}
+	return strings.Join(pairs, " "), nil
+}
+
+// pqPair quotes a keyword/value pair so values may contain spaces and quotes
+func pqPair(key, value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return key + "='" + value + "'"
+}
+
+func (postgresDialect) TranslateError(err error, p ConnParams) error {
+	user, host, port, dbname := p.User, p.Host, p.Port, p.DBName
+	// Parse PostgreSQL error to provide more specific messages
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code {
+		case "28P01": // Invalid password
+			return fmt.Errorf("authentication failed: invalid password for user '%s'", user)
+		case "3D000": // Invalid database name
+			return fmt.Errorf("database '%s' does not exist", dbname)
+		case "08006": // Connection failure
+			return fmt.Errorf("connection failed: unable to connect to host '%s' on port '%s' - check if PostgreSQL is running", host, port)
+		case "08001": // SQL client unable to establish SQL connection
+			return fmt.Errorf("connection refused: unable to connect to host '%s' on port '%s' - check if PostgreSQL is running and port is correct", host, port)
+		case "08003": // Connection does not exist
+			return fmt.Errorf("connection lost: unable to maintain connection to host '%s' on port '%s'", host, port)
+		case "28000": // Invalid authorization specification, e.g. no pg_hba.conf entry
+			if strings.Contains(pqErr.Message, "no encryption") || strings.Contains(pqErr.Message, "SSL off") {
+				return fmt.Errorf("connection rejected: the server requires an encrypted connection - set the SSL mode to require or stronger")
+			}
+			if strings.Contains(pqErr.Message, "Peer authentication failed") || strings.Contains(pqErr.Message, "Ident authentication failed") {
+				return fmt.Errorf("peer authentication failed: the server only lets OS user '%s' log in as the database role of the same name, not '%s' - connect as role '%s', map the users in pg_ident.conf, or use a password over TCP", osUsername(), user, osUsername())
+			}
+			return fmt.Errorf("connection rejected: %s", pqErr.Message)
+		default:
+			return fmt.Errorf("database connection failed: %s", pqErr.Message)
+		}
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		if p.SocketDir != "" {
+			return fmt.Errorf("connection refused: no server socket for port '%s' in '%s' - check if PostgreSQL is running and the socket directory and port are correct", port, p.SocketDir)
+		}
+		return fmt.Errorf("connection refused: unable to connect to host '%s' on port '%s' - check if PostgreSQL is running and port is correct", host, port)
+	}
+
+	return fmt.Errorf("database connection failed: %w", err)
+}
+
+func (postgresDialect) QuoteIdentifier(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+// ScriptSyntax understands E'...' strings, dollar-quoted function bodies and
+// nested comments
+func (postgresDialect) ScriptSyntax() ScriptSyntax {
+	return ScriptSyntax{EscapeStrings: true, DollarQuotes: true, NestedComments: true, FoldsToLower: true}
+}
+
+func (postgresDialect) AbortsTransactionOnError() bool { return true }
+
+// ReadOnlySessionStatement is empty, the DSN sets
+// default_transaction_read_only instead
+func (postgresDialect) ReadOnlySessionStatement() string { return "" }
+
+func (postgresDialect) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (postgresDialect) ListDatabasesQuery() string {
+	return "SELECT datname FROM pg_database WHERE datistemplate = false;"
+}
+
+// ListSchemasQuery leaves out the catalog, TOAST and temporary schemas
+func (postgresDialect) ListSchemasQuery() string {
+	return `
+		SELECT nspname
+		FROM pg_catalog.pg_namespace
+		WHERE nspname NOT LIKE 'pg\_%'
+		AND nspname <> 'information_schema'
+		ORDER BY nspname
+	`
+}
+
+// SearchPathQuery lists the schemas of search_path that exist, with $user
+// resolved, leaving out the implicit pg_catalog
+func (postgresDialect) SearchPathQuery() string {
+	return "SELECT unnest(current_schemas(false))"
+}
+
+func (postgresDialect) ListTablesQuery() string {
+	return `
+		SELECT schemaname, tablename
+		FROM pg_catalog.pg_tables
+		WHERE schemaname NOT LIKE 'pg\_%'
+		AND schemaname <> 'information_schema'
+		ORDER BY schemaname, tablename
+	`
+}
+
+func (postgresDialect) ListColumnsQuery() string {
+	return `
+		SELECT column_name 
+		FROM information_schema.columns 
+		WHERE table_schema = $1 
+		AND table_name = $2 
+		ORDER BY ordinal_position
+	`
+}
+
+func (postgresDialect) ListFunctionsQuery() string {
+	return `
+		SELECT DISTINCT routine_name 
+		FROM information_schema.routines 
+		WHERE routine_schema = ANY (current_schemas(false)) 
+		AND routine_type = 'FUNCTION'
+		ORDER BY routine_name
+	`
+}
+
+func (postgresDialect) ListKeysQuery() string {
+	return `
+		SELECT c.conname, c.contype, n.nspname, t.relname, a.attname,
+			COALESCE(rn.nspname, ''), COALESCE(rt.relname, ''), COALESCE(ra.attname, ''), k.ord
+		FROM pg_catalog.pg_constraint c
+		JOIN pg_catalog.pg_class t ON t.oid = c.conrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+		CROSS JOIN LATERAL unnest(c.conkey) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		LEFT JOIN pg_catalog.pg_class rt ON rt.oid = c.confrelid
+		LEFT JOIN pg_catalog.pg_namespace rn ON rn.oid = rt.relnamespace
+		LEFT JOIN pg_catalog.pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = c.confkey[k.ord]
+		WHERE c.contype IN ('p', 'u', 'f')
+		AND n.nspname NOT LIKE 'pg\_%'
+		AND n.nspname <> 'information_schema'
+		ORDER BY n.nspname, t.relname, c.conname, k.ord
+	`
+}
+
+func (postgresDialect) SchemaFingerprintQuery() string {
+	return `
+		SELECT n.nspname, t.relname, md5(concat_ws('|',
+			(SELECT string_agg(a.attname || ' ' || format_type(a.atttypid, a.atttypmod), ',' ORDER BY a.attnum)
+			FROM pg_catalog.pg_attribute a
+			WHERE a.attrelid = t.oid AND a.attnum > 0 AND NOT a.attisdropped),
+			(SELECT string_agg(c.conname || ' ' || pg_get_constraintdef(c.oid), ',' ORDER BY c.conname)
+			FROM pg_catalog.pg_constraint c
+			WHERE c.conrelid = t.oid)))
+		FROM pg_catalog.pg_class t
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+		WHERE t.relkind IN ('r', 'p')
+		AND n.nspname NOT LIKE 'pg\_%'
+		AND n.nspname <> 'information_schema'
+	`
+}
+
+// schemaChangeChannel is the channel the event trigger installed by
+// schemaTriggerStatements notifies
+const schemaChangeChannel = "maxim_schema_change"
+
+// schemaChangeFunction is the function the event trigger runs, in the public
+// schema. The trigger itself is named after the channel.
+const schemaChangeFunction = "maxim_notify_schema_change"
+
+// schemaChangeFunctionName is schemaChangeFunction qualified and quoted
+func schemaChangeFunctionName() string {
+	return pq.QuoteIdentifier("public") + "." + pq.QuoteIdentifier(schemaChangeFunction)
+}
+
+// schemaTriggerStatements install an event trigger notifying
+// schemaChangeChannel after every DDL command, unless it exists already.
+// Only superusers may create event triggers, but once one has, every user
+// of the database gets the notifications.
+func (postgresDialect) schemaTriggerStatements() []Statement {
+	return []Statement{{
+		SQL: fmt.Sprintf(`
+			DO $do$
+			BEGIN
+				IF NOT EXISTS (SELECT 1 FROM pg_catalog.pg_event_trigger WHERE evtname = %[1]s) THEN
+					CREATE OR REPLACE FUNCTION %[3]s() RETURNS event_trigger
+					LANGUAGE plpgsql AS $fn$
+					BEGIN
+						PERFORM pg_notify(%[1]s, tg_tag);
+					END
+					$fn$;
+					CREATE EVENT TRIGGER %[2]s ON ddl_command_end
+					EXECUTE PROCEDURE %[3]s();
+				END IF;
+			END
+			$do$
+		`, pq.QuoteLiteral(schemaChangeChannel), pq.QuoteIdentifier(schemaChangeChannel), schemaChangeFunctionName()),
+		Action: "install schema change trigger",
+	}}
+}
+
+func (postgresDialect) dropSchemaTriggerStatements() []Statement {
+	return []Statement{
+		{SQL: "DROP EVENT TRIGGER IF EXISTS " + pq.QuoteIdentifier(schemaChangeChannel), Action: "drop schema change trigger"},
+		{SQL: "DROP FUNCTION IF EXISTS " + schemaChangeFunctionName() + "()", Action: "drop schema change function"},
+	}
+}
+
+func (postgresDialect) schemaTriggerQuery() string {
+	return fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_event_trigger WHERE evtname = %s AND evtenabled <> 'D')",
+		pq.QuoteLiteral(schemaChangeChannel))
+}
+
+// listenSchemaChanges listens on schemaChangeChannel on a connection of its
+// own. The connection is pinged while the schema is quiet so that losing
+// it is noticed.
+func (postgresDialect) listenSchemaChanges(ctx context.Context, dsn string) (<-chan struct{}, error) {
+	notifications := make(chan *pq.Notification, 32)
+	conn, err := pq.NewListenerConn(dsn, notifications)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Listen(schemaChangeChannel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		defer conn.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-notifications:
+				if !ok {
+					return
+				}
+				// A change is already pending when the channel is full
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			case <-time.After(time.Minute):
+				if err := conn.Ping(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+func (postgresDialect) CreateDatabaseStatements(dbName, user, password string) []Statement {
+	return []Statement{
+		{SQL: fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(dbName)), Action: "create database"},
+		{SQL: fmt.Sprintf("CREATE USER %s WITH PASSWORD %s", pq.QuoteIdentifier(user), pq.QuoteLiteral(password)), Action: "create user"},
+		// Make the new user the owner of the database
+		{SQL: fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(user)), Action: "set database owner"},
+	}
+}
+
+func (postgresDialect) DatabaseGrantStatements(dbName, user string) []Statement {
+	return []Statement{
+		{SQL: fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s TO %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(user)), Action: "grant database privileges"},
+	}
+}
+
+// CreateSchemaStatements creates the schemas other than public, which every
+// new database already has
+func (postgresDialect) CreateSchemaStatements(schemas []string, user string) []Statement {
+	var statements []Statement
+	for _, schema := range schemas {
+		if schema == "public" {
+			continue
+		}
+		statements = append(statements, Statement{
+			SQL:    fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s AUTHORIZATION %s", pq.QuoteIdentifier(schema), pq.QuoteIdentifier(user)),
+			Action: "create schema " + schema,
+		})
+	}
+	return statements
+}
+
+// SchemaGrantStatements grants privileges in public when no schema is given
+func (postgresDialect) SchemaGrantStatements(user string, schemas []string) []Statement {
+	if len(schemas) == 0 {
+		schemas = []string{"public"}
+	}
+	user = pq.QuoteIdentifier(user)
+
+	var statements []Statement
+	for _, name := range schemas {
+		schema := pq.QuoteIdentifier(name)
+		statements = append(statements,
+			// Schema-level privileges and everything that already exists in the schema
+			Statement{SQL: fmt.Sprintf("GRANT ALL ON SCHEMA %s TO %s", schema, user), Action: "grant privileges on schema " + name},
+			Statement{SQL: fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA %s TO %s", schema, user), Action: "grant table privileges in schema " + name},
+			Statement{SQL: fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA %s TO %s", schema, user), Action: "grant sequence privileges in schema " + name},
+			Statement{SQL: fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL FUNCTIONS IN SCHEMA %s TO %s", schema, user), Action: "grant function privileges in schema " + name},
+			// Default privileges for future objects created in the schema
+			Statement{SQL: fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %s GRANT ALL ON TABLES TO %s", schema, user), Action: "set default table privileges in schema " + name},
+			Statement{SQL: fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %s GRANT ALL ON SEQUENCES TO %s", schema, user), Action: "set default sequence privileges in schema " + name},
+			Statement{SQL: fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %s GRANT ALL ON FUNCTIONS TO %s", schema, user), Action: "set default function privileges in schema " + name},
+		)
+	}
+	return statements
+}
+
+func (d postgresDialect) TableGrantStatements(dbName string, table TableName, user string) []Statement {
+	return []Statement{
+		{SQL: fmt.Sprintf("GRANT ALL PRIVILEGES ON TABLE %s TO %s", QuoteTable(d, table), pq.QuoteIdentifier(user)), Action: "grant privileges on table " + table.String()},
+	}
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteDialect implements Dialect for local SQLite files using the pure Go
+// modernc.org/sqlite driver. The database name is the path of the file.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string            { return "SQLite" }
+func (sqliteDialect) DriverName() string      { return "sqlite" }
+func (sqliteDialect) DefaultPort() string     { return "" }
+func (sqliteDialect) DefaultUser() string     { return "" }
+func (sqliteDialect) DefaultDatabase() string { return "" }
+func (sqliteDialect) FileBased() bool         { return true }
+
+// DSN opens the file read-write, or read-only for ReadOnly, without creating
+// it, so a mistyped path is reported instead of silently producing an empty
+// database. SSL settings do not apply to local files and are ignored, extra
+// params such as _pragma are passed to the driver as URI parameters.
+func (sqliteDialect) DSN(p ConnParams) (string, error) {
+	path := p.DBName
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	mode := "rw"
+	if p.ReadOnly {
+		mode = "ro"
+	}
+	query := url.Values{"mode": {mode}}
+	for _, key := range p.paramKeys() {
+		query.Set(key, p.Params[key])
+	}
+	return "file:" + (&url.URL{Path: filepath.ToSlash(path)}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+func (sqliteDialect) TranslateError(err error, p ConnParams) error {
+	dbname := p.DBName
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_CANTOPEN:
+			return fmt.Errorf("cannot open database file '%s' - check that the file exists and is readable", dbname)
+		case sqlite3.SQLITE_NOTADB:
+			return fmt.Errorf("file '%s' is not a SQLite database", dbname)
+		case sqlite3.SQLITE_PERM, sqlite3.SQLITE_READONLY:
+			return fmt.Errorf("permission denied: cannot open '%s' for writing", dbname)
+		}
+	}
+	return fmt.Errorf("database connection failed: %w", err)
+}
+
+func (sqliteDialect) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (sqliteDialect) ScriptSyntax() ScriptSyntax {
+	return ScriptSyntax{}
+}
+
+func (sqliteDialect) AbortsTransactionOnError() bool { return false }
+
+// ReadOnlySessionStatement is empty, read-only files are opened with
+// mode=ro instead
+func (sqliteDialect) ReadOnlySessionStatement() string { return "" }
+
+func (sqliteDialect) Placeholder(n int) string { return "?" }
+
+// ListDatabasesQuery lists the files of the main database and any attached
+// ones, which is what a connection names as its database. In-memory and
+// temporary databases have no file and are left out.
+func (sqliteDialect) ListDatabasesQuery() string {
+	return "SELECT file FROM pragma_database_list WHERE file <> '' ORDER BY seq"
+}
+
+// ListSchemasQuery is empty, attached databases are listed as databases
+func (sqliteDialect) ListSchemasQuery() string { return "" }
+
+func (sqliteDialect) SearchPathQuery() string { return "" }
+
+func (sqliteDialect) ListTablesQuery() string {
+	return `
+		SELECT '', name
+		FROM sqlite_master
+		WHERE type = 'table'
+		AND name NOT LIKE 'sqlite_%'
+		ORDER BY name
+	`
+}
+
+// ListColumnsQuery looks the table up in the main database when the schema
+// is empty
+func (sqliteDialect) ListColumnsQuery() string {
+	return "SELECT name FROM pragma_table_info(?2, COALESCE(NULLIF(?1, ''), 'main')) ORDER BY cid"
+}
+
+func (sqliteDialect) ListFunctionsQuery() string {
+	return "SELECT DISTINCT name FROM pragma_function_list ORDER BY name"
+}
+
+// ListKeysQuery reads the foreign keys, primary keys and unique constraints
+// from the table pragmas. A foreign key to the primary key of a table may
+// leave out the referenced columns.
+func (sqliteDialect) ListKeysQuery() string {
+	return `
+		SELECT m.name || '_fk' || f.id, 'f', '', m.name, f."from", '', f."table", COALESCE(f."to", ''), f.seq
+		FROM sqlite_master m, pragma_foreign_key_list(m.name) f
+		WHERE m.type = 'table'
+		UNION ALL
+		SELECT 'pk', 'p', '', m.name, p.name, '', '', '', p.pk
+		FROM sqlite_master m, pragma_table_info(m.name) p
+		WHERE m.type = 'table' AND p.pk > 0
+		UNION ALL
+		SELECT i.name, 'u', '', m.name, ii.name, '', '', '', ii.seqno
+		FROM sqlite_master m, pragma_index_list(m.name) i, pragma_index_info(i.name) ii
+		WHERE m.type = 'table' AND i."unique" = 1 AND i.origin = 'u'
+		ORDER BY 4, 1, 9
+	`
+}
+
+// SchemaFingerprintQuery uses the CREATE statements SQLite keeps for each
+// table and its indexes, which ALTER TABLE rewrites
+func (sqliteDialect) SchemaFingerprintQuery() string {
+	return `
+		SELECT '', m.name, m.sql || COALESCE((
+			SELECT group_concat(i.sql, ';')
+			FROM (SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = m.name ORDER BY name) i
+		), '')
+		FROM sqlite_master m
+		WHERE m.type = 'table'
+		AND m.name NOT LIKE 'sqlite_%'
+	`
+}
+
+// SQLite has no users or privileges, so there is nothing to create or grant
+
+func (sqliteDialect) CreateDatabaseStatements(dbName, user, password string) []Statement {
+	return nil
+}
+
+func (sqliteDialect) DatabaseGrantStatements(dbName, user string) []Statement {
+	return nil
+}
+
+func (sqliteDialect) CreateSchemaStatements(schemas []string, user string) []Statement {
+	return nil
+}
+
+func (sqliteDialect) SchemaGrantStatements(user string, schemas []string) []Statement {
+	return nil
+}
+
+func (sqliteDialect) TableGrantStatements(dbName string, table TableName, user string) []Statement {
+	return nil
+}
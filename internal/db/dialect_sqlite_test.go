@@ -0,0 +1,30 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSQLiteListDatabases(t *testing.T) {
+	dir := t.TempDir()
+	main, attached := filepath.Join(dir, "main.db"), filepath.Join(dir, "archive.db")
+	conn, err := sql.Open("sqlite", main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	if _, err := conn.Exec("ATTACH DATABASE ? AS archive", attached); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := ListDatabases(conn, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{main, attached}; !slices.Equal(names, want) {
+		t.Errorf("got %q, want the database files %q", names, want)
+	}
+}
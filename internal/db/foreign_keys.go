@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// ForeignKey is a foreign key from columns of a table to the matching
+// columns of the table it references
+type ForeignKey struct {
+	Name       string
+	Table      TableName
+	Columns    []string
+	RefTable   TableName
+	RefColumns []string
+}
+
+// loadKeys loads the primary, unique and foreign keys of every table. They
+// only improve the JOIN suggestions, so a database that does not let the
+// user read them leaves them empty instead of failing the load.
+func (sc *SchemaCache) loadKeys(ctx context.Context, db *sql.DB) error {
+	sc.PrimaryKeys = make(map[TableName][]string)
+	sc.UniqueKeys = make(map[TableName][][]string)
+	sc.ForeignKeys = nil
+
+	rows, err := db.QueryContext(ctx, sc.dialect.ListKeysQuery())
+	if err != nil {
+		return ctx.Err()
+	}
+	defer rows.Close()
+
+	type keyID struct {
+		table TableName
+		name  string
+	}
+	var uniqueOrder []keyID
+	uniques := make(map[keyID][]string)
+	foreign := make(map[keyID]int)
+
+	for rows.Next() {
+		var name, kind, column, refColumn string
+		var table, refTable TableName
+		var position int
+		if err := rows.Scan(&name, &kind, &table.Schema, &table.Name, &column, &refTable.Schema, &refTable.Name, &refColumn, &position); err != nil {
+			return err
+		}
+
+		id := keyID{table, name}
+		switch kind {
+		case "p":
+			sc.PrimaryKeys[table] = append(sc.PrimaryKeys[table], column)
+		case "u":
+			if _, seen := uniques[id]; !seen {
+				uniqueOrder = append(uniqueOrder, id)
+			}
+			uniques[id] = append(uniques[id], column)
+		case "f":
+			i, seen := foreign[id]
+			if !seen {
+				i = len(sc.ForeignKeys)
+				foreign[id] = i
+				sc.ForeignKeys = append(sc.ForeignKeys, ForeignKey{Name: name, Table: table, RefTable: refTable})
+			}
+			fk := &sc.ForeignKeys[i]
+			fk.Columns = append(fk.Columns, column)
+			fk.RefColumns = append(fk.RefColumns, refColumn)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range uniqueOrder {
+		sc.UniqueKeys[id.table] = append(sc.UniqueKeys[id.table], uniques[id])
+	}
+
+	// A foreign key written without its referenced columns references the
+	// primary key
+	for i := range sc.ForeignKeys {
+		fk := &sc.ForeignKeys[i]
+		primary := sc.PrimaryKeys[fk.RefTable]
+		for j, column := range fk.RefColumns {
+			if column == "" && j < len(primary) {
+				fk.RefColumns[j] = primary[j]
+			}
+		}
+	}
+	return nil
+}
+
+// isUniqueKey reports whether columns are the primary key or a unique key
+// of a table, so a row of another table matches at most one of its rows
+func (sc *SchemaCache) isUniqueKey(table TableName, columns []string) bool {
+	sameColumns := func(key []string) bool {
+		if len(key) != len(columns) {
+			return false
+		}
+		for _, column := range key {
+			if !slices.Contains(columns, column) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if sameColumns(sc.PrimaryKeys[table]) {
+		return true
+	}
+	return slices.ContainsFunc(sc.UniqueKeys[table], sameColumns)
+}
+
+// joins proposes complete JOIN targets, such as
+// "customers c ON c.id = orders.customer_id", for the tables related by a
+// foreign key to the tables already in the FROM clause. Tables the ones in
+// scope reference come first, as joining them keeps one row per row in
+// scope, then tables referencing them through a unique key, then the other
+// tables referencing them.
+func (c *completer) joins(ctx CompletionContext) {
+	sc := c.cache
+
+	type scoped struct {
+		table TableName
+		// name is how the ON clause refers to the table
+		name string
+	}
+	var scope []scoped
+	used := make(map[string]bool)
+	for _, ref := range ctx.Tables {
+		if ref.Alias != "" {
+			used[strings.ToLower(ref.Alias)] = true
+		}
+		if ref.Name == "" || (ref.keyword != "FROM" && ref.keyword != "JOIN") {
+			continue
+		}
+		used[strings.ToLower(ref.Name)] = true
+
+		table, ok := sc.resolve(ref.Schema, ref.Name)
+		if !ok {
+			continue
+		}
+		// The table is named as the catalog spells it, the alias as the
+		// query does
+		name := c.quoteAlias(ref.Alias)
+		if ref.Alias == "" {
+			name = c.quoteName(table.Name)
+			if ref.Schema != "" {
+				name = c.quoteName(table.Schema) + "." + name
+			}
+		}
+		scope = append(scope, scoped{table, name})
+	}
+
+	inScope := func(table TableName) bool {
+		return slices.ContainsFunc(scope, func(s scoped) bool { return s.table == table })
+	}
+
+	var parents, oneToOne, children []Completion
+	for _, s := range scope {
+		for _, fk := range sc.ForeignKeys {
+			// Skip the tables already joined, unless the key joins a table
+			// to itself
+			if fk.Table != fk.RefTable && inScope(fk.Table) && inScope(fk.RefTable) {
+				continue
+			}
+			if fk.Table == s.table {
+				alias := c.newAlias(fk.RefTable.Name, used)
+				join := Completion{Text: c.joinText(fk.RefTable, alias, fk.RefColumns, s.name, fk.Columns), Kind: CompletionJoin, Detail: fk.Name}
+				parents = append(parents, join)
+			}
+			if fk.RefTable == s.table {
+				alias := c.newAlias(fk.Table.Name, used)
+				join := Completion{Text: c.joinText(fk.Table, alias, fk.Columns, s.name, fk.RefColumns), Kind: CompletionJoin, Detail: fk.Name}
+				if sc.isUniqueKey(fk.Table, fk.Columns) {
+					oneToOne = append(oneToOne, join)
+				} else {
+					children = append(children, join)
+				}
+			}
+		}
+	}
+
+	for _, join := range slices.Concat(parents, oneToOne, children) {
+		c.add(join.Text, join.Kind, join.Detail)
+	}
+}
+
+// joinText builds "table alias ON alias.a = other.b AND ...", qualifying
+// the table with its schema when the search path does not find it
+func (c *completer) joinText(table TableName, alias string, columns []string, other string, otherColumns []string) string {
+	name := c.quoteName(table.Name)
+	if found, ok := c.cache.resolve("", table.Name); table.Schema != "" && (!ok || found != table) {
+		name = c.quoteName(table.Schema) + "." + name
+	}
+
+	conditions := make([]string, len(columns))
+	for i := range columns {
+		conditions[i] = fmt.Sprintf("%s.%s = %s.%s", alias, c.quoteName(columns[i]), other, c.quoteName(otherColumns[i]))
+	}
+	return fmt.Sprintf("%s %s ON %s", name, alias, strings.Join(conditions, " AND "))
+}
+
+// newAlias makes an alias from the initials of a table name, such as oi for
+// order_items, that is not in use yet
+func (c *completer) newAlias(table string, used map[string]bool) string {
+	var initials strings.Builder
+	start := true
+	for _, r := range strings.ToLower(table) {
+		if !unicode.IsLetter(r) {
+			start = true
+			continue
+		}
+		if start {
+			initials.WriteRune(r)
+			start = false
+		}
+	}
+	base := initials.String()
+	if base == "" {
+		base = "t"
+	}
+
+	alias := base
+	for n := 2; used[alias] || notAliases[strings.ToUpper(alias)] || slices.Contains(c.cache.Keywords, strings.ToUpper(alias)); n++ {
+		alias = fmt.Sprintf("%s%d", base, n)
+	}
+	return alias
+}
+
+// quoteName quotes a name of the catalog that cannot be written without
+// quotes
+func (c *completer) quoteName(name string) string {
+	if isPlainIdentifier(name, c.cache.dialect.ScriptSyntax().FoldsToLower) {
+		return name
+	}
+	return c.cache.dialect.QuoteIdentifier(name)
+}
+
+// quoteAlias quotes an alias of the query that cannot be written without
+// quotes. Its case is kept as written.
+func (c *completer) quoteAlias(alias string) string {
+	if isPlainIdentifier(alias, false) {
+		return alias
+	}
+	return c.cache.dialect.QuoteIdentifier(alias)
+}
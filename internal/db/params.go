@@ -0,0 +1,141 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// paramRef is a placeholder found in a query
+type paramRef struct {
+	start, end int
+	// name is the placeholder as written, such as :user_id or $1
+	name string
+}
+
+// QueryParams returns the distinct placeholders of a query as written:
+// numbered ones such as $1 in order of their number, then named ones such
+// as :user_id in the order they first appear. Placeholders inside strings,
+// quoted names and comments are ignored, as are PostgreSQL :: casts.
+func QueryParams(query string, syntax ScriptSyntax) []string {
+	var numbered, named []string
+	seen := make(map[string]bool)
+	for _, ref := range findParams(query, syntax) {
+		if seen[ref.name] {
+			continue
+		}
+		seen[ref.name] = true
+		if ref.name[0] == '$' {
+			numbered = append(numbered, ref.name)
+		} else {
+			named = append(named, ref.name)
+		}
+	}
+	sort.Slice(numbered, func(i, j int) bool {
+		a, _ := strconv.Atoi(numbered[i][1:])
+		b, _ := strconv.Atoi(numbered[j][1:])
+		return a < b
+	})
+	return append(numbered, named...)
+}
+
+// BindParams replaces the placeholders of a query with the placeholders of
+// the dialect driver and returns the arguments to pass along with it, taking
+// each from values by the name QueryParams gives it. Values are bound as
+// text and never written into the query.
+func BindParams(query string, dialect Dialect, values map[string]string) (string, []any, error) {
+	var b strings.Builder
+	var args []any
+	last := 0
+	for _, ref := range findParams(query, dialect.ScriptSyntax()) {
+		value, ok := values[ref.name]
+		if !ok {
+			return "", nil, fmt.Errorf("no value given for %s", ref.name)
+		}
+		args = append(args, value)
+		b.WriteString(query[last:ref.start])
+		b.WriteString(dialect.Placeholder(len(args)))
+		last = ref.end
+	}
+	b.WriteString(query[last:])
+	return b.String(), args, nil
+}
+
+// findParams returns the placeholders of a query in order, following the
+// quoting and comment rules of syntax
+func findParams(query string, syntax ScriptSyntax) []paramRef {
+	var refs []paramRef
+	for i := 0; i < len(query); {
+		c := query[i]
+		next := byte(0)
+		if i+1 < len(query) {
+			next = query[i+1]
+		}
+		// Placeholders never continue a word, so a[lo:hi] is left alone
+		wordBefore := identBefore(query, i)
+
+		switch {
+		case c == '\'':
+			escapes := syntax.BackslashEscapes || (syntax.EscapeStrings && isEscapeStringPrefix(query, i))
+			i = skipQuoted(query, i, '\'', escapes)
+		case c == '"':
+			i = skipQuoted(query, i, '"', syntax.BackslashEscapes)
+		case c == '`':
+			i = skipQuoted(query, i, '`', false)
+		case c == '-' && next == '-', c == '#' && syntax.HashComments:
+			i = skipLine(query, i)
+		case c == '/' && next == '*':
+			i = skipBlockComment(query, i, syntax.NestedComments)
+		case c == ':' && next == ':':
+			// A PostgreSQL cast such as id::text
+			i += 2
+		case c == ':' && isParamStart(query[i+1:]) && !wordBefore:
+			end := i + 1
+			for end < len(query) && query[end] != '$' {
+				width := identWidth(query, end)
+				if width == 0 {
+					break
+				}
+				end += width
+			}
+			refs = append(refs, paramRef{start: i, end: end, name: query[i:end]})
+			i = end
+		case c == '$' && isDigit(next) && !wordBefore:
+			end := i + 1
+			for end < len(query) && isDigit(query[end]) {
+				end++
+			}
+			refs = append(refs, paramRef{start: i, end: end, name: query[i:end]})
+			i = end
+		case c == '$' && syntax.DollarQuotes:
+			if tag, ok := dollarTag(query, i); ok {
+				end := strings.Index(query[i+len(tag):], tag)
+				if end < 0 {
+					return refs
+				}
+				i += len(tag) + end + len(tag)
+				continue
+			}
+			i++
+		case identWidth(query, i) > 0:
+			i = skipIdent(query, i)
+		default:
+			i++
+		}
+	}
+	return refs
+}
+
+// isParamStart reports whether s starts with a character that can start
+// the name of a :name placeholder
+func isParamStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
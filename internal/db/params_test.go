@@ -0,0 +1,81 @@
+package db
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestQueryParams(t *testing.T) {
+	postgres := postgresDialect{}.ScriptSyntax()
+	mysql := mysqlDialect{}.ScriptSyntax()
+	tests := []struct {
+		syntax ScriptSyntax
+		query  string
+		want   []string
+	}{
+		{postgres, "SELECT * FROM t WHERE id = :id AND name = :name", []string{":id", ":name"}},
+		// Numbered placeholders come first, by number, and each name once
+		{postgres, "SELECT :b, $2, :a, $1, :b, $2", []string{"$1", "$2", ":b", ":a"}},
+		// Casts and array slices are not placeholders
+		{postgres, "SELECT id::text, :id::int FROM t", []string{":id"}},
+		{postgres, "SELECT arr[1:2], arr[lo:hi], arr[lo:hi][1:2] FROM t", nil},
+		{postgres, "SELECT x:id, y$1 FROM t", nil},
+		// Nor is anything inside strings, quoted names and comments
+		{postgres, "SELECT ':a', E'\\':b', \":c\", $$ :d $$, $tag$ :e $tag$ -- :f\n/* :g /* :h */ */ FROM t", nil},
+		{mysql, "SELECT ':a', \":b\", `:c`, 'it\\'s :d' # :e\nFROM t WHERE x = :f", []string{":f"}},
+		// MySQL has no dollar quoting
+		{mysql, "SELECT $$ :a $$", []string{":a"}},
+		{postgres, "SELECT :ünïcode, :_x1", []string{":ünïcode", ":_x1"}},
+		// An unterminated string hides what follows it
+		{postgres, "SELECT :a, ':b", []string{":a"}},
+	}
+
+	for _, test := range tests {
+		if got := QueryParams(test.query, test.syntax); !slices.Equal(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	values := map[string]string{":id": "7", ":name": "ann", "$1": "first", "$2": "second"}
+	tests := []struct {
+		dialect Dialect
+		query   string
+		want    string
+		args    []any
+	}{
+		{postgresDialect{}, "SELECT * FROM t WHERE id = :id::int", "SELECT * FROM t WHERE id = $1::int", []any{"7"}},
+		{postgresDialect{}, "SELECT arr[1:2] FROM t WHERE id = :id", "SELECT arr[1:2] FROM t WHERE id = $1", []any{"7"}},
+		{postgresDialect{}, "SELECT ':id' FROM t -- :id\nWHERE name = :name", "SELECT ':id' FROM t -- :id\nWHERE name = $1", []any{"ann"}},
+		// A repeated name is bound once per use
+		{postgresDialect{}, "SELECT :name, :id, :name", "SELECT $1, $2, $3", []any{"ann", "7", "ann"}},
+		// Numbered placeholders are renumbered in the order they appear
+		{postgresDialect{}, "SELECT $2, $1, $2", "SELECT $1, $2, $3", []any{"second", "first", "second"}},
+		{postgresDialect{}, "SELECT $1, :id", "SELECT $1, $2", []any{"first", "7"}},
+		{mysqlDialect{}, "SELECT * FROM t WHERE id = :id AND name = :name", "SELECT * FROM t WHERE id = ? AND name = ?", []any{"7", "ann"}},
+		{mysqlDialect{}, "SELECT ':id', `:id`, $2, $1", "SELECT ':id', `:id`, ?, ?", []any{"second", "first"}},
+		{sqliteDialect{}, "SELECT * FROM t WHERE name = :name OR alias = :name", "SELECT * FROM t WHERE name = ? OR alias = ?", []any{"ann", "ann"}},
+		{sqliteDialect{}, "SELECT 1", "SELECT 1", nil},
+	}
+
+	for _, test := range tests {
+		got, args, err := BindParams(test.query, test.dialect, values)
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		if got != test.want || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%q: got %q %q, want %q %q", test.query, got, args, test.want, test.args)
+		}
+	}
+}
+
+func TestBindParamsMissingValue(t *testing.T) {
+	_, _, err := BindParams("SELECT :id, :name", postgresDialect{}, map[string]string{":id": "7"})
+	if err == nil || !strings.Contains(err.Error(), "no value given for :name") {
+		t.Errorf("got error %v, want one naming :name", err)
+	}
+}
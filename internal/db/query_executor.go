@@ -1,132 +1,360 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
+// MaxResultRows is the number of rows kept from a query, to prevent
+// overwhelming output
+const MaxResultRows = 100
+
+// Column describes a result column as reported by the driver
+type Column struct {
+	Name string
+	// DatabaseType is the type name from the driver, such as INT4 or VARCHAR
+	DatabaseType string
+
+	// Nullable is only meaningful when NullableKnown is set
+	Nullable      bool
+	NullableKnown bool
+
+	// Length is the size of variable-length types such as VARCHAR, when
+	// HasLength is set
+	Length    int64
+	HasLength bool
+
+	// Precision and Scale describe decimal types, when HasPrecision is set
+	Precision    int64
+	Scale        int64
+	HasPrecision bool
+}
+
+// ResultSet holds the columns and rows returned by a query. Each value is nil
+// for NULL, or an int64, float64, bool, string, time.Time, or []byte for
+// binary data.
+type ResultSet struct {
+	Columns []Column
+	Rows    [][]any
+	// Truncated is set when the query returned more than MaxResultRows rows
+	Truncated bool
+}
+
 // QueryResult represents the result of a SQL query execution
 type QueryResult struct {
-	Success  bool
-	Data     string
+	// Statement is the SQL that was run
+	Statement string
+	Success   bool
+	// Data holds the rows of a statement that returns them, and is nil for
+	// statements run with Exec
+	Data     *ResultSet
 	Error    string
 	RowCount int
+	// RowsAffected is the number of rows changed by an INSERT, UPDATE,
+	// DELETE or similar statement, when HasRowsAffected is set
+	RowsAffected    int64
+	HasRowsAffected bool
+	// CommandTag summarizes a statement run with Exec, such as "UPDATE 3" or
+	// "CREATE TABLE"
+	CommandTag string
+	// Elapsed is how long the query took, including reading the rows
+	Elapsed time.Duration
 }
 
-// ExecuteQuery executes a SQL query and returns formatted results
+// ScriptResult holds the results of the statements of a script, in order
+type ScriptResult struct {
+	Results []QueryResult
+	// Skipped is the number of statements not run because an earlier one
+	// failed or the script was canceled
+	Skipped int
+}
+
+// Failed returns the number of statements that failed
+func (r ScriptResult) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if !result.Success {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Queryer runs statements. It is satisfied by *sql.DB, by *sql.Conn for
+// statements that must share a connection, and by *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// ExecuteQuery executes a SQL query and returns its columns and rows
 func ExecuteQuery(db *sql.DB, query string) QueryResult {
+	return ExecuteQueryContext(context.Background(), db, query)
+}
+
+// ExecuteQueryContext executes a SQL query with optional bound arguments and
+// returns its columns and rows. When ctx is canceled or its deadline passes
+// the query is abandoned; the PostgreSQL driver also sends a cancel request
+// so the server stops working on it.
+func ExecuteQueryContext(ctx context.Context, db Queryer, query string, args ...any) QueryResult {
+	start := time.Now()
+
 	// Execute the query
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return QueryResult{
-			Success: false,
-			Error:   fmt.Sprintf("Error executing query:\n%s", err.Error()),
+			Statement: query,
+			Success:   false,
+			Error:     queryErrorMessage(ctx, "Error executing query", err),
+			Elapsed:   time.Since(start),
 		}
 	}
 	defer rows.Close()
 
-	// Get column names
-	columns, err := rows.Columns()
+	data, err := scanResultSet(rows)
 	if err != nil {
 		return QueryResult{
-			Success: false,
-			Error:   fmt.Sprintf("Error getting columns:\n%s", err.Error()),
+			Statement: query,
+			Success:   false,
+			Error:     queryErrorMessage(ctx, "Error reading results", err),
+			Elapsed:   time.Since(start),
 		}
 	}
 
-	// Build results table
-	var result strings.Builder
-	result.WriteString("Query executed successfully!\n\n")
+	return QueryResult{
+		Statement: query,
+		Success:   true,
+		Data:      data,
+		RowCount:  len(data.Rows),
+		Elapsed:   time.Since(start),
+	}
+}
+
+// ExecContext runs a statement that returns no rows and reports the rows it
+// affected together with its command tag
+func ExecContext(ctx context.Context, db Queryer, statement string, args ...any) QueryResult {
+	start := time.Now()
+
+	res, err := db.ExecContext(ctx, statement, args...)
+	if err != nil {
+		return QueryResult{
+			Statement: statement,
+			Success:   false,
+			Error:     queryErrorMessage(ctx, "Error executing statement", err),
+			Elapsed:   time.Since(start),
+		}
+	}
+
+	result := QueryResult{Statement: statement, Success: true}
+	if affected, err := res.RowsAffected(); err == nil {
+		result.RowsAffected, result.HasRowsAffected = affected, true
+	}
+	result.CommandTag = commandTag(statement, result.RowsAffected, result.HasRowsAffected)
+	result.Elapsed = time.Since(start)
+	return result
+}
+
+// ExecuteScriptContext splits a script into statements and runs them in
+// order, with Query for statements that return rows and Exec for the rest.
+// After a failure the remaining statements are skipped unless
+// continueOnError is set; they are always skipped once ctx is done.
+func ExecuteScriptContext(ctx context.Context, db Queryer, dbType, script string, continueOnError bool) (ScriptResult, error) {
+	dialect, err := GetDialect(dbType)
+	if err != nil {
+		return ScriptResult{}, err
+	}
+
+	statements := SplitStatements(script, dialect.ScriptSyntax())
+	var results ScriptResult
+	for i, statement := range statements {
+		result := runStatement(ctx, db, dialect.ScriptSyntax(), statement)
+		results.Results = append(results.Results, result)
+
+		if !result.Success && (!continueOnError || ctx.Err() != nil) {
+			results.Skipped = len(statements) - i - 1
+			break
+		}
+	}
+	return results, nil
+}
+
+// runStatement runs a single statement with Query or Exec, depending on
+// whether it returns rows
+func runStatement(ctx context.Context, db Queryer, syntax ScriptSyntax, statement string, args ...any) QueryResult {
+	if returnsRows(statement, syntax) {
+		return ExecuteQueryContext(ctx, db, statement, args...)
+	}
+	return ExecContext(ctx, db, statement, args...)
+}
+
+// returnsRows reports whether a statement should be run with Query. Data
+// changing statements with a RETURNING clause return rows too; the clause
+// is looked for outside strings, quoted names and comments.
+func returnsRows(statement string, syntax ScriptSyntax) bool {
+	switch firstKeyword(statement) {
+	case "SELECT", "WITH", "SHOW", "EXPLAIN", "VALUES", "TABLE", "PRAGMA",
+		"DESCRIBE", "DESC", "CALL", "FETCH", "CHECK", "ANALYZE":
+		return true
+	}
+	return indexWord(tokenize(statement, syntax), "RETURNING") >= 0
+}
 
-	// Create header
-	header := "│"
-	for _, col := range columns {
-		header += fmt.Sprintf(" %-15s │", col)
+// commandTag builds a psql style summary of a statement run with Exec: the
+// verb, the object type for DDL, and the row count for statements that
+// change rows
+func commandTag(statement string, rowsAffected int64, hasRowsAffected bool) string {
+	words := strings.Fields(strings.ToUpper(skipOpening(statement)))
+	if len(words) == 0 {
+		return ""
 	}
-	result.WriteString(header + "\n")
 
-	// Create separator
-	separator := "├"
-	for i := 0; i < len(columns); i++ {
-		separator += strings.Repeat("─", 17)
-		if i < len(columns)-1 {
-			separator += "┼"
+	verb := strings.TrimRight(words[0], ";(")
+	switch verb {
+	case "INSERT", "UPDATE", "DELETE", "MERGE", "REPLACE", "COPY":
+		if hasRowsAffected {
+			return fmt.Sprintf("%s %d", verb, rowsAffected)
+		}
+	case "CREATE", "DROP", "ALTER":
+		for _, word := range words[1:] {
+			// Skip modifiers such as OR REPLACE, and MySQL options such as
+			// DEFINER=user
+			switch word {
+			case "OR", "REPLACE", "UNIQUE", "TEMP", "TEMPORARY", "UNLOGGED", "GLOBAL", "LOCAL":
+				continue
+			}
+			if strings.Contains(word, "=") {
+				continue
+			}
+			return verb + " " + word
 		}
 	}
-	separator += "┤"
-	result.WriteString(separator + "\n")
+	return verb
+}
+
+// firstKeyword returns the first word of a statement in upper case, inside
+// the parentheses a query such as (SELECT 1) may open with
+func firstKeyword(statement string) string {
+	statement = skipOpening(statement)
+	end := strings.IndexFunc(statement, func(r rune) bool {
+		return !(r == '_' || unicode.IsLetter(r))
+	})
+	if end < 0 {
+		end = len(statement)
+	}
+	return strings.ToUpper(statement[:end])
+}
+
+// skipOpening drops the spaces and opening parentheses before the first
+// word of a statement
+func skipOpening(statement string) string {
+	return strings.TrimLeftFunc(statement, func(r rune) bool {
+		return r == '(' || unicode.IsSpace(r)
+	})
+}
+
+// queryErrorMessage describes a failed query. A query stopped by ctx is
+// reported as canceled or timed out rather than with the driver error,
+// which varies between engines.
+func queryErrorMessage(ctx context.Context, prefix string, err error) string {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "Query timed out and was canceled"
+	case errors.Is(ctx.Err(), context.Canceled):
+		return "Query canceled"
+	}
+	return fmt.Sprintf("%s:\n%s", prefix, err.Error())
+}
+
+// scanResultSet reads the column metadata and up to MaxResultRows rows
+func scanResultSet(rows *sql.Rows) (*ResultSet, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	data := &ResultSet{Columns: make([]Column, len(columnTypes))}
+	for i, ct := range columnTypes {
+		col := Column{Name: ct.Name(), DatabaseType: strings.ToUpper(ct.DatabaseTypeName())}
+		col.Nullable, col.NullableKnown = ct.Nullable()
+		col.Length, col.HasLength = ct.Length()
+		col.Precision, col.Scale, col.HasPrecision = ct.DecimalSize()
+		data.Columns[i] = col
+	}
 
-	// Process rows
-	rowCount := 0
 	for rows.Next() {
-		// Create a slice of interface{} to hold the values
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range columns {
-			valuePtrs[i] = &values[i]
+		if len(data.Rows) == MaxResultRows {
+			data.Truncated = true
+			break
 		}
 
-		// Scan the row
+		values := make([]any, len(data.Columns))
+		valuePtrs := make([]any, len(data.Columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return QueryResult{
-				Success: false,
-				Error:   fmt.Sprintf("Error scanning row:\n%s", err.Error()),
-			}
+			return nil, err
 		}
 
-		// Build row string
-		rowStr := "│"
-		for _, val := range values {
-			cellValue := "NULL"
-			if val != nil {
-				// Handle different data types properly
-				switch v := val.(type) {
-				case []byte:
-					// Convert byte array to string
-					cellValue = string(v)
-				case string:
-					cellValue = v
-				case int64:
-					cellValue = fmt.Sprintf("%d", v)
-				case float64:
-					cellValue = fmt.Sprintf("%.2f", v)
-				case bool:
-					cellValue = fmt.Sprintf("%t", v)
-				default:
-					// For other types, use string representation
-					cellValue = fmt.Sprintf("%v", v)
-				}
-
-				// Truncate long values
-				if len(cellValue) > 15 {
-					cellValue = cellValue[:12] + "..."
-				}
-			}
-			rowStr += fmt.Sprintf(" %-15s │", cellValue)
+		for i, value := range values {
+			values[i] = normalizeValue(value, data.Columns[i].DatabaseType)
 		}
-		result.WriteString(rowStr + "\n")
-		rowCount++
+		data.Rows = append(data.Rows, values)
+	}
+	return data, rows.Err()
+}
 
-		// Limit results to prevent overwhelming output
-		if rowCount >= 100 {
-			result.WriteString("\n... (showing first 100 rows only)\n")
-			break
-		}
+// normalizeValue converts the raw bytes some drivers return, such as MySQL
+// over the text protocol, into the Go type matching the column type.
+// Decimals stay strings so no precision is lost.
+func normalizeValue(value any, databaseType string) any {
+	b, ok := value.([]byte)
+	if !ok {
+		return value
 	}
 
-	if err := rows.Err(); err != nil {
-		return QueryResult{
-			Success: false,
-			Error:   fmt.Sprintf("Error iterating rows:\n%s", err.Error()),
+	switch {
+	case isBinaryType(databaseType):
+		return b
+	case isIntegerType(databaseType):
+		if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n
+		}
+	case isFloatType(databaseType):
+		if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+			return f
 		}
 	}
+	return string(b)
+}
+
+func isBinaryType(databaseType string) bool {
+	switch databaseType {
+	case "BYTEA", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BIT":
+		return true
+	}
+	return false
+}
 
-	result.WriteString(fmt.Sprintf("\nTotal rows: %d", rowCount))
+func isIntegerType(databaseType string) bool {
+	databaseType = strings.TrimPrefix(databaseType, "UNSIGNED ")
+	switch databaseType {
+	case "INT", "INT2", "INT4", "INT8", "INTEGER", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT", "YEAR":
+		return true
+	}
+	return false
+}
 
-	return QueryResult{
-		Success:  true,
-		Data:     result.String(),
-		RowCount: rowCount,
+func isFloatType(databaseType string) bool {
+	switch databaseType {
+	case "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "REAL":
+		return true
 	}
+	return false
 }
@@ -1,32 +1,62 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
+	"sync"
 )
 
-// SchemaCache holds cached database schema information for autocomplete
+// SchemaCache holds cached database schema information for autocomplete.
+// A SchemaWatcher may reload it while it is in use, so read it through its
+// methods rather than its fields once it is watched.
 type SchemaCache struct {
-	Tables      []string
-	Columns     map[string][]string // table -> columns
+	// Tables are the tables that can be named without a schema: those of
+	// the search path, or every table for engines without schemas
+	Tables []string
+	// Schemas are the schemas of the database, none for engines without them
+	Schemas []string
+	// SearchPath are the schemas unqualified names are looked up in, in order
+	SearchPath []string
+	Columns    map[TableName][]string // table -> columns
+	// PrimaryKeys and UniqueKeys hold the key columns of each table, and
+	// ForeignKeys the foreign keys between tables, for JOIN suggestions
+	PrimaryKeys map[TableName][]string
+	UniqueKeys  map[TableName][][]string
+	ForeignKeys []ForeignKey
 	Functions   []string
 	Keywords    []string
 	DataTypes   []string
+	dialect     Dialect
+	allTables   []TableName
 	initialized bool
+	// mu guards the fields above against a reload in the background
+	mu sync.RWMutex
 }
 
 // NewSchemaCache creates a new schema cache and loads the database schema
-func NewSchemaCache(db *sql.DB) (*SchemaCache, error) {
+func NewSchemaCache(db *sql.DB, dbType string) (*SchemaCache, error) {
+	return NewSchemaCacheContext(context.Background(), db, dbType)
+}
+
+// NewSchemaCacheContext is NewSchemaCache, stopped when ctx is done
+func NewSchemaCacheContext(ctx context.Context, db *sql.DB, dbType string) (*SchemaCache, error) {
+	dialect, err := GetDialect(dbType)
+	if err != nil {
+		return nil, err
+	}
+
 	cache := &SchemaCache{
+		dialect:   dialect,
 		Tables:    []string{},
-		Columns:   make(map[string][]string),
+		Columns:   make(map[TableName][]string),
 		Functions: []string{},
 		Keywords:  []string{},
 		DataTypes: []string{},
 	}
 
-	if err := cache.LoadSchema(db); err != nil {
+	if err := cache.LoadSchemaContext(ctx, db); err != nil {
 		return nil, fmt.Errorf("failed to load schema: %w", err)
 	}
 
@@ -35,112 +65,216 @@ func NewSchemaCache(db *sql.DB) (*SchemaCache, error) {
 
 // LoadSchema loads the database schema into the cache
 func (sc *SchemaCache) LoadSchema(db *sql.DB) error {
+	return sc.LoadSchemaContext(context.Background(), db)
+}
+
+// LoadSchemaContext is LoadSchema, stopped when ctx is done. The schema is
+// loaded aside and swapped in at the end, so the cache can be read while
+// it loads.
+func (sc *SchemaCache) LoadSchemaContext(ctx context.Context, db *sql.DB) error {
+	next := &SchemaCache{dialect: sc.dialect, Columns: make(map[TableName][]string)}
+	if err := next.load(ctx, db); err != nil {
+		return err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.Tables = next.Tables
+	sc.Schemas = next.Schemas
+	sc.SearchPath = next.SearchPath
+	sc.Columns = next.Columns
+	sc.PrimaryKeys = next.PrimaryKeys
+	sc.UniqueKeys = next.UniqueKeys
+	sc.ForeignKeys = next.ForeignKeys
+	sc.Functions = next.Functions
+	sc.Keywords = next.Keywords
+	sc.DataTypes = next.DataTypes
+	sc.allTables = next.allTables
+	sc.initialized = true
+	return nil
+}
+
+// load loads the whole schema into a cache nobody reads yet
+func (sc *SchemaCache) load(ctx context.Context, db *sql.DB) error {
+	// Load schemas and the search path
+	if err := sc.loadSchemas(ctx, db); err != nil {
+		return fmt.Errorf("failed to load schemas: %w", err)
+	}
+
 	// Load tables
-	if err := sc.loadTables(db); err != nil {
+	if err := sc.loadTables(ctx, db); err != nil {
 		return fmt.Errorf("failed to load tables: %w", err)
 	}
 
 	// Load columns for each table
-	if err := sc.loadColumns(db); err != nil {
+	if err := sc.loadColumns(ctx, db); err != nil {
 		return fmt.Errorf("failed to load columns: %w", err)
 	}
 
+	// Load primary, unique and foreign keys
+	if err := sc.loadKeys(ctx, db); err != nil {
+		return fmt.Errorf("failed to load keys: %w", err)
+	}
+
 	// Load functions
-	if err := sc.loadFunctions(db); err != nil {
+	if err := sc.loadFunctions(ctx, db); err != nil {
 		return fmt.Errorf("failed to load functions: %w", err)
 	}
 
 	// Set predefined keywords and data types
 	sc.setPredefinedData()
-
-	sc.initialized = true
 	return nil
 }
 
-// loadTables loads all table names from the database
-func (sc *SchemaCache) loadTables(db *sql.DB) error {
-	query := `
-		SELECT table_name 
-		FROM information_schema.tables 
-		WHERE table_schema = 'public' 
-		ORDER BY table_name
-	`
+// loadSchemas loads the schemas and the search path of engines with schemas
+func (sc *SchemaCache) loadSchemas(ctx context.Context, db *sql.DB) error {
+	if sc.dialect.ListSchemasQuery() == "" {
+		return nil
+	}
+
+	schemas, err := queryStrings(ctx, db, sc.dialect.ListSchemasQuery())
+	if err != nil {
+		return err
+	}
+	searchPath, err := queryStrings(ctx, db, sc.dialect.SearchPathQuery())
+	if err != nil {
+		return err
+	}
+	sc.Schemas = schemas
+	sc.SearchPath = searchPath
+	return nil
+}
 
-	rows, err := db.Query(query)
+// loadTables loads the tables of every schema from the database
+func (sc *SchemaCache) loadTables(ctx context.Context, db *sql.DB) error {
+	tables, err := queryTables(ctx, db, sc.dialect)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
+	sc.allTables = tables
+	sc.setSearchPath(sc.SearchPath)
+	return nil
+}
 
-	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
-			return err
+// SetSearchPath changes the schemas unqualified names are looked up in, as
+// after SET search_path, and the Tables that follow from them
+func (sc *SchemaCache) SetSearchPath(searchPath []string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.setSearchPath(searchPath)
+}
+
+func (sc *SchemaCache) setSearchPath(searchPath []string) {
+	sc.SearchPath = searchPath
+	sc.Tables = []string{}
+	seen := make(map[string]bool)
+	for _, schema := range sc.lookupSchemas() {
+		for _, table := range sc.allTables {
+			if table.Schema == schema && !seen[table.Name] {
+				seen[table.Name] = true
+				sc.Tables = append(sc.Tables, table.Name)
+			}
 		}
-		sc.Tables = append(sc.Tables, tableName)
 	}
+}
 
-	return rows.Err()
+// lookupSchemas returns the schemas unqualified names are looked up in,
+// the empty schema for engines without schemas
+func (sc *SchemaCache) lookupSchemas() []string {
+	if sc.dialect.ListSchemasQuery() == "" {
+		return []string{""}
+	}
+	return sc.SearchPath
 }
 
-// loadColumns loads column names for each table
-func (sc *SchemaCache) loadColumns(db *sql.DB) error {
-	for _, table := range sc.Tables {
-		query := `
-			SELECT column_name 
-			FROM information_schema.columns 
-			WHERE table_schema = 'public' 
-			AND table_name = $1 
-			ORDER BY ordinal_position
-		`
-
-		rows, err := db.Query(query, table)
-		if err != nil {
-			continue // Skip tables that can't be queried
+// TableCount returns the number of tables that can be named without a
+// schema
+func (sc *SchemaCache) TableCount() int {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return len(sc.Tables)
+}
+
+// TablesIn returns the tables of a schema
+func (sc *SchemaCache) TablesIn(schema string) []string {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.tablesIn(schema)
+}
+
+func (sc *SchemaCache) tablesIn(schema string) []string {
+	var tables []string
+	for _, table := range sc.allTables {
+		if table.Schema == schema {
+			tables = append(tables, table.Name)
 		}
+	}
+	return tables
+}
+
+// Resolve finds the table a possibly qualified name refers to, looking an
+// unqualified name up in the search path. Names match without regard to
+// case when there is no exact match.
+func (sc *SchemaCache) Resolve(schema, name string) (TableName, bool) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.resolve(schema, name)
+}
+
+func (sc *SchemaCache) resolve(schema, name string) (TableName, bool) {
+	schemas := sc.lookupSchemas()
+	if schema != "" {
+		schemas = []string{schema}
+	}
 
-		var columns []string
-		for rows.Next() {
-			var columnName string
-			if err := rows.Scan(&columnName); err != nil {
-				rows.Close()
-				continue
+	for _, exact := range []bool{true, false} {
+		for _, s := range schemas {
+			for _, table := range sc.allTables {
+				if matchName(table.Schema, s, exact) && matchName(table.Name, name, exact) {
+					return table, true
+				}
 			}
-			columns = append(columns, columnName)
 		}
-		rows.Close()
+	}
+	return TableName{}, false
+}
+
+func matchName(a, b string, exact bool) bool {
+	if exact {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
 
+// loadColumns loads column names for each table
+func (sc *SchemaCache) loadColumns(ctx context.Context, db *sql.DB) error {
+	for _, table := range sc.allTables {
+		columns, err := sc.tableColumns(ctx, db, table)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue // Skip tables that can't be queried
+		}
 		sc.Columns[table] = columns
 	}
 
 	return nil
 }
 
+// tableColumns loads the column names of one table
+func (sc *SchemaCache) tableColumns(ctx context.Context, db *sql.DB, table TableName) ([]string, error) {
+	return queryStrings(ctx, db, sc.dialect.ListColumnsQuery(), table.Schema, table.Name)
+}
+
 // loadFunctions loads available database functions
-func (sc *SchemaCache) loadFunctions(db *sql.DB) error {
-	query := `
-		SELECT routine_name 
-		FROM information_schema.routines 
-		WHERE routine_schema = 'public' 
-		AND routine_type = 'FUNCTION'
-		ORDER BY routine_name
-	`
-
-	rows, err := db.Query(query)
+func (sc *SchemaCache) loadFunctions(ctx context.Context, db *sql.DB) error {
+	functions, err := queryStrings(ctx, db, sc.dialect.ListFunctionsQuery())
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var functionName string
-		if err := rows.Scan(&functionName); err != nil {
-			return err
-		}
-		sc.Functions = append(sc.Functions, functionName)
-	}
-
-	return rows.Err()
+	sc.Functions = functions
+	return nil
 }
 
 // setPredefinedData sets common SQL keywords and data types
@@ -162,132 +296,191 @@ func (sc *SchemaCache) setPredefinedData() {
 	}
 }
 
-// GetSuggestions returns autocomplete suggestions based on the current query and cursor position
+// GetSuggestions returns the text of the completions for the word at a byte
+// offset in a query, see Complete
 func (sc *SchemaCache) GetSuggestions(query string, cursorPos int) []string {
+	completions := sc.Complete(query, cursorPos)
+	suggestions := make([]string, len(completions))
+	for i, completion := range completions {
+		suggestions[i] = completion.Text
+	}
+	return suggestions
+}
+
+// Complete returns the completions for the word at a byte offset in a
+// query. What is suggested depends on where the word is: columns of the
+// tables in scope in a SELECT list or condition, tables after FROM, the
+// columns of an alias or table after "alias." and so on. Nothing is
+// suggested inside strings and comments.
+func (sc *SchemaCache) Complete(query string, cursorPos int) []Completion {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
 	if !sc.initialized {
-		return []string{}
+		return nil
 	}
 
-	var suggestions []string
-	queryLower := strings.ToLower(query)
+	ctx := AnalyzeCompletion(query, cursorPos, sc.dialect.ScriptSyntax())
+	if ctx.InLiteral {
+		return nil
+	}
 
-	// Get the current word being typed
-	currentWord := sc.getCurrentWord(query, cursorPos)
-	currentWordLower := strings.ToLower(currentWord)
+	c := completer{cache: sc, prefix: strings.ToLower(ctx.Word), quote: ctx.Quoted, seen: make(map[string]bool)}
+	c.lowerKeywords = ctx.Word != "" && ctx.Word == c.prefix && strings.ToUpper(ctx.Word) != ctx.Word
 
-	// If we're at the beginning or after common keywords, suggest tables
-	if sc.shouldSuggestTables(queryLower, cursorPos) {
-		for _, table := range sc.Tables {
-			if strings.HasPrefix(strings.ToLower(table), currentWordLower) {
-				suggestions = append(suggestions, table)
-			}
-		}
+	if len(ctx.Qualifier) > 0 {
+		c.qualified(ctx)
+		return c.items
 	}
 
-	// If we're after FROM or JOIN, suggest tables
-	if sc.isAfterFromOrJoin(queryLower, cursorPos) {
-		for _, table := range sc.Tables {
-			if strings.HasPrefix(strings.ToLower(table), currentWordLower) {
-				suggestions = append(suggestions, table)
+	switch ctx.Clause {
+	case ClauseStart:
+		c.keywords(statementVerbs)
+	case ClauseTable:
+		if ctx.Join {
+			c.joins(ctx)
+		}
+		for _, cte := range ctx.CTEs {
+			c.addName(cte, CompletionTable, "with", false)
+		}
+		c.tables()
+		for _, schema := range sc.Schemas {
+			c.add(schema, CompletionSchema, "")
+		}
+	case ClauseAlias:
+	case ClauseInsertColumns:
+		c.columns(*ctx.Target)
+	case ClauseSet:
+		if ctx.Target != nil {
+			c.columns(*ctx.Target)
+		}
+		c.functions()
+		c.keywords(sc.Keywords)
+	case ClauseSelect, ClauseCondition, ClauseGroupBy, ClauseOrderBy, ClauseReturning:
+		if ctx.Target != nil {
+			c.columns(*ctx.Target)
+		}
+		for _, ref := range ctx.Tables {
+			c.columns(ref)
+		}
+		for _, ref := range ctx.Tables {
+			if ref.Alias != "" {
+				c.add(ref.Alias, CompletionAlias, ref.Name)
 			}
 		}
+		c.tables()
+		c.functions()
+		c.keywords(sc.Keywords)
+	case ClauseAfterTable:
+		c.keywords(sc.Keywords)
+	default:
+		c.functions()
+		c.keywords(sc.Keywords)
+		c.keywords(sc.DataTypes)
 	}
+	return c.items
+}
 
-	// If we're after a table name, suggest columns
-	if tableName := sc.getTableNameBeforeCursor(query, cursorPos); tableName != "" {
-		if columns, exists := sc.Columns[tableName]; exists {
-			for _, column := range columns {
-				if strings.HasPrefix(strings.ToLower(column), currentWordLower) {
-					suggestions = append(suggestions, column)
-				}
-			}
-		}
+// completer collects the completions matching the typed prefix, dropping
+// duplicates and stopping at maxCompletions
+type completer struct {
+	cache         *SchemaCache
+	prefix        string
+	lowerKeywords bool
+	// quote is set when the word being completed is a quoted name
+	quote bool
+	seen  map[string]bool
+	items []Completion
+}
+
+func (c *completer) add(text string, kind CompletionKind, detail string) {
+	c.addName(text, kind, detail, kind != CompletionAlias)
+}
+
+// addName is add, where fromCatalog tells whether a name is spelled as the
+// catalog spells it, rather than as the query does like an alias or a WITH
+// query. Only catalog names holding upper-case letters need quotes on
+// engines that fold unquoted names to lower case.
+func (c *completer) addName(text string, kind CompletionKind, detail string, fromCatalog bool) {
+	if len(c.items) >= maxCompletions || !strings.HasPrefix(strings.ToLower(text), c.prefix) {
+		return
+	}
+	isName := kind == CompletionTable || kind == CompletionColumn || kind == CompletionAlias || kind == CompletionSchema
+	if c.quote && !isName {
+		return
+	}
+	foldsToLower := fromCatalog && c.cache.dialect.ScriptSyntax().FoldsToLower
+	if isName && (c.quote || !isPlainIdentifier(text, foldsToLower)) {
+		text = c.cache.dialect.QuoteIdentifier(text)
 	}
+	if c.seen[text] {
+		return
+	}
+	c.seen[text] = true
+	c.items = append(c.items, Completion{Text: text, Kind: kind, Detail: detail})
+}
 
-	// Suggest SQL keywords
-	for _, keyword := range sc.Keywords {
-		if strings.HasPrefix(strings.ToLower(keyword), currentWordLower) {
-			suggestions = append(suggestions, keyword)
-		}
+// qualified completes the word after "name." or "schema.table.": the
+// columns of an alias or table, or else the tables of a schema
+func (c *completer) qualified(ctx CompletionContext) {
+	q := ctx.Qualifier
+	name := q[len(q)-1]
+	if len(q) > 1 {
+		c.columns(TableRef{Schema: q[len(q)-2], Name: name})
+		return
 	}
 
-	// Suggest functions
-	for _, function := range sc.Functions {
-		if strings.HasPrefix(strings.ToLower(function), currentWordLower) {
-			suggestions = append(suggestions, function+"()")
+	for _, ref := range ctx.Tables {
+		if strings.EqualFold(ref.Alias, name) {
+			c.columns(ref)
+			return
 		}
 	}
-
-	// Limit suggestions to prevent overwhelming the user
-	if len(suggestions) > 20 {
-		suggestions = suggestions[:20]
+	if _, ok := c.cache.resolve("", name); ok {
+		c.columns(TableRef{Name: name})
+		return
+	}
+	for _, schema := range c.cache.Schemas {
+		if strings.EqualFold(schema, name) {
+			for _, table := range c.cache.tablesIn(schema) {
+				c.add(table, CompletionTable, schema)
+			}
+			return
+		}
 	}
-
-	return suggestions
 }
 
-// Helper methods for suggestion logic
-
-func (sc *SchemaCache) getCurrentWord(query string, cursorPos int) string {
-	if cursorPos <= 0 || cursorPos > len(query) {
-		return ""
+// columns adds the columns of a table, described by its alias or name
+func (c *completer) columns(ref TableRef) {
+	table, ok := c.cache.resolve(ref.Schema, ref.Name)
+	if !ok {
+		return
 	}
-
-	// Find the start of the current word
-	start := cursorPos - 1
-	for start >= 0 && (isAlphanumeric(query[start]) || query[start] == '_') {
-		start--
+	detail := ref.Name
+	if ref.Alias != "" {
+		detail = ref.Alias
 	}
-	start++
-
-	// Find the end of the current word
-	end := cursorPos
-	for end < len(query) && (isAlphanumeric(query[end]) || query[end] == '_') {
-		end++
+	for _, column := range c.cache.Columns[table] {
+		c.add(column, CompletionColumn, detail)
 	}
-
-	return query[start:end]
 }
 
-func (sc *SchemaCache) shouldSuggestTables(queryLower string, cursorPos int) bool {
-	// Check if we're at the beginning of the query or after common keywords
-	beforeCursor := queryLower[:cursorPos]
-
-	// Remove the current word being typed
-	words := strings.Fields(beforeCursor)
-	if len(words) == 0 {
-		return true
+func (c *completer) tables() {
+	for _, table := range c.cache.Tables {
+		c.add(table, CompletionTable, "")
 	}
-
-	lastWord := words[len(words)-1]
-	return lastWord == "from" || lastWord == "join" || lastWord == "update" || lastWord == "into"
 }
 
-func (sc *SchemaCache) isAfterFromOrJoin(queryLower string, cursorPos int) bool {
-	beforeCursor := queryLower[:cursorPos]
-	return strings.Contains(beforeCursor, " from ") || strings.Contains(beforeCursor, " join ")
+func (c *completer) functions() {
+	for _, function := range c.cache.Functions {
+		c.add(function, CompletionFunction, "")
+	}
 }
 
-func (sc *SchemaCache) getTableNameBeforeCursor(query string, cursorPos int) string {
-	beforeCursor := query[:cursorPos]
-	words := strings.Fields(beforeCursor)
-
-	// Look for table name after FROM or JOIN
-	for i, word := range words {
-		if (strings.ToLower(word) == "from" || strings.ToLower(word) == "join") && i+1 < len(words) {
-			// Check if the next word is a table name
-			nextWord := words[i+1]
-			for _, table := range sc.Tables {
-				if strings.EqualFold(table, nextWord) {
-					return table
-				}
-			}
+func (c *completer) keywords(keywords []string) {
+	for _, keyword := range keywords {
+		if c.lowerKeywords {
+			keyword = strings.ToLower(keyword)
 		}
+		c.add(keyword, CompletionKeyword, "")
 	}
-
-	return ""
-}
-
-func isAlphanumeric(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
 }
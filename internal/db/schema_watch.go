@@ -0,0 +1,318 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWatchInterval is how often a SchemaWatcher polls the database when
+// it is not notified of schema changes
+const DefaultWatchInterval = 10 * time.Second
+
+// WatchOptions configure SchemaCache.Watch
+type WatchOptions struct {
+	// Interval is the time between two polls, DefaultWatchInterval when zero
+	Interval time.Duration
+	// Notify listens to the trigger installed by InstallSchemaTrigger, when
+	// the database has it, so the watcher does not poll. The watcher polls
+	// when the trigger is missing or cannot be listened to.
+	Notify bool
+}
+
+// SchemaChange reports the tables a SchemaWatcher reloaded, or the error
+// that kept it from reloading them
+type SchemaChange struct {
+	// Tables were created, altered or dropped
+	Tables []TableName
+	Err    error
+}
+
+// schemaNotifier is implemented by dialects that can tell a SchemaWatcher
+// about schema changes instead of being polled
+type schemaNotifier interface {
+	// schemaTriggerStatements install the trigger sending the
+	// notifications, run while connected to the database
+	schemaTriggerStatements() []Statement
+	// dropSchemaTriggerStatements remove the trigger and what it uses
+	dropSchemaTriggerStatements() []Statement
+	// schemaTriggerQuery returns whether the trigger is installed and
+	// enabled, as a single boolean
+	schemaTriggerQuery() string
+	// listenSchemaChanges returns a channel that receives a value after
+	// schema changes and is closed when listening stops, because ctx is
+	// done or the connection was lost
+	listenSchemaChanges(ctx context.Context, dsn string) (<-chan struct{}, error)
+}
+
+// SchemaWatcher keeps a SchemaCache in step with the database. When told of
+// a change, or on every poll, it reads a fingerprint of each table and
+// reloads the tables whose fingerprint differs from the last one seen.
+type SchemaWatcher struct {
+	cache    *SchemaCache
+	db       *sql.DB
+	interval time.Duration
+	changes  chan SchemaChange
+	cancel   context.CancelFunc
+	// notified is set while the watcher listens to notifications
+	notified atomic.Bool
+	// fingerprints are the last ones read, owned by the watching goroutine
+	fingerprints map[TableName]string
+}
+
+// Watch starts watching the database the cache was loaded from, on db, for
+// schema changes. The changes must be received from Changes, and the
+// watcher closed once the cache is no longer used.
+func (sc *SchemaCache) Watch(db *sql.DB, opts WatchOptions) (*SchemaWatcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &SchemaWatcher{
+		cache:    sc,
+		db:       db,
+		interval: opts.Interval,
+		changes:  make(chan SchemaChange),
+		cancel:   cancel,
+	}
+	if w.interval <= 0 {
+		w.interval = DefaultWatchInterval
+	}
+
+	fingerprints, err := w.fingerprint(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to read the schema fingerprint: %w", err)
+	}
+	w.fingerprints = fingerprints
+
+	var notifications <-chan struct{}
+	if opts.Notify {
+		notifications = w.listen(ctx)
+	}
+	go w.run(ctx, notifications)
+	return w, nil
+}
+
+// Changes receives every reload of the cache, or failure to reload it, and
+// is closed once the watcher is
+func (w *SchemaWatcher) Changes() <-chan SchemaChange {
+	return w.changes
+}
+
+// Notified reports whether the watcher is notified of schema changes rather
+// than polling for them
+func (w *SchemaWatcher) Notified() bool {
+	return w.notified.Load()
+}
+
+// Close stops watching
+func (w *SchemaWatcher) Close() {
+	w.cancel()
+}
+
+// listen listens to the notifications of the trigger. It returns nil when
+// the trigger is not installed or cannot be listened to, and the watcher
+// has to poll.
+func (w *SchemaWatcher) listen(ctx context.Context) <-chan struct{} {
+	notifier, ok := w.cache.dialect.(schemaNotifier)
+	if !ok {
+		return nil
+	}
+	dsn, ok := dsns.Load(w.db)
+	if !ok {
+		return nil
+	}
+	var installed bool
+	if err := w.db.QueryRowContext(ctx, notifier.schemaTriggerQuery()).Scan(&installed); err != nil || !installed {
+		return nil
+	}
+
+	notifications, err := notifier.listenSchemaChanges(ctx, dsn.(string))
+	if err != nil {
+		return nil
+	}
+	w.notified.Store(true)
+	return notifications
+}
+
+func (w *SchemaWatcher) run(ctx context.Context, notifications <-chan struct{}) {
+	defer close(w.changes)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		var poll <-chan time.Time
+		if notifications == nil {
+			poll = ticker.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll:
+		case _, ok := <-notifications:
+			if !ok {
+				// Listening stopped: catch up with the changes that may have
+				// been missed, then poll
+				notifications = nil
+				w.notified.Store(false)
+			}
+		}
+
+		tables, err := w.refresh(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil && len(tables) == 0 {
+			continue
+		}
+		select {
+		case w.changes <- SchemaChange{Tables: tables, Err: err}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh reloads the tables whose fingerprint changed since the last
+// refresh and returns them. The fingerprints are kept when the reload
+// fails, so the next refresh tries again.
+func (w *SchemaWatcher) refresh(ctx context.Context) ([]TableName, error) {
+	fingerprints, err := w.fingerprint(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the schema fingerprint: %w", err)
+	}
+
+	var changed []TableName
+	for table, fingerprint := range fingerprints {
+		if old, ok := w.fingerprints[table]; !ok || old != fingerprint {
+			changed = append(changed, table)
+		}
+	}
+	for table := range w.fingerprints {
+		if _, ok := fingerprints[table]; !ok {
+			changed = append(changed, table)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	slices.SortFunc(changed, func(a, b TableName) int {
+		return cmp.Or(cmp.Compare(a.Schema, b.Schema), cmp.Compare(a.Name, b.Name))
+	})
+
+	if err := w.cache.reloadTables(ctx, w.db, changed); err != nil {
+		return nil, err
+	}
+	w.fingerprints = fingerprints
+	return changed, nil
+}
+
+// fingerprint reads the fingerprint of every table
+func (w *SchemaWatcher) fingerprint(ctx context.Context) (map[TableName]string, error) {
+	rows, err := w.db.QueryContext(ctx, w.cache.dialect.SchemaFingerprintQuery())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fingerprints := make(map[TableName]string)
+	for rows.Next() {
+		var table TableName
+		var fingerprint string
+		if err := rows.Scan(&table.Schema, &table.Name, &fingerprint); err != nil {
+			return nil, err
+		}
+		fingerprints[table] = fingerprint
+	}
+	return fingerprints, rows.Err()
+}
+
+// reloadTables reloads the columns of the given tables, forgetting those
+// that no longer exist. The table list, the schemas and the keys come from
+// a single query each, so they are reloaded whole. The cache stays readable
+// until the reloaded parts are swapped in.
+func (sc *SchemaCache) reloadTables(ctx context.Context, db *sql.DB, tables []TableName) error {
+	next := &SchemaCache{dialect: sc.dialect, Columns: make(map[TableName][]string)}
+
+	var err error
+	if next.allTables, err = queryTables(ctx, db, sc.dialect); err != nil {
+		return fmt.Errorf("failed to load tables: %w", err)
+	}
+	if query := sc.dialect.ListSchemasQuery(); query != "" {
+		if next.Schemas, err = queryStrings(ctx, db, query); err != nil {
+			return fmt.Errorf("failed to load schemas: %w", err)
+		}
+	}
+	for _, table := range tables {
+		if !slices.Contains(next.allTables, table) {
+			continue
+		}
+		columns, err := sc.tableColumns(ctx, db, table)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue // Skip tables that can't be queried
+		}
+		next.Columns[table] = columns
+	}
+	if err := next.loadKeys(ctx, db); err != nil {
+		return fmt.Errorf("failed to load keys: %w", err)
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for _, table := range tables {
+		if columns, ok := next.Columns[table]; ok {
+			sc.Columns[table] = columns
+		} else {
+			delete(sc.Columns, table)
+		}
+	}
+	sc.allTables = next.allTables
+	sc.Schemas = next.Schemas
+	sc.PrimaryKeys = next.PrimaryKeys
+	sc.UniqueKeys = next.UniqueKeys
+	sc.ForeignKeys = next.ForeignKeys
+	sc.setSearchPath(sc.SearchPath)
+	return nil
+}
+
+// InstallSchemaTrigger installs the trigger notifying SchemaWatchers of
+// schema changes in the database db is connected to, so they stop polling
+// it. The trigger fires after every DDL statement of every client until
+// UninstallSchemaTrigger removes it. Only PostgreSQL has one, and
+// installing it needs a superuser.
+func InstallSchemaTrigger(db *sql.DB, dbType string) error {
+	notifier, err := getSchemaNotifier(dbType)
+	if err != nil {
+		return err
+	}
+	return execStatements(db, notifier.schemaTriggerStatements())
+}
+
+// UninstallSchemaTrigger removes the trigger installed by
+// InstallSchemaTrigger, if any
+func UninstallSchemaTrigger(db *sql.DB, dbType string) error {
+	notifier, err := getSchemaNotifier(dbType)
+	if err != nil {
+		return err
+	}
+	return execStatements(db, notifier.dropSchemaTriggerStatements())
+}
+
+func getSchemaNotifier(dbType string) (schemaNotifier, error) {
+	dialect, err := GetDialect(dbType)
+	if err != nil {
+		return nil, err
+	}
+	notifier, ok := dialect.(schemaNotifier)
+	if !ok {
+		return nil, fmt.Errorf("not applicable: %s has no schema change trigger, its schema is polled", dialect.Name())
+	}
+	return notifier, nil
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ScriptSyntax describes the lexical rules that decide where a statement
+// ends. Semicolons inside strings, quoted identifiers and comments do not
+// end a statement.
+type ScriptSyntax struct {
+	// BackslashEscapes lets a backslash escape a quote inside any string
+	BackslashEscapes bool
+	// EscapeStrings lets a backslash escape a quote inside E'...' strings
+	EscapeStrings bool
+	// DollarQuotes enables $$...$$ and $tag$...$tag$ strings
+	DollarQuotes bool
+	// HashComments treats # as the start of a line comment
+	HashComments bool
+	// NestedComments lets /* */ comments nest
+	NestedComments bool
+	// FoldsToLower lower-cases unquoted names, so a name holding upper-case
+	// letters is only found when it is quoted
+	FoldsToLower bool
+}
+
+// SplitStatements splits a script into its statements. The semicolons
+// between statements, leading comments and statements holding nothing but
+// comments are dropped. A string or comment left open runs to the end of the
+// script, so the server reports it.
+func SplitStatements(script string, syntax ScriptSyntax) []string {
+	var statements []string
+	start := -1 // first byte of the current statement, -1 before any code
+
+	mark := func(i int) {
+		if start < 0 {
+			start = i
+		}
+	}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		next := byte(0)
+		if i+1 < len(script) {
+			next = script[i+1]
+		}
+
+		switch {
+		case c == '\'':
+			mark(i)
+			escapes := syntax.BackslashEscapes || (syntax.EscapeStrings && isEscapeStringPrefix(script, i))
+			i = skipQuoted(script, i, '\'', escapes)
+		case c == '"':
+			mark(i)
+			i = skipQuoted(script, i, '"', syntax.BackslashEscapes)
+		case c == '`':
+			mark(i)
+			i = skipQuoted(script, i, '`', false)
+		case c == '-' && next == '-', c == '#' && syntax.HashComments:
+			i = skipLine(script, i)
+		case c == '/' && next == '*':
+			// MySQL runs the contents of /*! ... */ and reads hints from
+			// /*+ ... */, so those count as code
+			if i+2 < len(script) && (script[i+2] == '!' || script[i+2] == '+') {
+				mark(i)
+			}
+			i = skipBlockComment(script, i, syntax.NestedComments)
+		case c == '$' && syntax.DollarQuotes:
+			mark(i)
+			if tag, ok := dollarTag(script, i); ok {
+				end := strings.Index(script[i+len(tag):], tag)
+				if end < 0 {
+					i = len(script)
+				} else {
+					i += len(tag) + end + len(tag)
+				}
+			} else {
+				i++
+			}
+		case c == ';':
+			if start >= 0 {
+				statements = append(statements, strings.TrimSpace(script[start:i]))
+			}
+			start = -1
+			i++
+		default:
+			if !isSpace(c) {
+				mark(i)
+			}
+			i++
+		}
+	}
+
+	if start >= 0 {
+		if statement := strings.TrimSpace(script[start:]); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+// skipQuoted returns the index just past the quoted text starting at i.
+// A doubled quote stands for the quote itself.
+func skipQuoted(s string, i int, quote byte, backslashEscapes bool) int {
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if backslashEscapes {
+				i++
+			}
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// skipLine returns the index of the newline ending the comment at i
+func skipLine(s string, i int) int {
+	if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+		return i + end
+	}
+	return len(s)
+}
+
+// skipBlockComment returns the index just past the /* */ comment at i
+func skipBlockComment(s string, i int, nested bool) int {
+	depth := 0
+	for i < len(s)-1 {
+		switch {
+		case s[i] == '/' && s[i+1] == '*':
+			if depth == 0 || nested {
+				depth++
+			}
+			i += 2
+		case s[i] == '*' && s[i+1] == '/':
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(s)
+}
+
+// dollarTag returns the $tag$ opening a dollar-quoted string at i. A $ that
+// continues an identifier or starts a parameter such as $1 opens nothing.
+func dollarTag(s string, i int) (string, bool) {
+	if identBefore(s, i) {
+		return "", false
+	}
+	for j := i + 1; j < len(s); {
+		if s[j] == '$' {
+			return s[i : j+1], true
+		}
+		width := identWidth(s, j)
+		if width == 0 || (j == i+1 && isDigit(s[j])) {
+			return "", false
+		}
+		j += width
+	}
+	return "", false
+}
+
+// isEscapeStringPrefix reports whether the quote at i opens an E'...' string
+func isEscapeStringPrefix(s string, i int) bool {
+	if i == 0 || (s[i-1] != 'E' && s[i-1] != 'e') {
+		return false
+	}
+	return !identBefore(s, i-1)
+}
+
+// identWidth returns the length in bytes of the character at i when it can
+// be part of an unquoted name, and 0 otherwise
+func identWidth(s string, i int) int {
+	if c := s[i]; c < utf8.RuneSelf {
+		if c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c) {
+			return 1
+		}
+		return 0
+	}
+	r, width := utf8.DecodeRuneInString(s[i:])
+	if !IsIdentifierRune(r) {
+		return 0
+	}
+	return width
+}
+
+// skipIdent returns the index after the unquoted name starting at i
+func skipIdent(s string, i int) int {
+	for i < len(s) {
+		width := identWidth(s, i)
+		if width == 0 {
+			break
+		}
+		i += width
+	}
+	return i
+}
+
+// identBefore reports whether the character ending at i can be part of an
+// unquoted name
+func identBefore(s string, i int) bool {
+	if i <= 0 {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return IsIdentifierRune(r)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	postgres := postgresDialect{}.ScriptSyntax()
+	mysql := mysqlDialect{}.ScriptSyntax()
+	sqlite := sqliteDialect{}.ScriptSyntax()
+	tests := []struct {
+		syntax ScriptSyntax
+		script string
+		want   []string
+	}{
+		{postgres, "SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{postgres, "  ;; SELECT 1 ;  ", []string{"SELECT 1"}},
+		{postgres, "-- only a comment;\n/* and another; */", nil},
+		{postgres, "-- leading\nSELECT 1", []string{"SELECT 1"}},
+
+		// Semicolons inside strings and quoted names
+		{postgres, "SELECT 'a;b'; SELECT 2", []string{"SELECT 'a;b'", "SELECT 2"}},
+		{postgres, `SELECT "a;b" FROM t; SELECT 2`, []string{`SELECT "a;b" FROM t`, "SELECT 2"}},
+		{postgres, "SELECT 'it''s; fine'; SELECT 2", []string{"SELECT 'it''s; fine'", "SELECT 2"}},
+
+		// Dollar quoted bodies
+		{postgres, "DO $$ BEGIN PERFORM 1; END $$; SELECT 2", []string{"DO $$ BEGIN PERFORM 1; END $$", "SELECT 2"}},
+		{postgres, "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $$ $body$ LANGUAGE sql; SELECT 2",
+			[]string{"CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $$ $body$ LANGUAGE sql", "SELECT 2"}},
+		{postgres, "SELECT $1; SELECT 2", []string{"SELECT $1", "SELECT 2"}},
+
+		// A backslash escapes a quote only in E'' strings on PostgreSQL
+		{postgres, `SELECT E'\'; still a string'; SELECT 2`, []string{`SELECT E'\'; still a string'`, "SELECT 2"}},
+		{postgres, `SELECT '\'; SELECT 2`, []string{`SELECT '\'`, "SELECT 2"}},
+
+		// Nested comments
+		{postgres, "SELECT 1 /* a /* b; */ c; */; SELECT 2", []string{"SELECT 1 /* a /* b; */ c; */", "SELECT 2"}},
+		{mysql, "SELECT 1 /* a /* b */; SELECT 2", []string{"SELECT 1 /* a /* b */", "SELECT 2"}},
+
+		// MySQL comments, escapes and backticks
+		{mysql, "SELECT 1 # comment; here\n; SELECT 2", []string{"SELECT 1 # comment; here", "SELECT 2"}},
+		{postgres, "SELECT 1 # 2; SELECT 3", []string{"SELECT 1 # 2", "SELECT 3"}},
+		{mysql, `SELECT 'a\'; b'; SELECT 2`, []string{`SELECT 'a\'; b'`, "SELECT 2"}},
+		{mysql, `SELECT "a\"; b"; SELECT 2`, []string{`SELECT "a\"; b"`, "SELECT 2"}},
+		{mysql, "SELECT `a;b` FROM t; SELECT 2", []string{"SELECT `a;b` FROM t", "SELECT 2"}},
+		{mysql, "/*!40101 SET NAMES utf8 */; SELECT 2", []string{"/*!40101 SET NAMES utf8 */", "SELECT 2"}},
+		{sqlite, "SELECT 1 # 2; SELECT 3", []string{"SELECT 1 # 2", "SELECT 3"}},
+
+		// A string or comment left open runs to the end of the script
+		{postgres, "SELECT 1; SELECT 'open; SELECT 2", []string{"SELECT 1", "SELECT 'open; SELECT 2"}},
+		{postgres, "SELECT 1; DO $$ open; SELECT 2", []string{"SELECT 1", "DO $$ open; SELECT 2"}},
+		{postgres, "SELECT 1 /* open; SELECT 2", []string{"SELECT 1 /* open; SELECT 2"}},
+	}
+
+	for _, test := range tests {
+		if got := SplitStatements(test.script, test.syntax); !slices.Equal(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.script, got, test.want)
+		}
+	}
+}
+
+func TestCommandTag(t *testing.T) {
+	tests := []struct {
+		statement       string
+		rowsAffected    int64
+		hasRowsAffected bool
+		want            string
+	}{
+		{"insert into t values (1)", 1, true, "INSERT 1"},
+		{"UPDATE t SET a = 1", 3, true, "UPDATE 3"},
+		{"DELETE FROM t", 0, false, "DELETE"},
+		{"(DELETE FROM t)", 2, true, "DELETE 2"},
+		{"CREATE TABLE t (id int)", 0, true, "CREATE TABLE"},
+		{"create unique index i on t (id)", 0, true, "CREATE INDEX"},
+		{"CREATE OR REPLACE FUNCTION f() RETURNS int", 0, true, "CREATE FUNCTION"},
+		{"CREATE OR REPLACE TEMP VIEW v AS SELECT 1", 0, true, "CREATE VIEW"},
+		{"CREATE DEFINER=root@localhost PROCEDURE p() BEGIN END", 0, true, "CREATE PROCEDURE"},
+		{"DROP TABLE t", 0, true, "DROP TABLE"},
+		{"ALTER TABLE t ADD COLUMN a int", 0, true, "ALTER TABLE"},
+		{"CREATE", 0, true, "CREATE"},
+		{"SET search_path = public", 0, true, "SET"},
+		{"BEGIN;", 0, true, "BEGIN"},
+		{"", 0, true, ""},
+	}
+
+	for _, test := range tests {
+		if got := commandTag(test.statement, test.rowsAffected, test.hasRowsAffected); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.statement, got, test.want)
+		}
+	}
+}
+
+func TestReturnsRows(t *testing.T) {
+	postgres := postgresDialect{}.ScriptSyntax()
+	mysql := mysqlDialect{}.ScriptSyntax()
+	tests := []struct {
+		syntax    ScriptSyntax
+		statement string
+		want      bool
+	}{
+		{postgres, "SELECT 1", true},
+		{postgres, "(SELECT 1) UNION (SELECT 2)", true},
+		{postgres, "with x as (select 1) select * from x", true},
+		{postgres, "EXPLAIN DELETE FROM t", true},
+		{postgres, "VALUES (1), (2)", true},
+		{postgres, "INSERT INTO t VALUES (1)", false},
+		{postgres, "INSERT INTO t VALUES (1) RETURNING id", true},
+		{postgres, "delete from t returning *", true},
+
+		// RETURNING in strings, quoted names and comments does not count
+		{postgres, "INSERT INTO t VALUES ('returning')", false},
+		{postgres, `UPDATE t SET "returning" = 1`, false},
+		{postgres, "DELETE FROM t -- returning id", false},
+		{postgres, "DELETE FROM t /* returning id */", false},
+		{postgres, "INSERT INTO t VALUES ($$ returning $$)", false},
+		{postgres, "UPDATE t SET returning_id = 1", false},
+		{mysql, "INSERT INTO t VALUES ('it\\'s returning')", false},
+		{mysql, "UPDATE t SET `returning` = 1", false},
+		{mysql, "DELETE FROM t # returning id", false},
+	}
+
+	for _, test := range tests {
+		if got := returnsRows(test.statement, test.syntax); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.statement, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TxStatus is the transaction state of a Session
+type TxStatus int
+
+const (
+	// TxIdle means no transaction is open
+	TxIdle TxStatus = iota
+	// TxActive means a transaction is open
+	TxActive
+	// TxFailed means a statement failed inside the open transaction, which
+	// only accepts a rollback from now on
+	TxFailed
+)
+
+func (s TxStatus) String() string {
+	switch s {
+	case TxActive:
+		return "in transaction"
+	case TxFailed:
+		return "failed transaction"
+	}
+	return "idle"
+}
+
+// Session runs statements on a single pinned connection, so a transaction
+// opened with BEGIN spans several executions. The transaction state is
+// followed from the statements that are run: BEGIN and START TRANSACTION
+// open one, COMMIT, END, ROLLBACK and ABORT close it.
+type Session struct {
+	db       *sql.DB
+	conn     *sql.Conn
+	dialect  Dialect
+	readOnly bool
+
+	mu         sync.Mutex
+	autocommit bool
+	status     TxStatus
+}
+
+// NewSession takes a connection from the pool of db for the session.
+// Autocommit starts on. A read-only session refuses statements that may
+// write before they reach the server, on top of the server-side setting.
+func NewSession(ctx context.Context, db *sql.DB, dbType string, readOnly bool) (*Session, error) {
+	dialect, err := GetDialect(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{db: db, dialect: dialect, readOnly: readOnly, autocommit: true}
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect takes the session connection from the pool, making it read-only
+// when the session is
+func (s *Session) connect(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a connection: %w", err)
+	}
+	if statement := s.dialect.ReadOnlySessionStatement(); s.readOnly && statement != "" {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to make the session read-only: %w", err)
+		}
+	}
+	s.conn = conn
+	return nil
+}
+
+// ReadOnly reports whether the session refuses writes
+func (s *Session) ReadOnly() bool {
+	return s.readOnly
+}
+
+// Classify classifies a statement using the syntax of the session dialect
+func (s *Session) Classify(statement string) StatementClass {
+	return ClassifyStatement(statement, s.dialect.ScriptSyntax())
+}
+
+// Split splits a script into statements like Execute does
+func (s *Session) Split(script string) []string {
+	return SplitStatements(script, s.dialect.ScriptSyntax())
+}
+
+// Status returns the transaction state
+func (s *Session) Status() TxStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Autocommit reports whether each statement is committed on its own
+func (s *Session) Autocommit() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.autocommit
+}
+
+// SetAutocommit turns autocommit on or off. With autocommit off, a
+// transaction is opened before the first statement and stays open until
+// Commit or Rollback. A transaction that is already open is left alone.
+func (s *Session) SetAutocommit(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autocommit = on
+}
+
+// Execute splits a script into statements and runs them in order on the
+// session connection, like ExecuteScriptContext
+func (s *Session) Execute(ctx context.Context, script string, continueOnError bool) ScriptResult {
+	statements := s.Split(script)
+	var results ScriptResult
+	for i, statement := range statements {
+		result := s.run(ctx, statement)
+		results.Results = append(results.Results, result)
+
+		if !result.Success && (!continueOnError || ctx.Err() != nil) {
+			results.Skipped = len(statements) - i - 1
+			break
+		}
+	}
+	return results
+}
+
+// SearchPath returns the schemas unqualified names are looked up in on the
+// session connection, which SET search_path may have changed, and nil for
+// engines without schemas
+func (s *Session) SearchPath(ctx context.Context) ([]string, error) {
+	query := s.dialect.SearchPathQuery()
+	if query == "" {
+		return nil, nil
+	}
+
+	rows, err := s.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schemas []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, rows.Err()
+}
+
+// Params returns the placeholders of a query, see QueryParams
+func (s *Session) Params(query string) []string {
+	return QueryParams(query, s.dialect.ScriptSyntax())
+}
+
+// ExecuteWithParams runs a query whose placeholders take their values from
+// values, which are passed to the driver as bound arguments. A query with
+// placeholders must be a single statement; one without runs like Execute.
+func (s *Session) ExecuteWithParams(ctx context.Context, query string, values map[string]string, continueOnError bool) ScriptResult {
+	if len(s.Params(query)) == 0 {
+		return s.Execute(ctx, query, continueOnError)
+	}
+
+	statements := s.Split(query)
+	if len(statements) != 1 {
+		return ScriptResult{Results: []QueryResult{{
+			Statement: query,
+			Success:   false,
+			Error:     "A query with parameters must be a single statement",
+		}}}
+	}
+	statement, args, err := BindParams(statements[0], s.dialect, values)
+	if err != nil {
+		return ScriptResult{Results: []QueryResult{{
+			Statement: statements[0],
+			Success:   false,
+			Error:     "Error binding parameters: " + err.Error(),
+		}}}
+	}
+
+	// Report the statement as written rather than with driver placeholders
+	result := s.run(ctx, statement, args...)
+	result.Statement = statements[0]
+	return ScriptResult{Results: []QueryResult{result}}
+}
+
+// run runs one statement, opening a transaction first when autocommit is
+// off, and updates the transaction state from the outcome
+func (s *Session) run(ctx context.Context, statement string, args ...any) QueryResult {
+	control := transactionControl(statement)
+	if s.readOnly && s.Classify(statement).Write {
+		return QueryResult{
+			Statement: statement,
+			Success:   false,
+			Error:     "Refused: the connection is read-only and this statement may write",
+		}
+	}
+
+	if !s.Autocommit() && s.Status() == TxIdle && control == "" {
+		if _, err := s.conn.ExecContext(ctx, "BEGIN"); err != nil {
+			return QueryResult{
+				Statement: statement,
+				Success:   false,
+				Error:     queryErrorMessage(ctx, "Error starting transaction", err),
+			}
+		}
+		s.setStatus(TxActive)
+	}
+
+	result := runStatement(ctx, s.conn, s.dialect.ScriptSyntax(), statement, args...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case result.Success && control == "begin":
+		s.status = TxActive
+	case result.Success && control == "end":
+		s.status = TxIdle
+	case result.Success && control == "rollback to":
+		s.status = TxActive
+	case !result.Success && s.status == TxActive && s.dialect.AbortsTransactionOnError():
+		s.status = TxFailed
+	}
+	if !result.Success && ctx.Err() != nil {
+		if err := s.recover(); err != nil {
+			result.Error += fmt.Sprintf("\nThe session connection was lost and could not be reopened: %v", err)
+		}
+	}
+	return result
+}
+
+// recover replaces the session connection after a canceled statement when
+// the driver gave up on it, as the MySQL driver does. Any open transaction
+// went away with the old connection. The caller holds s.mu.
+func (s *Session) recover() error {
+	if err := s.conn.PingContext(context.Background()); err == nil {
+		return nil
+	}
+	s.conn.Close()
+	s.status = TxIdle
+	return s.connect(context.Background())
+}
+
+// Commit commits the open transaction. PostgreSQL rolls back a failed
+// transaction instead, which is reported as an error.
+func (s *Session) Commit(ctx context.Context) error {
+	status := s.Status()
+	if status == TxIdle {
+		return fmt.Errorf("no transaction is open")
+	}
+	if _, err := s.conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return err
+	}
+	s.setStatus(TxIdle)
+	if status == TxFailed {
+		return fmt.Errorf("the transaction was rolled back because a statement in it failed")
+	}
+	return nil
+}
+
+// Rollback rolls back the open transaction
+func (s *Session) Rollback(ctx context.Context) error {
+	if s.Status() == TxIdle {
+		return fmt.Errorf("no transaction is open")
+	}
+	if _, err := s.conn.ExecContext(ctx, "ROLLBACK"); err != nil {
+		return err
+	}
+	s.setStatus(TxIdle)
+	return nil
+}
+
+// Close rolls back any open transaction and returns the connection to the
+// pool
+func (s *Session) Close() error {
+	if s.Status() != TxIdle {
+		s.conn.ExecContext(context.Background(), "ROLLBACK")
+		s.setStatus(TxIdle)
+	}
+	return s.conn.Close()
+}
+
+func (s *Session) setStatus(status TxStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// transactionControl classifies a statement that opens or closes a
+// transaction as "begin", "end" or "rollback to", and returns "" for any
+// other statement
+func transactionControl(statement string) string {
+	words := strings.Fields(strings.ToUpper(statement))
+	if len(words) == 0 {
+		return ""
+	}
+
+	switch words[0] {
+	case "BEGIN":
+		return "begin"
+	case "START":
+		if len(words) > 1 && words[1] == "TRANSACTION" {
+			return "begin"
+		}
+	case "COMMIT", "END", "ABORT":
+		return "end"
+	case "ROLLBACK":
+		for _, word := range words[1:] {
+			if word == "TO" {
+				return "rollback to"
+			}
+		}
+		return "end"
+	}
+	return ""
+}
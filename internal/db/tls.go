@@ -0,0 +1,130 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// buildTLSConfig turns the libpq-style SSL settings into a tls.Config for
+// drivers that do not understand sslmode themselves. It returns nil when
+// TLS is disabled.
+func buildTLSConfig(p ConnParams) (*tls.Config, error) {
+	mode, err := p.sslMode()
+	if err != nil {
+		return nil, err
+	}
+	if mode == "disable" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{ServerName: p.tlsServerName()}
+
+	if p.SSLRootCert != "" {
+		pem, err := os.ReadFile(p.SSLRootCert)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read SSL root certificate: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("SSL root certificate '%s' contains no PEM certificates", p.SSLRootCert)
+		}
+	}
+
+	if p.SSLCert != "" || p.SSLKey != "" {
+		cert, err := tls.LoadX509KeyPair(p.SSLCert, p.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load SSL client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case "require":
+		// Encrypt only, like libpq. With a root certificate libpq behaves
+		// as verify-ca, so do the same here.
+		cfg.InsecureSkipVerify = true
+		if cfg.RootCAs != nil {
+			cfg.VerifyPeerCertificate = verifyChainOnly(cfg.RootCAs)
+		}
+	case "verify-ca":
+		// Check the chain but not the host name
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = verifyChainOnly(cfg.RootCAs)
+	}
+
+	return cfg, nil
+}
+
+// verifyChainOnly verifies the server certificate chain against roots
+// (or the system pool when roots is nil) without checking the host name
+func verifyChainOnly(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server sent no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
+
+// translateTLSError explains certificate and handshake failures. It returns
+// nil when err is not TLS related so the dialect can translate it instead.
+func translateTLSError(err error, p ConnParams) error {
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthority) {
+		return fmt.Errorf("certificate verification failed: the server certificate is signed by an unknown authority - set the SSL root certificate to the CA that signed it")
+	}
+
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return fmt.Errorf("certificate verification failed: the server certificate is not valid for host '%s' - connect using a host name listed in the certificate or use sslmode verify-ca", p.Host)
+	}
+
+	var invalidCert x509.CertificateInvalidError
+	if errors.As(err, &invalidCert) {
+		return fmt.Errorf("certificate verification failed: %s - check the server certificate and the system clock", invalidCert.Error())
+	}
+
+	var recordHeaderErr tls.RecordHeaderError
+	if errors.As(err, &recordHeaderErr) {
+		return fmt.Errorf("TLS handshake failed: host '%s' on port '%s' did not answer with TLS - check that SSL is enabled on the server or use sslmode disable", p.Host, p.Port)
+	}
+
+	var alertErr tls.AlertError
+	if errors.As(err, &alertErr) {
+		return fmt.Errorf("TLS handshake failed: the server rejected the connection (%s) - check the SSL client certificate and key", alertErr.Error())
+	}
+
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) && (pathErr.Path == p.SSLRootCert || pathErr.Path == p.SSLCert || pathErr.Path == p.SSLKey) {
+		return fmt.Errorf("cannot read SSL file '%s': %v", pathErr.Path, pathErr.Err)
+	}
+
+	switch {
+	case errors.Is(err, pq.ErrSSLNotSupported), errors.Is(err, mysql.ErrNoTLS):
+		return fmt.Errorf("TLS handshake failed: the server does not support SSL - use sslmode disable or enable SSL on the server")
+	case errors.Is(err, pq.ErrSSLKeyHasWorldPermissions):
+		return fmt.Errorf("SSL key '%s' is accessible by other users - restrict it with chmod 600", p.SSLKey)
+	}
+
+	return nil
+}
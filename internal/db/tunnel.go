@@ -0,0 +1,295 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHParams describes a jump host the database is reached through
+type SSHParams struct {
+	Host string
+	// Port defaults to 22
+	Port string
+	// User defaults to the current OS user
+	User string
+	// KeyFile is a private key to authenticate with. When empty, keys from
+	// ssh-agent and the default ~/.ssh identities are tried.
+	KeyFile string
+	// KnownHosts is the file the host key is checked against, by default
+	// ~/.ssh/known_hosts. Unknown hosts are rejected.
+	KnownHosts string
+}
+
+// sshTunnel forwards connections accepted on a local port to a database
+// server through an SSH client
+type sshTunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	remote   string
+}
+
+var (
+	tunnelsMu sync.Mutex
+	tunnels   = make(map[string]*sshTunnel)
+)
+
+// throughTunnel returns params that reach the database through the SSH
+// tunnel in p.SSH, opening it on first use. Later connections to the same
+// server through the same jump host, such as the secondary connections
+// used to grant privileges, reuse the open tunnel.
+func throughTunnel(p ConnParams) (ConnParams, error) {
+	if p.SSH == nil {
+		return p, nil
+	}
+
+	remote := net.JoinHostPort(p.Host, p.Port)
+	t, err := getTunnel(*p.SSH, remote)
+	if err != nil {
+		return p, err
+	}
+
+	_, localPort, _ := net.SplitHostPort(t.listener.Addr().String())
+	p.serverName = p.Host
+	p.Host = "127.0.0.1"
+	p.Port = localPort
+	p.SSH = nil
+	return p, nil
+}
+
+func getTunnel(s SSHParams, remote string) (*sshTunnel, error) {
+	s = s.withDefaults()
+	key := tunnelKey(s, remote)
+
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+	if t, ok := tunnels[key]; ok {
+		return t, nil
+	}
+
+	client, err := dialSSH(s)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("could not open local port for SSH tunnel: %w", err)
+	}
+
+	t := &sshTunnel{client: client, listener: listener, remote: remote}
+	go t.serve()
+	go t.evictOnClose(key)
+	tunnels[key] = t
+	return t, nil
+}
+
+// evictOnClose waits for the SSH connection to end, then closes the tunnel
+// and forgets it, so the next connection opens a new one
+func (t *sshTunnel) evictOnClose(key string) {
+	t.client.Wait()
+	t.close()
+
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+	if tunnels[key] == t {
+		delete(tunnels, key)
+	}
+}
+
+func (t *sshTunnel) close() {
+	t.listener.Close()
+	t.client.Close()
+}
+
+// tunnelKey identifies a tunnel by the jump host, its user and the server
+// it forwards to
+func tunnelKey(s SSHParams, remote string) string {
+	return s.User + "@" + net.JoinHostPort(s.Host, s.Port) + " -> " + remote
+}
+
+// serve forwards every accepted connection until the listener is closed
+func (t *sshTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(local)
+	}
+}
+
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	remote, err := t.client.Dial("tcp", t.remote)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// tunnelError explains a failed connection when the SSH server cannot
+// reach the database, which it checks with a dial of its own. It returns
+// nil when params use no tunnel or the tunnel is not at fault.
+func tunnelError(params ConnParams) error {
+	if params.SSH == nil {
+		return nil
+	}
+	s := params.SSH.withDefaults()
+	remote := net.JoinHostPort(params.Host, params.Port)
+	key := tunnelKey(s, remote)
+
+	tunnelsMu.Lock()
+	t, ok := tunnels[key]
+	tunnelsMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	conn, err := t.client.Dial("tcp", remote)
+	if err != nil {
+		return fmt.Errorf("SSH host %s could not reach %s: %w", s.Host, remote, err)
+	}
+	conn.Close()
+	return nil
+}
+
+// CloseTunnels closes every open SSH tunnel
+func CloseTunnels() {
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+	for key, t := range tunnels {
+		t.close()
+		delete(tunnels, key)
+	}
+}
+
+func (s SSHParams) withDefaults() SSHParams {
+	if s.Port == "" {
+		s.Port = "22"
+	}
+	if s.User == "" {
+		s.User = osUsername()
+	}
+	if s.KnownHosts == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			s.KnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+		}
+	}
+	return s
+}
+
+func dialSSH(s SSHParams) (*ssh.Client, error) {
+	hostKeyCallback, err := knownhosts.New(s.KnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read SSH known hosts file: %w", err)
+	}
+
+	auth, err := sshAuthMethods(s)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(s.Host, s.Port)
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	})
+	if err != nil {
+		return nil, translateSSHError(err, s)
+	}
+	return client, nil
+}
+
+// sshAuthMethods uses the configured key file, or else ssh-agent and the
+// unencrypted default identities, like the ssh command does
+func sshAuthMethods(s SSHParams) ([]ssh.AuthMethod, error) {
+	if s.KeyFile != "" {
+		signer, err := loadSigner(s.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	var signers []ssh.Signer
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			if signer, err := loadSigner(filepath.Join(home, ".ssh", name)); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if len(methods) == 0 {
+		return nil, errors.New("no SSH key available: start ssh-agent or set the SSH key file")
+	}
+	return methods, nil
+}
+
+func loadSigner(path string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read SSH key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("SSH key '%s' is protected by a passphrase, add it to ssh-agent with ssh-add", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse SSH key '%s': %w", path, err)
+	}
+	return signer, nil
+}
+
+// translateSSHError explains host key and authentication failures
+func translateSSHError(err error, s SSHParams) error {
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		if len(keyErr.Want) == 0 {
+			return fmt.Errorf("SSH host %s is not in %s: connect once with ssh to check and add its key", s.Host, s.KnownHosts)
+		}
+		return fmt.Errorf("SSH host key for %s does not match %s: the host may have been reinstalled, or someone may be intercepting the connection", s.Host, s.KnownHosts)
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return fmt.Errorf("cannot reach SSH host %s:%s: %w", s.Host, s.Port, err)
+	}
+
+	return fmt.Errorf("SSH connection to %s@%s failed: %w", s.User, s.Host, err)
+}
@@ -0,0 +1,324 @@
+package db
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an in-process SSH server that only forwards
+// direct-tcpip channels, the way a jump host does
+type testSSHServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.PublicKey
+
+	mu    sync.Mutex
+	conns []*ssh.ServerConn
+}
+
+func newTestSSHServer(t *testing.T, clientKey ssh.PublicKey) *testSSHServer {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSSHServer{listener: listener, config: config, hostKey: hostSigner.PublicKey()}
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+	})
+	return s
+}
+
+func (s *testSSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testSSHServer) handle(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.mu.Lock()
+	s.conns = append(s.conns, serverConn)
+	s.mu.Unlock()
+
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+			continue
+		}
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			remote.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelRequests)
+		go func() {
+			defer channel.Close()
+			defer remote.Close()
+			done := make(chan struct{}, 2)
+			go func() { io.Copy(remote, channel); done <- struct{}{} }()
+			go func() { io.Copy(channel, remote); done <- struct{}{} }()
+			<-done
+		}()
+	}
+}
+
+// dropConnections closes the SSH connections, as a jump host restarting
+// or a network failure does
+func (s *testSSHServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testSSHServer) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+// startEchoServer stands in for a database server
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// newTunnelTest starts a jump host and returns the SSH settings to reach
+// it, with a key file and a known_hosts file that trusts it
+func newTunnelTest(t *testing.T) (*testSSHServer, SSHParams) {
+	t.Helper()
+	t.Cleanup(CloseTunnels)
+
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestSSHServer(t, sshPub)
+
+	dir := t.TempDir()
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.listener.Addr().String())}, server.hostKey)
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return server, SSHParams{
+		Host:       "127.0.0.1",
+		Port:       server.port(),
+		User:       "maxim",
+		KeyFile:    keyFile,
+		KnownHosts: knownHosts,
+	}
+}
+
+// echo sends a line through the tunnel in p and checks it comes back
+func echo(t *testing.T, p ConnParams) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(p.Host, p.Port), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 5)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("no reply through the tunnel: %v", err)
+	}
+	if string(reply) != "ping\n" {
+		t.Fatalf("got %q through the tunnel, want %q", reply, "ping\n")
+	}
+}
+
+func TestThroughTunnel(t *testing.T) {
+	_, sshParams := newTunnelTest(t)
+	dbPort := startEchoServer(t)
+
+	params := ConnParams{Host: "127.0.0.1", Port: dbPort, SSH: &sshParams}
+	tunnelled, err := throughTunnel(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tunnelled.SSH != nil || tunnelled.Port == dbPort {
+		t.Fatalf("params were not pointed at the tunnel: %+v", tunnelled)
+	}
+	if got := tunnelled.tlsServerName(); got != "127.0.0.1" {
+		t.Errorf("tlsServerName() = %q, want the database host", got)
+	}
+	echo(t, tunnelled)
+
+	// A second connection to the same server reuses the tunnel
+	again, err := throughTunnel(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Port != tunnelled.Port {
+		t.Errorf("second connection opened a new tunnel on port %s, want %s", again.Port, tunnelled.Port)
+	}
+	if err := tunnelError(params); err != nil {
+		t.Errorf("tunnelError() = %v for a reachable server", err)
+	}
+}
+
+func TestTunnelEvictedWhenSSHConnectionDies(t *testing.T) {
+	server, sshParams := newTunnelTest(t)
+	dbPort := startEchoServer(t)
+
+	params := ConnParams{Host: "127.0.0.1", Port: dbPort, SSH: &sshParams}
+	first, err := throughTunnel(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, first)
+
+	server.dropConnections()
+	key := tunnelKey(sshParams.withDefaults(), net.JoinHostPort(params.Host, params.Port))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tunnelsMu.Lock()
+		_, open := tunnels[key]
+		tunnelsMu.Unlock()
+		if !open {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the tunnel of a dead SSH connection was not evicted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	second, err := throughTunnel(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Port == first.Port {
+		t.Errorf("reconnecting reused the dead tunnel on port %s", first.Port)
+	}
+	echo(t, second)
+}
+
+func TestTunnelErrorWhenServerUnreachable(t *testing.T) {
+	_, sshParams := newTunnelTest(t)
+
+	// Take a free port and close it, so nothing listens there
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, closedPort, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	params := ConnParams{Host: "127.0.0.1", Port: closedPort, SSH: &sshParams}
+	if _, err := throughTunnel(params); err != nil {
+		t.Fatal(err)
+	}
+	err = tunnelError(params)
+	if err == nil || !strings.Contains(err.Error(), "could not reach") {
+		t.Errorf("tunnelError() = %v, want the SSH host to report the server unreachable", err)
+	}
+}
+
+func TestTunnelUnknownHostKey(t *testing.T) {
+	_, sshParams := newTunnelTest(t)
+	if err := os.WriteFile(sshParams.KnownHosts, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := throughTunnel(ConnParams{Host: "127.0.0.1", Port: "5432", SSH: &sshParams})
+	if err == nil || !strings.Contains(err.Error(), "is not in") {
+		t.Errorf("throughTunnel() = %v, want an unknown host error", err)
+	}
+}
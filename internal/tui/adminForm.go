@@ -3,44 +3,115 @@ package tui
 import (
 	"strings"
 
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
+// Indexes into AdminFormModel.Inputs
+const (
+	adminUser = iota
+	adminPassword
+	adminHost
+	adminPort
+	adminSocket
+	adminSSLMode
+	adminSSLRootCert
+	adminSSLCert
+	adminSSLKey
+	adminSSHHost
+	adminSSHKey
+)
+
+var adminLabels = []string{
+	"Username:      ",
+	"Password:      ",
+	"Host:          ",
+	"Port:          ",
+	"Socket Dir:    ",
+	"SSL Mode:      ",
+	"SSL Root Cert: ",
+	"SSL Cert:      ",
+	"SSL Key:       ",
+	"SSH Host:      ",
+	"SSH Key:       ",
+}
+
+// AdminFormModel collects superuser credentials. Focus position 0 is the
+// engine selector, positions 1..len(Inputs) are the text inputs. The form
+// goes back with an AdminResult.
 type AdminFormModel struct {
 	focusIndex int
+	engine     engineSelector
 	Inputs     []textinput.Model
-	Quitting   bool
 }
 
+// AdminResult holds the submitted form. Quitting is set when the user closed
+// the form.
 type AdminResult struct {
+	DBType   string
 	User     string
 	Password string
+	Host     string
 	Port     string
 	Quitting bool
+
+	// SocketDir connects over a Unix socket instead of Host
+	SocketDir string
+
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	// SSHHost is an optional jump host as [user@]host[:port]
+	SSHHost string
+	SSHKey  string
 }
 
+// RunAdminForm shows the admin form on its own, for the commands run as
+// the superuser
 func RunAdminForm() (AdminResult, error) {
-	m, err := tea.NewProgram(initialAdminFormModel()).Run()
+	result, err := runApp(&appState{}, initialAdminFormModel())
 	if err != nil {
 		return AdminResult{}, err
 	}
+	if result, ok := result.(AdminResult); ok {
+		return result, nil
+	}
+	return AdminResult{Quitting: true}, nil
+}
 
-	model := m.(AdminFormModel)
+// result builds the result from the inputs
+func (m AdminFormModel) result() AdminResult {
 	result := AdminResult{
-		User:     model.Inputs[0].Value(),
-		Password: model.Inputs[1].Value(),
-		Port:     model.Inputs[2].Value(),
-		Quitting: model.Quitting,
-	}
+		DBType:   m.engine.dbType(),
+		User:     m.Inputs[adminUser].Value(),
+		Password: m.Inputs[adminPassword].Value(),
+		Host:     valueOrPlaceholder(m.Inputs[adminHost]),
+		Port:     valueOrPlaceholder(m.Inputs[adminPort]),
 
-	return result, nil
+		SocketDir: strings.TrimSpace(m.Inputs[adminSocket].Value()),
+
+		SSLMode:     valueOrPlaceholder(m.Inputs[adminSSLMode]),
+		SSLRootCert: strings.TrimSpace(m.Inputs[adminSSLRootCert].Value()),
+		SSLCert:     strings.TrimSpace(m.Inputs[adminSSLCert].Value()),
+		SSLKey:      strings.TrimSpace(m.Inputs[adminSSLKey].Value()),
+
+		SSHHost: strings.TrimSpace(m.Inputs[adminSSHHost].Value()),
+		SSHKey:  strings.TrimSpace(m.Inputs[adminSSHKey].Value()),
+	}
+	if result.SocketDir != "" && strings.TrimSpace(m.Inputs[adminHost].Value()) == "" {
+		result.Host = ""
+	}
+	return result
 }
 
 func initialAdminFormModel() AdminFormModel {
 	m := AdminFormModel{
-		Inputs: make([]textinput.Model, 3),
+		engine: newEngineSelector(true),
+		Inputs: make([]textinput.Model, len(adminLabels)),
 	}
 
 	var t textinput.Model
@@ -51,31 +122,69 @@ func initialAdminFormModel() AdminFormModel {
 		t.Prompt = ""
 
 		switch i {
-		case 0:
-			t.Placeholder = "postgres"
-			t.Focus()
-		case 1:
+		case adminPassword:
 			t.Placeholder = "password"
 			t.EchoMode = textinput.EchoPassword
 			t.EchoCharacter = '•'
-		case 2:
-			t.Placeholder = "5432"
+		case adminHost:
+			t.Placeholder = "localhost"
+			t.CharLimit = 255
+		case adminSocket:
+			t.Placeholder = "optional, e.g. /var/run/postgresql"
+			t.CharLimit = 4096
+		case adminSSLMode:
+			t.Placeholder = "disable"
+		case adminSSLRootCert, adminSSLCert, adminSSLKey:
+			t.Placeholder = "optional, path to PEM file"
+			t.CharLimit = 4096
+		case adminSSHHost:
+			t.Placeholder = "optional, [user@]jumphost[:port]"
+			t.CharLimit = 255
+		case adminSSHKey:
+			t.Placeholder = "optional, ssh-agent when empty"
+			t.CharLimit = 4096
 		}
 		m.Inputs[i] = t
 	}
+	m.applyEngineDefaults()
+
+	// Pre-fill from the libpq environment variables, service and password files
+	if defaults, password, err := config.LibpqDefaults(); err == nil {
+		prefillInput(&m.Inputs[adminUser], defaults.User)
+		prefillInput(&m.Inputs[adminPassword], password)
+		prefillHost(&m.Inputs[adminHost], &m.Inputs[adminSocket], defaults.Host)
+		prefillInput(&m.Inputs[adminPort], defaults.Port)
+		prefillInput(&m.Inputs[adminSSLMode], defaults.SSLMode)
+		prefillInput(&m.Inputs[adminSSLRootCert], defaults.SSLRootCert)
+		prefillInput(&m.Inputs[adminSSLCert], defaults.SSLCert)
+		prefillInput(&m.Inputs[adminSSLKey], defaults.SSLKey)
+	}
 	return m
 }
 
+// applyEngineDefaults updates the placeholders to match the selected engine
+func (m *AdminFormModel) applyEngineDefaults() {
+	dialect := m.engine.dialect()
+	m.Inputs[adminUser].Placeholder = dialect.DefaultUser()
+	m.Inputs[adminPort].Placeholder = dialect.DefaultPort()
+}
+
 func (m AdminFormModel) Init() tea.Cmd {
 	return textinput.Blink
 }
 
+// typing is always set, as the form takes text
+func (m AdminFormModel) typing() bool {
+	return true
+}
+
 func (m AdminFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if msg, ok := msg.(tea.KeyMsg); ok {
 		switch msg.String() {
-		case "ctrl+c", "esc":
-			m.Quitting = true
-			return m, tea.Quit
+		case appKeys.quit:
+			return m, quitApp
+		case "esc":
+			return m, back(AdminResult{Quitting: true})
 		}
 	}
 
@@ -83,14 +192,24 @@ func (m AdminFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.Type {
 		case tea.KeyEnter:
-			if m.focusIndex == len(m.Inputs)-1 {
-				return m, tea.Quit
+			if m.focusIndex == len(m.Inputs) {
+				return m, back(m.result())
 			}
 			m.nextInput()
 		case tea.KeyShiftTab, tea.KeyCtrlP:
 			m.prevInput()
 		case tea.KeyTab, tea.KeyCtrlN:
 			m.nextInput()
+		case tea.KeyLeft, tea.KeyRight:
+			if m.focusIndex == 0 {
+				if msg.Type == tea.KeyLeft {
+					m.engine.prev()
+				} else {
+					m.engine.next()
+				}
+				m.applyEngineDefaults()
+				return m, nil
+			}
 		}
 	}
 
@@ -99,21 +218,21 @@ func (m AdminFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m AdminFormModel) View() string {
-	if m.Quitting {
-		return ""
-	}
 	var b strings.Builder
 
-	b.WriteString("Enter Postgres Superuser Credentials\n\n")
+	b.WriteString("Enter Database Superuser Credentials\n\n")
 
-	labels := []string{"Username: ", "Password: ", "Port:     "}
+	b.WriteString("Engine:        ")
+	b.WriteString(m.engine.View())
+	b.WriteRune('\n')
 	for i := range m.Inputs {
-		b.WriteString(labels[i])
+		b.WriteString(adminLabels[i])
 		b.WriteString(m.Inputs[i].View())
 		b.WriteRune('\n')
 	}
 
-	b.WriteString("\n(press Enter to submit, Esc to quit)")
+	b.WriteString("\nSSL modes: disable, require, verify-ca, verify-full\n")
+	b.WriteString("\n(Left/Right to change engine, Enter to submit, Esc to cancel)")
 	return b.String()
 }
 
@@ -126,16 +245,26 @@ func (m *AdminFormModel) updateInputs(msg tea.Msg) tea.Cmd {
 }
 
 func (m *AdminFormModel) nextInput() {
-	m.Inputs[m.focusIndex].Blur()
-	m.focusIndex = (m.focusIndex + 1) % len(m.Inputs)
-	m.Inputs[m.focusIndex].Focus()
+	m.setFocus((m.focusIndex + 1) % (len(m.Inputs) + 1))
 }
 
 func (m *AdminFormModel) prevInput() {
-	m.Inputs[m.focusIndex].Blur()
-	m.focusIndex--
-	if m.focusIndex < 0 {
-		m.focusIndex = len(m.Inputs) - 1
+	index := m.focusIndex - 1
+	if index < 0 {
+		index = len(m.Inputs)
+	}
+	m.setFocus(index)
+}
+
+func (m *AdminFormModel) setFocus(index int) {
+	m.engine.focused = false
+	if m.focusIndex > 0 {
+		m.Inputs[m.focusIndex-1].Blur()
+	}
+	m.focusIndex = index
+	if m.focusIndex == 0 {
+		m.engine.focused = true
+	} else {
+		m.Inputs[m.focusIndex-1].Focus()
 	}
-	m.Inputs[m.focusIndex].Focus()
 }
@@ -0,0 +1,423 @@
+package tui
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Connection is an open database connection shown by the app
+type Connection struct {
+	DB *sql.DB
+	// Name is the saved connection name, empty for a connection URI
+	Name    string
+	Details config.ConnectionDetails
+}
+
+// AdminConnection is a connection as the database superuser, used to
+// create and list databases
+type AdminConnection struct {
+	DB     *sql.DB
+	Params db.ConnParams
+}
+
+// ErrPassphraseNeeded is returned by the UnlockVault hook when the login
+// session has not unlocked the vault, so the app asks for its passphrase
+var ErrPassphraseNeeded = errors.New("vault passphrase needed")
+
+// ErrNoAdminConnection is returned by the ConnectAdmin hook when no
+// superuser credentials are saved, so the app asks for them
+var ErrNoAdminConnection = errors.New("no saved superuser credentials")
+
+// PasswordNeededError is returned by the hooks when a connection needs a
+// password that neither the vault nor the libpq sources have. The app asks
+// for it and calls the hook again with the answer.
+type PasswordNeededError struct {
+	User string
+}
+
+func (e *PasswordNeededError) Error() string {
+	return fmt.Sprintf("no password for user '%s'", e.User)
+}
+
+// AppHooks carry out the steps of the app that belong to the commands, as
+// they need the vault and build connections the way the commands do. They
+// never prompt: the app asks the user for what they need and calls them
+// again with the answer. They run outside the UI loop.
+type AppHooks struct {
+	// UnlockVault makes the vault, if there is one, available to the
+	// config package. With an empty passphrase it uses the key kept for
+	// the login session and returns ErrPassphraseNeeded when there is
+	// none. Other errors are warnings: the app carries on without the
+	// saved passwords.
+	UnlockVault func(passphrase string) error
+	// OpenSaved connects to a saved connection. password is nil until
+	// OpenSaved returned a *PasswordNeededError, then it is what the user
+	// typed. The status reports a problem that did not stop the connection.
+	OpenSaved func(name string, password *string) (*Connection, string, error)
+	// OpenNew connects with the connect form result and saves it
+	OpenNew func(result ConnectResult) (*Connection, string, error)
+	// SaveConnection saves the connect form result over the saved
+	// connection name, or as a copy of it with duplicate, and returns the
+	// status to show
+	SaveConnection func(name string, result ConnectResult, duplicate bool) (string, error)
+	// ConnectAdmin connects with the saved superuser credentials. It
+	// returns ErrNoAdminConnection when there are none, and takes password
+	// like OpenSaved.
+	ConnectAdmin func(password *string) (*AdminConnection, error)
+	// SaveAdmin connects with the admin form result and saves it. The
+	// status reports whether it was saved.
+	SaveAdmin func(result AdminResult) (*AdminConnection, string, error)
+}
+
+// appState is shared by the screens of the app: the open connection and
+// the editor session on it outlive the screens using them
+type appState struct {
+	hooks   AppHooks
+	conn    *Connection
+	history *config.History
+	// schemas are the schemas browsed, all of them when empty. It is nil
+	// for engines without schemas, which hides the choice.
+	schemas []string
+	// session is the editor session on conn, opened with the first editor
+	// so later ones keep its settings
+	session *db.Session
+}
+
+// connect makes conn the connection the screens work on
+func (s *appState) connect(conn *Connection) {
+	s.disconnect()
+	s.conn = conn
+	s.schemas = nil
+	if hasSchemas(conn.Details.Engine()) {
+		s.schemas = []string{}
+	}
+}
+
+// hasSchemas reports whether an engine groups the tables of a database into
+// schemas
+func hasSchemas(dbType string) bool {
+	dialect, err := db.GetDialect(dbType)
+	return err == nil && dialect.ListSchemasQuery() != ""
+}
+
+// disconnect closes the connection and its session, rolling back a
+// transaction still open
+func (s *appState) disconnect() {
+	if s.session != nil {
+		s.session.Close()
+		s.session = nil
+	}
+	if s.conn != nil {
+		s.conn.DB.Close()
+		s.conn = nil
+	}
+}
+
+// unlockVaultMsg unlocks the vault with passphrase, empty for the key of
+// the login session, then hands next to the screen on top
+type unlockVaultMsg struct {
+	passphrase string
+	next       tea.Msg
+}
+
+// vaultUnlockedMsg carries the outcome of the UnlockVault hook
+type vaultUnlockedMsg struct {
+	unlockVaultMsg
+	err error
+}
+
+// withVault hands next to the screen on top once the vault is unlocked,
+// asking for its passphrase first when the login session has not
+// unlocked it. Without the vault, next goes on without the saved
+// passwords.
+func (s *appState) withVault(next tea.Msg) tea.Cmd {
+	return s.unlockVault(unlockVaultMsg{next: next})
+}
+
+// unlockVault runs the UnlockVault hook outside the UI loop, as deriving
+// the key from a passphrase takes a while
+func (s *appState) unlockVault(msg unlockVaultMsg) tea.Cmd {
+	unlock := s.hooks.UnlockVault
+	return func() tea.Msg {
+		return vaultUnlockedMsg{unlockVaultMsg: msg, err: unlock(msg.passphrase)}
+	}
+}
+
+// vaultUnlocked asks for the passphrase when the vault needs one or was
+// given a wrong one, and goes on with the next message otherwise. Esc or
+// an empty answer in the prompt goes on without the vault.
+func vaultUnlocked(msg vaultUnlockedMsg) tea.Cmd {
+	next := func() tea.Msg { return msg.next }
+	switch {
+	case errors.Is(msg.err, ErrPassphraseNeeded), errors.Is(msg.err, config.ErrWrongPassphrase):
+		prompt := newPasswordPrompt("Unlock the password vault", "Vault passphrase: ", func(passphrase string) tea.Msg {
+			if passphrase == "" {
+				return msg.next
+			}
+			return unlockVaultMsg{passphrase: passphrase, next: msg.next}
+		}, msg.next)
+		if errors.Is(msg.err, config.ErrWrongPassphrase) {
+			prompt.err = "wrong passphrase"
+		}
+		return push(prompt)
+	case msg.err != nil:
+		return tea.Sequence(next, setStatus("Warning: %v", msg.err))
+	}
+	return next
+}
+
+// The screens of the app do not quit the program: they push the next
+// screen, or go back to the previous one with a result for it.
+type (
+	pushScreenMsg struct{ screen tea.Model }
+	backMsg       struct{ result tea.Msg }
+	statusMsg     string
+	quitAppMsg    struct{}
+)
+
+// push shows screen on top of the current one
+func push(screen tea.Model) tea.Cmd {
+	return func() tea.Msg { return pushScreenMsg{screen} }
+}
+
+// back closes the current screen and hands result, when not nil, to the
+// screen below it. Going back from the first screen quits.
+func back(result tea.Msg) tea.Cmd {
+	return func() tea.Msg { return backMsg{result} }
+}
+
+// setStatus shows a line in the status bar until the screen changes
+func setStatus(format string, a ...any) tea.Cmd {
+	return func() tea.Msg { return statusMsg(fmt.Sprintf(format, a...)) }
+}
+
+// quitApp quits from any screen
+func quitApp() tea.Msg {
+	return quitAppMsg{}
+}
+
+// typingScreen is implemented by screens taking text, which get every key,
+// the ones of the global key map included
+type typingScreen interface {
+	typing() bool
+}
+
+// appKeys is the global key map, handled by the app for every screen that
+// is not typing. Going back is left to the screens, as some of them have
+// something to settle first.
+var appKeys = struct {
+	quit string
+}{
+	quit: "ctrl+c",
+}
+
+// statusBarHeight is the blank line and the status bar below the screen
+const statusBarHeight = 2
+
+// appModel shows the screen on top of its stack above a status bar
+type appModel struct {
+	state  *appState
+	stack  []tea.Model
+	status string
+	// size is the terminal size, zero until it is known
+	size tea.WindowSizeMsg
+	// result is what the first screen went back with
+	result tea.Msg
+}
+
+func (m appModel) Init() tea.Cmd {
+	init := m.stack[len(m.stack)-1].Init()
+	if warning := configWarning(); warning != "" {
+		return tea.Batch(init, setStatus("%s", warning))
+	}
+	return init
+}
+
+// Update handles msg, then shows the warnings about the config files that
+// handling it, or a hook, ran into
+func (m appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	model, cmd := m.update(msg)
+	if warning := configWarning(); warning != "" {
+		m = model.(appModel)
+		m.status = warning
+		return m, cmd
+	}
+	return model, cmd
+}
+
+// configWarning joins the warnings config.TakeWarnings returns
+func configWarning() string {
+	return strings.Join(config.TakeWarnings(), "; ")
+}
+
+func (m appModel) update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.size = msg
+		return m.updateTop(m.screenSize())
+
+	case tea.KeyMsg:
+		if msg.String() == appKeys.quit && !m.typing() {
+			return m, tea.Quit
+		}
+
+	case pushScreenMsg:
+		m.status = ""
+		m.stack = append(m.stack, msg.screen)
+		init := msg.screen.Init()
+		if m.size.Width == 0 {
+			return m, init
+		}
+		m, cmd := m.resize()
+		return m, tea.Batch(init, cmd)
+
+	case backMsg:
+		m.status = ""
+		m.stack = m.stack[:len(m.stack)-1]
+		if len(m.stack) == 0 {
+			m.result = msg.result
+			return m, tea.Quit
+		}
+		// The size may have changed while the screen was covered
+		var cmds []tea.Cmd
+		if m.size.Width != 0 {
+			var cmd tea.Cmd
+			m, cmd = m.resize()
+			cmds = append(cmds, cmd)
+		}
+		// The result goes through update, so a screen can go back with a
+		// message of the app such as unlockVaultMsg
+		if msg.result != nil {
+			model, cmd := m.update(msg.result)
+			m = model.(appModel)
+			cmds = append(cmds, cmd)
+		}
+		return m, tea.Batch(cmds...)
+
+	case statusMsg:
+		m.status = string(msg)
+		return m, nil
+
+	case quitAppMsg:
+		return m, tea.Quit
+
+	case unlockVaultMsg:
+		return m, m.state.unlockVault(msg)
+
+	case vaultUnlockedMsg:
+		return m, vaultUnlocked(msg)
+
+	case sessionOpenedMsg:
+		// The connection was closed while its session was being opened
+		if msg.session != nil && msg.conn != m.state.conn {
+			msg.session.Close()
+			return m, nil
+		}
+	}
+
+	return m.updateTop(msg)
+}
+
+// updateTop hands msg to the screen on top of the stack
+func (m appModel) updateTop(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if len(m.stack) == 0 {
+		return m, nil
+	}
+	top := len(m.stack) - 1
+	var cmd tea.Cmd
+	m.stack[top], cmd = m.stack[top].Update(msg)
+	return m, cmd
+}
+
+// resize tells the screen on top of the stack how much room it has
+func (m appModel) resize() (appModel, tea.Cmd) {
+	model, cmd := m.updateTop(m.screenSize())
+	return model.(appModel), cmd
+}
+
+// screenSize is the terminal size left to the screens
+func (m appModel) screenSize() tea.WindowSizeMsg {
+	return tea.WindowSizeMsg{Width: m.size.Width, Height: max(m.size.Height-statusBarHeight, 0)}
+}
+
+// typing reports whether the screen on top takes every key
+func (m appModel) typing() bool {
+	if len(m.stack) == 0 {
+		return false
+	}
+	screen, ok := m.stack[len(m.stack)-1].(typingScreen)
+	return ok && screen.typing()
+}
+
+func (m appModel) View() string {
+	if len(m.stack) == 0 {
+		return ""
+	}
+	return m.stack[len(m.stack)-1].View() + "\n\n" + m.statusBar()
+}
+
+// statusBar shows the connection, the status line and the global keys
+func (m appModel) statusBar() string {
+	nameStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("0")).
+		Background(lipgloss.Color("6")).
+		Bold(true).
+		Padding(0, 1)
+	hint := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+
+	connection := "not connected"
+	if conn := m.state.conn; conn != nil {
+		connection = conn.Details.DBName
+		if conn.Name != "" {
+			connection = fmt.Sprintf("%s (%s)", conn.Name, conn.Details.DBName)
+		}
+	}
+	left := nameStyle.Render("maxim") + " " + hint.Render(connection)
+	if m.status != "" {
+		left += hint.Render(" | ") + lipgloss.NewStyle().Foreground(lipgloss.Color("11")).Render(m.status)
+	}
+
+	keys := hint.Render("Esc: back | Ctrl+C: quit")
+	gap := m.size.Width - lipgloss.Width(left) - lipgloss.Width(keys)
+	if gap < 1 {
+		return left + " " + keys
+	}
+	return left + strings.Repeat(" ", gap) + keys
+}
+
+// RunApp runs the app until the user quits it. It starts from the main
+// menu, or from the operations menu of conn when conn is not nil, and
+// closes conn when it is done.
+func RunApp(hooks AppHooks, conn *Connection) error {
+	state := &appState{hooks: hooks}
+	defer state.disconnect()
+	if history, err := config.DefaultHistory(); err == nil {
+		state.history = history
+	}
+
+	var first tea.Model = initialMainMenuModel(state)
+	if conn != nil {
+		state.connect(conn)
+		first = initialDBOperationsModel(state)
+	}
+	_, err := runApp(state, first)
+	return err
+}
+
+// runApp runs the app from first and returns the result first went back
+// with, nil when it had none or the user quit. The commands use it to show
+// a single screen, such as a form, with an empty state.
+func runApp(state *appState, first tea.Model) (tea.Msg, error) {
+	m, err := tea.NewProgram(appModel{state: state, stack: []tea.Model{first}}).Run()
+	if err != nil {
+		return nil, err
+	}
+	return m.(appModel).result, nil
+}
@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// environmentBanner renders the environment label of a connection, red for
+// production, or returns "" when the connection has none
+func environmentBanner(details config.ConnectionDetails) string {
+	environment := strings.TrimSpace(details.Environment)
+	if environment == "" {
+		return ""
+	}
+
+	label := " " + strings.ToUpper(environment) + " "
+	if details.ReadOnly {
+		label += "- READ ONLY "
+	}
+
+	style := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("15")).
+		Background(lipgloss.Color("8"))
+	if details.IsProduction() {
+		style = style.Background(lipgloss.Color("9"))
+	}
+	return style.Render(label)
+}
@@ -0,0 +1,156 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// completionRows is the number of suggestions the popup shows at once
+const completionRows = 8
+
+// completionPopup lists the completions for the word at the cursor of the
+// SQL editor
+type completionPopup struct {
+	open   bool
+	items  []db.Completion
+	cursor int
+}
+
+// show opens the popup on the given completions. It stays closed when there
+// are none.
+func (c *completionPopup) show(completions []db.Completion) {
+	c.items = completions
+	c.cursor = 0
+	c.open = len(c.items) > 0
+}
+
+// update handles a key while the popup is open. It returns the accepted
+// completion, and whether the key was used; other keys close the popup and
+// go on to the textarea.
+func (c *completionPopup) update(msg tea.KeyMsg) (string, bool) {
+	switch msg.String() {
+	case "esc":
+		c.open = false
+		return "", true
+	case "enter":
+		c.open = false
+		return c.items[c.cursor].Text, true
+	case "up", "ctrl+p", "shift+tab":
+		c.cursor = (c.cursor + len(c.items) - 1) % len(c.items)
+		return "", true
+	case "down", "ctrl+n", "tab", "ctrl+@":
+		c.cursor = (c.cursor + 1) % len(c.items)
+		return "", true
+	}
+	c.open = false
+	return "", false
+}
+
+// view renders the popup as a small bordered list, each completion followed
+// by what it is
+func (c completionPopup) view(width int) string {
+	start := 0
+	if c.cursor >= completionRows {
+		start = c.cursor - completionRows + 1
+	}
+	end := min(start+completionRows, len(c.items))
+
+	textWidth := 0
+	for _, item := range c.items[start:end] {
+		textWidth = max(textWidth, lipgloss.Width(item.Text))
+	}
+
+	detail := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	lines := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		about := c.items[i].Kind.String()
+		if c.items[i].Detail != "" {
+			about += " " + c.items[i].Detail
+		}
+		text := c.items[i].Text + strings.Repeat(" ", textWidth-lipgloss.Width(c.items[i].Text))
+		item := truncateCell(text+"  "+about, max(width-4, 4))
+		if i == c.cursor {
+			lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Bold(true).Render("> "+item))
+		} else {
+			lines = append(lines, "  "+detail.Render(item))
+		}
+	}
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("205")).
+		Render(strings.Join(lines, "\n"))
+}
+
+// overlay draws the popup over the bottom of the textarea view, or over its
+// top when the cursor is near the bottom, so it never hides the cursor line
+func (c completionPopup) overlay(editor string, width, cursorRow int) string {
+	lines := strings.Split(editor, "\n")
+	popup := strings.Split(c.view(width), "\n")
+	if len(popup) >= len(lines) {
+		return editor
+	}
+
+	start := len(lines) - len(popup)
+	if cursorRow >= start {
+		start = 0
+	}
+	copy(lines[start:], popup)
+	return strings.Join(lines, "\n")
+}
+
+// cursorOffset returns the byte offset of the textarea cursor in its value,
+// and the cursor row counted in wrapped lines from the top of the text
+func cursorOffset(ta textarea.Model) (int, int) {
+	lines := strings.Split(ta.Value(), "\n")
+	row := min(ta.Line(), len(lines)-1)
+	info := ta.LineInfo()
+	col := info.StartColumn + info.ColumnOffset
+
+	offset, visualRow := 0, info.RowOffset
+	for _, line := range lines[:row] {
+		offset += len(line) + 1
+		visualRow += max(1, (len([]rune(line))+ta.Width()-1)/max(ta.Width(), 1))
+	}
+	current := []rune(lines[row])
+	offset += len(string(current[:min(col, len(current))]))
+	return offset, visualRow
+}
+
+// replaceWord replaces the word around the textarea cursor with
+// replacement, leaving the cursor after it. The quotes around a quoted name
+// are replaced too when replacement is quoted.
+func replaceWord(ta *textarea.Model, replacement string) {
+	lines := strings.Split(ta.Value(), "\n")
+	row := min(ta.Line(), len(lines)-1)
+	info := ta.LineInfo()
+	line := []rune(lines[row])
+	col := min(info.StartColumn+info.ColumnOffset, len(line))
+
+	start, end := col, col
+	for start > 0 && db.IsIdentifierRune(line[start-1]) {
+		start--
+	}
+	for end < len(line) && db.IsIdentifierRune(line[end]) {
+		end++
+	}
+	if quote := []rune(replacement); len(quote) > 0 && (quote[0] == '"' || quote[0] == '`') {
+		if start > 0 && line[start-1] == quote[0] {
+			start--
+		}
+		if end < len(line) && line[end] == quote[0] {
+			end++
+		}
+	}
+
+	for range col - start {
+		*ta, _ = ta.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+	}
+	for range end - col {
+		*ta, _ = ta.Update(tea.KeyMsg{Type: tea.KeyDelete})
+	}
+	ta.InsertString(replacement)
+}
@@ -0,0 +1,477 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// PickerAction is what the user chose to do in the connection picker
+type PickerAction int
+
+const (
+	PickerQuit PickerAction = iota
+	PickerConnect
+	PickerNew
+	PickerEdit
+	PickerDuplicate
+	PickerRename
+	PickerDelete
+)
+
+// PickerResult holds the chosen action and the connection it applies to.
+// NewName is only set for PickerRename.
+type PickerResult struct {
+	Action  PickerAction
+	Name    string
+	NewName string
+}
+
+// connectionPickerModel lists the saved connections, filtered by whatever
+// the user types. The row after the last connection opens a new one.
+type connectionPickerModel struct {
+	app      *appState
+	saved    []config.SavedConnection
+	filtered []int
+	cursor   int
+	filter   textinput.Model
+
+	renaming      bool
+	rename        textinput.Model
+	confirmDelete bool
+
+	// working is set from a choice until it is carried out, and keys other
+	// than quitting wait for it. pending is the choice the connect form is
+	// shown for.
+	working bool
+	pending PickerResult
+}
+
+// choiceMsg carries out a choice once the vault is unlocked
+type choiceMsg struct {
+	choice PickerResult
+}
+
+// openSavedMsg opens a saved connection, with the password the user typed
+// when it is not nil
+type openSavedMsg struct {
+	name     string
+	password *string
+}
+
+// choiceDoneMsg carries the outcome of a choice: the connection it opened,
+// if any, and the status to show. name is the saved connection it opened.
+type choiceDoneMsg struct {
+	name   string
+	conn   *Connection
+	status string
+	err    error
+}
+
+func initialConnectionPickerModel(app *appState, saved []config.SavedConnection) connectionPickerModel {
+	filter := textinput.New()
+	filter.Placeholder = "type to filter"
+	filter.Prompt = ""
+	filter.CharLimit = 64
+	filter.Focus()
+
+	rename := textinput.New()
+	rename.Prompt = ""
+	rename.CharLimit = 64
+
+	m := connectionPickerModel{app: app, saved: saved, filter: filter, rename: rename}
+	m.applyFilter()
+	return m
+}
+
+// applyFilter keeps the connections whose name, host, user or database
+// contain the filter text, ignoring case
+func (m *connectionPickerModel) applyFilter() {
+	query := strings.ToLower(strings.TrimSpace(m.filter.Value()))
+	m.filtered = nil
+	for i, c := range m.saved {
+		haystack := strings.ToLower(strings.Join([]string{c.Name, c.Details.Host, c.Details.User, c.Details.DBName}, " "))
+		if query == "" || strings.Contains(haystack, query) {
+			m.filtered = append(m.filtered, i)
+		}
+	}
+	if m.cursor > len(m.filtered) {
+		m.cursor = len(m.filtered)
+	}
+}
+
+// selected returns the connection under the cursor, or nil on the new
+// connection row
+func (m connectionPickerModel) selected() *config.SavedConnection {
+	if m.cursor >= len(m.filtered) {
+		return nil
+	}
+	return &m.saved[m.filtered[m.cursor]]
+}
+
+func (m connectionPickerModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// typing is always set, as every key other than the ones of the picker
+// goes to the filter
+func (m connectionPickerModel) typing() bool {
+	return true
+}
+
+func (m connectionPickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case choiceMsg:
+		return m.carryOut(msg.choice)
+	case openSavedMsg:
+		return m.openSaved(msg)
+	case ConnectResult:
+		return m.submitted(msg)
+	case choiceDoneMsg:
+		return m.choiceDone(msg)
+	}
+
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		var cmd tea.Cmd
+		if m.renaming {
+			m.rename, cmd = m.rename.Update(msg)
+		} else {
+			m.filter, cmd = m.filter.Update(msg)
+		}
+		return m, cmd
+	}
+
+	if key.String() == appKeys.quit {
+		return m, quitApp
+	}
+	if m.working {
+		return m, nil
+	}
+
+	if m.confirmDelete {
+		m.confirmDelete = false
+		if key.String() == "y" {
+			return m.finish(PickerResult{Action: PickerDelete, Name: m.selected().Name})
+		}
+		return m, nil
+	}
+
+	if m.renaming {
+		switch key.Type {
+		case tea.KeyEsc:
+			m.renaming = false
+			m.filter.Focus()
+			return m, nil
+		case tea.KeyEnter:
+			newName := strings.TrimSpace(m.rename.Value())
+			if newName == "" {
+				return m, nil
+			}
+			return m.finish(PickerResult{Action: PickerRename, Name: m.selected().Name, NewName: newName})
+		}
+		var cmd tea.Cmd
+		m.rename, cmd = m.rename.Update(msg)
+		return m, cmd
+	}
+
+	switch key.String() {
+	case "esc":
+		if m.filter.Value() != "" {
+			m.filter.SetValue("")
+			m.applyFilter()
+			return m, nil
+		}
+		return m.finish(PickerResult{Action: PickerQuit})
+	case "up", "ctrl+p":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+		return m, nil
+	case "down", "ctrl+n":
+		if m.cursor < len(m.filtered) {
+			m.cursor++
+		}
+		return m, nil
+	case "enter":
+		if c := m.selected(); c != nil {
+			return m.finish(PickerResult{Action: PickerConnect, Name: c.Name})
+		}
+		return m.finish(PickerResult{Action: PickerNew})
+	case "ctrl+o":
+		return m.finish(PickerResult{Action: PickerNew})
+	case "ctrl+e":
+		if c := m.selected(); c != nil {
+			return m.finish(PickerResult{Action: PickerEdit, Name: c.Name})
+		}
+		return m, nil
+	case "ctrl+d":
+		if c := m.selected(); c != nil {
+			return m.finish(PickerResult{Action: PickerDuplicate, Name: c.Name})
+		}
+		return m, nil
+	case "ctrl+r":
+		if c := m.selected(); c != nil {
+			m.renaming = true
+			m.rename.SetValue(c.Name)
+			m.rename.CursorEnd()
+			m.filter.Blur()
+			return m, m.rename.Focus()
+		}
+		return m, nil
+	case "ctrl+x":
+		if m.selected() != nil {
+			m.confirmDelete = true
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.filter, cmd = m.filter.Update(msg)
+	m.applyFilter()
+	return m, cmd
+}
+
+// finish carries out the choice once the vault is unlocked, as every
+// choice other than quitting reads or changes the saved passwords
+func (m connectionPickerModel) finish(result PickerResult) (tea.Model, tea.Cmd) {
+	if result.Action == PickerQuit {
+		return m, back(nil)
+	}
+	m.working = true
+	return m, m.app.withVault(choiceMsg{result})
+}
+
+// carryOut opens the connection or the connect form of a choice, or
+// changes the saved connections
+func (m connectionPickerModel) carryOut(choice PickerResult) (tea.Model, tea.Cmd) {
+	switch choice.Action {
+	case PickerConnect:
+		return m.openSaved(openSavedMsg{name: choice.Name})
+
+	case PickerNew:
+		m.pending = choice
+		return m, push(initialConnectFormModel())
+
+	case PickerEdit, PickerDuplicate:
+		details, err := config.LoadDatabaseConnection(choice.Name)
+		if err != nil {
+			return m.choiceDone(choiceDoneMsg{err: fmt.Errorf("could not load connection '%s': %w", choice.Name, err)})
+		}
+		name := choice.Name
+		if choice.Action == PickerDuplicate {
+			name += " copy"
+		}
+		m.pending = choice
+		return m, push(connectFormFor(name, *details))
+
+	case PickerRename:
+		if err := config.RenameDatabaseConnection(choice.Name, choice.NewName); err != nil {
+			return m.choiceDone(choiceDoneMsg{err: err})
+		}
+		return m.choiceDone(choiceDoneMsg{status: fmt.Sprintf("Renamed '%s' to '%s'.", choice.Name, choice.NewName)})
+
+	case PickerDelete:
+		if err := config.DeleteDatabaseConnection(choice.Name); err != nil {
+			return m.choiceDone(choiceDoneMsg{err: err})
+		}
+		return m.choiceDone(choiceDoneMsg{status: fmt.Sprintf("Deleted '%s'.", choice.Name)})
+	}
+	return m.choiceDone(choiceDoneMsg{})
+}
+
+// openSaved connects to a saved connection through the OpenSaved hook
+func (m connectionPickerModel) openSaved(msg openSavedMsg) (tea.Model, tea.Cmd) {
+	open := m.app.hooks.OpenSaved
+	return m, tea.Sequence(setStatus("Connecting to '%s'...", msg.name), func() tea.Msg {
+		conn, status, err := open(msg.name, msg.password)
+		return choiceDoneMsg{name: msg.name, conn: conn, status: status, err: err}
+	})
+}
+
+// submitted opens and saves the connection of the connect form, or saves
+// the saved connection it was shown for
+func (m connectionPickerModel) submitted(result ConnectResult) (tea.Model, tea.Cmd) {
+	if result.Quitting {
+		return m.choiceDone(choiceDoneMsg{})
+	}
+
+	choice := m.pending
+	if choice.Action == PickerNew {
+		open := m.app.hooks.OpenNew
+		return m, tea.Sequence(setStatus("Connecting..."), func() tea.Msg {
+			conn, status, err := open(result)
+			return choiceDoneMsg{conn: conn, status: status, err: err}
+		})
+	}
+	save := m.app.hooks.SaveConnection
+	return m, func() tea.Msg {
+		status, err := save(choice.Name, result, choice.Action == PickerDuplicate)
+		return choiceDoneMsg{status: status, err: err}
+	}
+}
+
+// choiceDone asks for the password when the connection needs one. Otherwise
+// it lists the saved connections again, as the choice may have changed
+// them, and opens the operations menu of the connection opened, if any.
+func (m connectionPickerModel) choiceDone(msg choiceDoneMsg) (tea.Model, tea.Cmd) {
+	var needed *PasswordNeededError
+	if errors.As(msg.err, &needed) {
+		return m, push(newPasswordPrompt(fmt.Sprintf("Connect to '%s'", msg.name),
+			fmt.Sprintf("Password for '%s': ", needed.User),
+			func(password string) tea.Msg { return openSavedMsg{name: msg.name, password: &password} },
+			choiceDoneMsg{}))
+	}
+
+	m.working = false
+	m.renaming = false
+	m.rename.Blur()
+	focus := m.filter.Focus()
+
+	saved, err := config.ListSavedConnections()
+	if err != nil {
+		return m, tea.Batch(focus, setStatus("Error: could not load saved connections: %v", err))
+	}
+	m.saved = saved
+	m.applyFilter()
+
+	if msg.err != nil {
+		return m, tea.Batch(focus, setStatus("Error: %v", msg.err))
+	}
+
+	// The status comes after the push, which clears it
+	var cmds []tea.Cmd
+	if msg.conn != nil {
+		m.app.connect(msg.conn)
+		cmds = append(cmds, push(initialDBOperationsModel(m.app)))
+	}
+	if msg.status != "" {
+		cmds = append(cmds, setStatus("%s", msg.status))
+	}
+	return m, tea.Batch(focus, tea.Sequence(cmds...))
+}
+
+func (m connectionPickerModel) View() string {
+	var b strings.Builder
+
+	headerStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("205")).
+		Bold(true)
+	b.WriteString(headerStyle.Render("Saved Connections"))
+	b.WriteString("\n\n")
+	b.WriteString("Filter: ")
+	b.WriteString(m.filter.View())
+	b.WriteString("\n\n")
+
+	rows := [][]string{{"NAME", "HOST", "PORT", "USER", "DATABASE", "LAST USED"}}
+	for _, i := range m.filtered {
+		c := m.saved[i]
+		host := c.Details.Host
+		if c.Details.SocketDir != "" {
+			host = c.Details.SocketDir
+		}
+		if dialect, err := db.GetDialect(c.Details.Engine()); err == nil && dialect.FileBased() {
+			host = "(file)"
+		}
+		rows = append(rows, []string{
+			truncateCell(c.Name, 30),
+			truncateCell(host, 30),
+			c.Details.Port,
+			truncateCell(c.Details.User, 20),
+			truncateCell(c.Details.DBName, 40),
+			formatLastUsed(c.Details.LastUsed),
+		})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+
+	dimStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	selectedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("6")).Bold(true)
+	for r, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = cell + strings.Repeat(" ", widths[i]-len([]rune(cell)))
+		}
+		line := strings.Join(cells, "  ")
+
+		switch {
+		case r == 0:
+			b.WriteString("  " + dimStyle.Render(line))
+		case r-1 == m.cursor:
+			b.WriteString("> " + selectedStyle.Render(line))
+		default:
+			b.WriteString("  " + line)
+		}
+		b.WriteString("\n")
+	}
+	if len(m.filtered) == 0 && len(m.saved) > 0 {
+		b.WriteString(dimStyle.Italic(true).Render("  No saved connections match the filter."))
+		b.WriteString("\n")
+	}
+
+	newRow := "+ New connection"
+	if m.cursor == len(m.filtered) {
+		b.WriteString("> " + selectedStyle.Render(newRow))
+	} else {
+		b.WriteString("  " + newRow)
+	}
+	b.WriteString("\n")
+
+	switch {
+	case m.renaming:
+		b.WriteString("\nNew name: ")
+		b.WriteString(m.rename.View())
+		b.WriteString("\n(Enter to rename, Esc to cancel)")
+		return b.String()
+	case m.confirmDelete:
+		b.WriteString("\n")
+		b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("9")).
+			Render(fmt.Sprintf("Delete '%s'? (y/N)", m.selected().Name)))
+		return b.String()
+	}
+
+	b.WriteString("\n(Enter to connect, Ctrl+O new, Ctrl+E edit, Ctrl+D duplicate, Ctrl+R rename, Ctrl+X delete, Esc to go back)")
+	return b.String()
+}
+
+// formatLastUsed shows recent times relative to now and older ones as a date
+func formatLastUsed(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	since := time.Since(t)
+	switch {
+	case since < time.Minute:
+		return "just now"
+	case since < time.Hour:
+		return fmt.Sprintf("%dm ago", int(since.Minutes()))
+	case since < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(since.Hours()))
+	case since < 7*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(since.Hours()/24))
+	}
+	return t.Local().Format("2006-01-02")
+}
+
+func truncateCell(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	if limit <= 3 {
+		return string(runes[:limit])
+	}
+	return string(runes[:limit-3]) + "..."
+}
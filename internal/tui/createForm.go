@@ -8,24 +8,71 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
+// CreateFormModel asks for the details of a new database and its user. It
+// goes back with a CreateResult.
 type CreateFormModel struct {
 	focusIndex int
 	Inputs     []textinput.Model
-	Quitting   bool
 }
 
-func RunCreateForm() (CreateFormModel, error) {
-	m, err := tea.NewProgram(initialCreateFormModel()).Run()
+// CreateResult holds the submitted form. Quitting is set when the user
+// closed the form.
+type CreateResult struct {
+	DBName   string
+	User     string
+	Password string
+	// Schemas are the schemas to create in the database, none when the
+	// form did not ask for them
+	Schemas  []string
+	Quitting bool
+}
+
+// RunCreateForm shows the create form on its own, for the create command.
+// With withSchemas, for engines with schemas, it also asks for the schemas
+// to create in the database.
+func RunCreateForm(withSchemas bool) (CreateResult, error) {
+	result, err := runApp(&appState{}, initialCreateFormModel(withSchemas))
 	if err != nil {
-		return CreateFormModel{}, err
+		return CreateResult{}, err
+	}
+	if result, ok := result.(CreateResult); ok {
+		return result, nil
+	}
+	return CreateResult{Quitting: true}, nil
+}
+
+// result builds the result from the inputs
+func (m CreateFormModel) result() CreateResult {
+	result := CreateResult{
+		DBName:   m.Inputs[0].Value(),
+		User:     m.Inputs[1].Value(),
+		Password: m.Inputs[2].Value(),
 	}
-	return m.(CreateFormModel), nil
+	if len(m.Inputs) > 3 {
+		result.Schemas = parseSchemas(m.Inputs[3].Value())
+	}
+	return result
 }
 
-func initialCreateFormModel() CreateFormModel {
+// parseSchemas splits a comma-separated list of schemas, dropping empty
+// entries
+func parseSchemas(value string) []string {
+	var schemas []string
+	for _, schema := range strings.Split(value, ",") {
+		if schema = strings.TrimSpace(schema); schema != "" {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+func initialCreateFormModel(withSchemas bool) CreateFormModel {
 	m := CreateFormModel{
 		Inputs: make([]textinput.Model, 3),
 	}
+	if withSchemas {
+		m.Inputs = append(m.Inputs, textinput.Model{})
+	}
 
 	var t textinput.Model
 	for i := range m.Inputs {
@@ -44,6 +91,9 @@ func initialCreateFormModel() CreateFormModel {
 			t.Placeholder = "password"
 			t.EchoMode = textinput.EchoPassword
 			t.EchoCharacter = '•'
+		case 3:
+			t.Placeholder = "public (comma-separated, optional)"
+			t.CharLimit = 1024
 		}
 		m.Inputs[i] = t
 	}
@@ -54,12 +104,18 @@ func (m CreateFormModel) Init() tea.Cmd {
 	return textinput.Blink
 }
 
+// typing is always set, as the form takes text
+func (m CreateFormModel) typing() bool {
+	return true
+}
+
 func (m CreateFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if msg, ok := msg.(tea.KeyMsg); ok {
 		switch msg.String() {
-		case "ctrl+c", "esc":
-			m.Quitting = true
-			return m, tea.Quit
+		case appKeys.quit:
+			return m, quitApp
+		case "esc":
+			return m, back(CreateResult{Quitting: true})
 		}
 	}
 
@@ -68,7 +124,7 @@ func (m CreateFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.Type {
 		case tea.KeyEnter:
 			if m.focusIndex == len(m.Inputs)-1 {
-				return m, tea.Quit
+				return m, back(m.result())
 			}
 			m.nextInput()
 		case tea.KeyTab, tea.KeyCtrlN:
@@ -83,20 +139,17 @@ func (m CreateFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m CreateFormModel) View() string {
-	if m.Quitting {
-		return ""
-	}
 	var b strings.Builder
 	b.WriteString("Enter Details for New Database and User\n\n")
 
-	labels := []string{"Database Name: ", "Username:      ", "Password:      "}
+	labels := []string{"Database Name: ", "Username:      ", "Password:      ", "Schemas:       "}
 	for i := range m.Inputs {
 		b.WriteString(labels[i])
 		b.WriteString(m.Inputs[i].View())
 		b.WriteRune('\n')
 	}
 
-	b.WriteString("\n(press Enter to submit, Esc to quit)")
+	b.WriteString("\n(press Enter to submit, Esc to cancel)")
 	return b.String()
 }
 
@@ -4,23 +4,20 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/charmbracelet/bubbles/table"
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
 type dataViewerModel struct {
 	tableName string
-	columns   []table.Column
-	rows      []table.Row
-	done      bool
+	data      *db.ResultSet
 }
 
-func initialDataViewerModel(tableName string, columns []table.Column, rows []table.Row) dataViewerModel {
+func initialDataViewerModel(tableName string, data *db.ResultSet) dataViewerModel {
 	return dataViewerModel{
 		tableName: tableName,
-		columns:   columns,
-		rows:      rows,
+		data:      data,
 	}
 }
 
@@ -32,19 +29,14 @@ func (m dataViewerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "ctrl+c", "q", "esc", "enter":
-			m.done = true
-			return m, tea.Quit
+		case "q", "esc", "enter":
+			return m, back(nil)
 		}
 	}
 	return m, nil
 }
 
 func (m dataViewerModel) View() string {
-	if m.done {
-		return ""
-	}
-
 	var b strings.Builder
 
 	// Simple title
@@ -52,33 +44,33 @@ func (m dataViewerModel) View() string {
 		Foreground(lipgloss.Color("6")).
 		Bold(true).
 		MarginBottom(1)
-	b.WriteString(titleStyle.Render(fmt.Sprintf(" Table: %s (%d rows)", m.tableName, len(m.rows))))
+	rowCount := fmt.Sprintf("%d rows", len(m.data.Rows))
+	if m.data.Truncated {
+		rowCount = fmt.Sprintf("first %d rows", len(m.data.Rows))
+	}
+	b.WriteString(titleStyle.Render(fmt.Sprintf(" Table: %s (%s)", m.tableName, rowCount)))
 	b.WriteString("\n\n")
 
-	if len(m.rows) == 0 {
+	if len(m.data.Rows) == 0 {
 		noDataStyle := lipgloss.NewStyle().
 			Foreground(lipgloss.Color("8")).
 			Italic(true)
 		b.WriteString(noDataStyle.Render(" No data found in this table"))
 		b.WriteString("\n\n")
 	} else {
-		// Calculate column widths
-		columnWidths := make([]int, len(m.columns))
-		for i, col := range m.columns {
-			width := len(col.Title)
-			if width < 12 {
-				width = 12
-			}
-			columnWidths[i] = width
+		// Calculate column widths, leaving room for the padding
+		columnWidths := resultColumnWidths(m.data)
+		for i := range columnWidths {
+			columnWidths[i] = max(columnWidths[i], 10) + 2
 		}
 
 		// Simple table header
 		headerRow := ""
-		for i, col := range m.columns {
+		for i, col := range m.data.Columns {
 			headerStyle := lipgloss.NewStyle().
 				Foreground(lipgloss.Color("3")).
 				Bold(true)
-			headerText := headerStyle.Render(fmt.Sprintf(" %-*s ", columnWidths[i]-2, col.Title))
+			headerText := headerStyle.Render(fmt.Sprintf(" %-*s ", columnWidths[i]-2, truncateCell(col.Name, columnWidths[i]-2)))
 			headerRow += headerText + "│"
 		}
 		b.WriteString("│" + headerRow)
@@ -97,17 +89,11 @@ func (m dataViewerModel) View() string {
 		b.WriteString("\n")
 
 		// Data rows - show all data
-		for _, row := range m.rows {
+		for _, row := range m.data.Rows {
 			// Build row content
 			rowContent := ""
 			for j, cell := range row {
-				// Convert cell to string properly
-				cellValue := fmt.Sprintf("%v", cell)
-
-				// Truncate long values
-				if len(cellValue) > columnWidths[j]-2 {
-					cellValue = cellValue[:columnWidths[j]-5] + "..."
-				}
+				cellValue := formatCell(cell, columnWidths[j]-2)
 
 				// Pad the cell content
 				paddedValue := fmt.Sprintf(" %-*s ", columnWidths[j]-2, cellValue)
@@ -141,12 +127,6 @@ func (m dataViewerModel) View() string {
 		Foreground(lipgloss.Color("8")).
 		Italic(true)
 
-	b.WriteString(footerStyle.Render("Press any key to close"))
+	b.WriteString(footerStyle.Render("Press Enter, q or Esc to close"))
 	return b.String()
 }
-
-func RunDataViewer(tableName string, columns []table.Column, rows []table.Row) error {
-	p := tea.NewProgram(initialDataViewerModel(tableName, columns, rows))
-	_, err := p.Run()
-	return err
-}
@@ -1,30 +1,81 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
+// Choices of the operations menu
+const (
+	opListTables = iota
+	opShowData
+	opEditor
+	opSchemas
+)
+
 type dbOperationsModel struct {
-	cursor   int
-	choices  []string
-	done     bool
-	quitting bool
-	dbName   string
+	app     *appState
+	cursor  int
+	choices []string
+	dbName  string
+	banner  string
+	// tables are the tables listed for picking, picking the choice the
+	// table is picked for
+	tables  []db.TableName
+	picking int
+	// openingSession is set while the editor session is being opened, so
+	// choosing the editor again does not open another one
+	openingSession bool
+}
+
+// tablesLoadedMsg carries the tables listed for a choice of the menu
+type tablesLoadedMsg struct {
+	choice int
+	tables []db.TableName
+	err    error
 }
 
-func initialDBOperationsModel(dbName string) dbOperationsModel {
-	return dbOperationsModel{
-		dbName: dbName,
+// tableDataMsg carries the rows of the table picked to show its data
+type tableDataMsg struct {
+	table db.TableName
+	data  *db.ResultSet
+	err   error
+}
+
+// schemasLoadedMsg carries the schemas to choose the browsed ones from
+type schemasLoadedMsg struct {
+	schemas []string
+	err     error
+}
+
+// sessionOpenedMsg carries the editor session opened on conn
+type sessionOpenedMsg struct {
+	conn    *Connection
+	session *db.Session
+	err     error
+}
+
+func initialDBOperationsModel(app *appState) dbOperationsModel {
+	details := app.conn.Details
+	m := dbOperationsModel{
+		app:    app,
+		dbName: details.DBName,
+		banner: environmentBanner(details),
 		choices: []string{
 			"List all tables",
 			"Show table data",
 			"Editor",
 		},
 	}
+	if app.schemas != nil {
+		m.choices = append(m.choices, "Choose schemas")
+	}
+	return m
 }
 
 func (m dbOperationsModel) Init() tea.Cmd {
@@ -33,11 +84,59 @@ func (m dbOperationsModel) Init() tea.Cmd {
 
 func (m dbOperationsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tablesLoadedMsg:
+		if msg.err != nil {
+			return m, setStatus("Error fetching tables: %v", msg.err)
+		}
+		m.tables = msg.tables
+		m.picking = msg.choice
+		names := make([]string, len(m.tables))
+		for i, table := range m.tables {
+			names[i] = table.String()
+		}
+		return m, push(initialTableListModel(names))
+
+	case tableChosenMsg:
+		table := m.tables[msg.index]
+		if m.picking == opListTables {
+			return m, setStatus("Selected table: %s", table)
+		}
+		return m, m.loadData(table)
+
+	case tableDataMsg:
+		if msg.err != nil {
+			return m, setStatus("Error fetching table data: %v", msg.err)
+		}
+		return m, push(initialDataViewerModel(msg.table.String(), msg.data))
+
+	case schemasLoadedMsg:
+		if msg.err != nil {
+			return m, setStatus("Error fetching schemas: %v", msg.err)
+		}
+		return m, push(initialSchemaSelectorModel(msg.schemas, m.app.schemas))
+
+	case schemasChosenMsg:
+		m.app.schemas = msg.schemas
+		return m, nil
+
+	case sessionOpenedMsg:
+		m.openingSession = false
+		if msg.err != nil {
+			return m, setStatus("Error running SQL editor: %v", msg.err)
+		}
+		if m.app.session != nil {
+			// Keep the session the editor already runs on
+			msg.session.Close()
+		} else {
+			m.app.session = msg.session
+		}
+		return m, m.openEditor()
+
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "ctrl+c", "q", "esc":
-			m.quitting = true
-			return m, tea.Quit
+		case "q", "esc":
+			m.app.disconnect()
+			return m, back(nil)
 		case "up", "k":
 			if m.cursor > 0 {
 				m.cursor--
@@ -47,26 +146,102 @@ func (m dbOperationsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.cursor++
 			}
 		case "enter":
-			m.done = true
-			return m, tea.Quit
+			if m.cursor == opEditor && m.app.session == nil {
+				if m.openingSession {
+					return m, nil
+				}
+				m.openingSession = true
+			}
+			return m, m.choose()
 		}
 	}
 	return m, nil
 }
 
-func (m dbOperationsModel) View() string {
-	if m.done || m.quitting {
-		return ""
+// choose starts the operation under the cursor
+func (m dbOperationsModel) choose() tea.Cmd {
+	switch m.cursor {
+	case opListTables, opShowData:
+		return m.loadTables(m.cursor)
+	case opEditor:
+		return m.openEditor()
+	case opSchemas:
+		return m.loadSchemas()
 	}
+	return nil
+}
+
+// loadTables lists the tables of the browsed schemas, within the statement
+// timeout of the connection. Tables in a schema are listed with it, as
+// schema.table.
+func (m dbOperationsModel) loadTables(choice int) tea.Cmd {
+	conn, schemas := m.app.conn, m.app.schemas
+	return func() tea.Msg {
+		ctx, cancel := statementContext(conn.Details.Timeout())
+		defer cancel()
+		tables, err := db.GetTablesContext(ctx, conn.DB, conn.Details.Engine(), schemas)
+		return tablesLoadedMsg{choice: choice, tables: tables, err: err}
+	}
+}
+
+// loadData fetches the first rows of a table
+func (m dbOperationsModel) loadData(table db.TableName) tea.Cmd {
+	conn := m.app.conn
+	return func() tea.Msg {
+		ctx, cancel := statementContext(conn.Details.Timeout())
+		defer cancel()
+		data, err := db.GetTableDataContext(ctx, conn.DB, conn.Details.Engine(), table)
+		return tableDataMsg{table: table, data: data, err: err}
+	}
+}
+
+// loadSchemas lists the schemas of the database
+func (m dbOperationsModel) loadSchemas() tea.Cmd {
+	conn := m.app.conn
+	return func() tea.Msg {
+		ctx, cancel := statementContext(conn.Details.Timeout())
+		defer cancel()
+		schemas, err := db.ListSchemasContext(ctx, conn.DB, conn.Details.Engine())
+		return schemasLoadedMsg{schemas: schemas, err: err}
+	}
+}
+
+// openEditor shows the editor on the session of the connection, opening
+// the session first. The editor keeps one connection from the pool so
+// transactions span queries.
+func (m dbOperationsModel) openEditor() tea.Cmd {
+	conn := m.app.conn
+	if m.app.session == nil {
+		return func() tea.Msg {
+			session, err := db.NewSession(context.Background(), conn.DB, conn.Details.Engine(), conn.Details.ReadOnly)
+			return sessionOpenedMsg{conn: conn, session: session, err: err}
+		}
+	}
+
+	editor := initialSQLEditorModel(m.app.session, conn.DB, conn.Name, conn.Details)
+	editor.history = m.app.history
+	return push(editor)
+}
 
+func (m dbOperationsModel) View() string {
 	var b strings.Builder
 
+	if m.banner != "" {
+		b.WriteString(m.banner)
+		b.WriteString("\n\n")
+	}
+
 	// Header with database name
 	headerStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("205")).
 		Bold(true).
 		MarginBottom(1)
 	b.WriteString(headerStyle.Render(fmt.Sprintf("Database: %s", m.dbName)))
+	if m.app.schemas != nil {
+		b.WriteString("\n")
+		b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("8")).
+			Render("Schemas: " + describeSchemas(m.app.schemas)))
+	}
 	b.WriteString("\n\n")
 
 	b.WriteString("What would you like to do?\n\n")
@@ -80,21 +255,6 @@ func (m dbOperationsModel) View() string {
 		b.WriteString(fmt.Sprintf("%s %s\n", cursor, choice))
 	}
 
-	b.WriteString("\n(press q to quit)")
+	b.WriteString("\n(press q to go back)")
 	return b.String()
 }
-
-func RunDBOperationsMenu(dbName string) (int, error) {
-	p := tea.NewProgram(initialDBOperationsModel(dbName))
-	m, err := p.Run()
-	if err != nil {
-		return 0, err
-	}
-
-	model := m.(dbOperationsModel)
-	if model.quitting {
-		return -1, nil // Special value to indicate quit
-	}
-
-	return model.cursor, nil
-}
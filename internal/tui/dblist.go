@@ -19,8 +19,8 @@ func (m dbListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "q", "ctrl+c", "esc":
-			return m, tea.Quit
+		case "q", "esc":
+			return m, back(nil)
 		}
 	}
 	return m, nil
@@ -32,13 +32,12 @@ func (m dbListModel) View() string {
 	for _, name := range m.dbNames {
 		b.WriteString(fmt.Sprintf("- %s\n", name))
 	}
-	b.WriteString("\n(press 'q' to quit)")
+	b.WriteString("\n(press 'q' to close)")
 	return b.String()
 }
 
+// RunDBList shows the database list on its own, for the list command
 func RunDBList(dbNames []string) error {
-	model := dbListModel{dbNames: dbNames}
-	p := tea.NewProgram(model)
-	_, err := p.Run()
+	_, err := runApp(&appState{}, dbListModel{dbNames: dbNames})
 	return err
 }
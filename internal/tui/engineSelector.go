@@ -0,0 +1,96 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// engineSelector is a single-line picker over the registered database
+// dialects, cycled with the left and right keys
+type engineSelector struct {
+	dbTypes []string
+	index   int
+	focused bool
+}
+
+// newEngineSelector lists the registered dialects. With serverOnly set,
+// file-based engines are left out since they have no users to administer.
+func newEngineSelector(serverOnly bool) engineSelector {
+	var dbTypes []string
+	for _, dbType := range db.DialectTypes() {
+		dialect, _ := db.GetDialect(dbType)
+		if serverOnly && dialect.FileBased() {
+			continue
+		}
+		dbTypes = append(dbTypes, dbType)
+	}
+	return engineSelector{dbTypes: dbTypes, focused: true}
+}
+
+func (s engineSelector) dbType() string {
+	return s.dbTypes[s.index]
+}
+
+func (s engineSelector) dialect() db.Dialect {
+	dialect, _ := db.GetDialect(s.dbType())
+	return dialect
+}
+
+// selectType moves the selector to dbType, leaving it unchanged when the
+// type is not listed
+func (s *engineSelector) selectType(dbType string) {
+	for i, t := range s.dbTypes {
+		if t == dbType {
+			s.index = i
+			return
+		}
+	}
+}
+
+func (s *engineSelector) next() {
+	s.index = (s.index + 1) % len(s.dbTypes)
+}
+
+func (s *engineSelector) prev() {
+	s.index--
+	if s.index < 0 {
+		s.index = len(s.dbTypes) - 1
+	}
+}
+
+func (s engineSelector) View() string {
+	label := "< " + s.dialect().Name() + " >"
+	if s.focused {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Render(label)
+	}
+	return label
+}
+
+// valueOrPlaceholder returns the input value, falling back to the engine
+// default shown as placeholder when the field was left empty
+func valueOrPlaceholder(t textinput.Model) string {
+	if v := strings.TrimSpace(t.Value()); v != "" {
+		return v
+	}
+	return t.Placeholder
+}
+
+// prefillHost puts a default host into the host input, or into the socket
+// input when it is a socket directory as libpq allows in PGHOST
+func prefillHost(host, socket *textinput.Model, value string) {
+	if strings.HasPrefix(value, "/") {
+		prefillInput(socket, value)
+		return
+	}
+	prefillInput(host, value)
+}
+
+// prefillInput sets a default value unless it is empty
+func prefillInput(t *textinput.Model, value string) {
+	if value != "" {
+		t.SetValue(value)
+	}
+}
@@ -0,0 +1,206 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// historyBrowser lists past queries, newest first, filtered by a fuzzy
+// search. It is shown inside the SQL editor rather than as its own program.
+type historyBrowser struct {
+	open    bool
+	entries []config.HistoryEntry
+	matches []config.HistoryEntry
+	cursor  int
+	filter  textinput.Model
+	err     string
+}
+
+func newHistoryBrowser() historyBrowser {
+	filter := textinput.New()
+	filter.Prompt = "Search: "
+	filter.Placeholder = "type to filter"
+	filter.CharLimit = 255
+	return historyBrowser{filter: filter}
+}
+
+// show opens the browser on the given history, oldest entry first as the
+// history file keeps them. Repeated queries are listed once, at their most
+// recent run.
+func (b *historyBrowser) show(entries []config.HistoryEntry, err error) {
+	b.open = true
+	b.err = ""
+	if err != nil {
+		b.err = err.Error()
+	}
+
+	seen := make(map[string]bool)
+	b.entries = b.entries[:0]
+	for i := len(entries) - 1; i >= 0; i-- {
+		query := strings.TrimSpace(entries[i].Query)
+		if query == "" || seen[query] {
+			continue
+		}
+		seen[query] = true
+		b.entries = append(b.entries, entries[i])
+	}
+
+	b.filter.SetValue("")
+	b.filter.Focus()
+	b.applyFilter()
+}
+
+func (b *historyBrowser) hide() {
+	b.open = false
+	b.filter.Blur()
+}
+
+// update handles a key while the browser is open. It returns the query to
+// recall once the user picks one.
+func (b *historyBrowser) update(msg tea.KeyMsg) (string, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		b.hide()
+		return "", nil
+	case "enter":
+		b.hide()
+		if b.cursor < len(b.matches) {
+			return b.matches[b.cursor].Query, nil
+		}
+		return "", nil
+	case "up", "ctrl+p":
+		if b.cursor > 0 {
+			b.cursor--
+		}
+		return "", nil
+	case "down", "ctrl+n":
+		if b.cursor < len(b.matches)-1 {
+			b.cursor++
+		}
+		return "", nil
+	}
+
+	previous := b.filter.Value()
+	var cmd tea.Cmd
+	b.filter, cmd = b.filter.Update(msg)
+	if b.filter.Value() != previous {
+		b.applyFilter()
+	}
+	return "", cmd
+}
+
+// applyFilter keeps the entries whose query fuzzily matches the filter,
+// best match first and newest first among equal matches
+func (b *historyBrowser) applyFilter() {
+	b.cursor = 0
+	pattern := strings.TrimSpace(b.filter.Value())
+	if pattern == "" {
+		b.matches = b.entries
+		return
+	}
+
+	type scored struct {
+		entry config.HistoryEntry
+		score int
+	}
+	var found []scored
+	for _, entry := range b.entries {
+		if score, ok := fuzzyScore(pattern, entry.Query); ok {
+			found = append(found, scored{entry, score})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].score > found[j].score
+	})
+
+	b.matches = make([]config.HistoryEntry, len(found))
+	for i, f := range found {
+		b.matches[i] = f.entry
+	}
+}
+
+// fuzzyScore matches the runes of pattern in order against text, ignoring
+// case. Matches that follow each other or start a word score higher.
+func fuzzyScore(pattern, text string) (int, bool) {
+	patternRunes := []rune(strings.ToLower(pattern))
+	score, p := 0, 0
+	previousMatched := false
+	var previous rune = ' '
+	for _, r := range strings.ToLower(text) {
+		if p == len(patternRunes) {
+			break
+		}
+		if r == patternRunes[p] {
+			score++
+			if previousMatched {
+				score += 5
+			}
+			if !unicode.IsLetter(previous) && !unicode.IsDigit(previous) {
+				score += 3
+			}
+			p++
+			previousMatched = true
+		} else {
+			previousMatched = false
+		}
+		previous = r
+	}
+	return score, p == len(patternRunes)
+}
+
+// view renders the browser to fit the given size
+func (b historyBrowser) view(width, height int) string {
+	var s strings.Builder
+	s.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("6")).Bold(true).Render("Query history"))
+	s.WriteString("\n")
+	s.WriteString(b.filter.View())
+	s.WriteString("\n\n")
+
+	hint := lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Italic(true)
+	switch {
+	case b.err != "":
+		s.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("Error: " + b.err))
+		s.WriteString("\n")
+	case len(b.matches) == 0:
+		s.WriteString(hint.Render("No matching queries"))
+		s.WriteString("\n")
+	}
+
+	// Keep the cursor in view, leaving room for the title, the filter and
+	// the help line
+	rows := max(height-5, 1)
+	start := 0
+	if b.cursor >= rows {
+		start = b.cursor - rows + 1
+	}
+	end := min(start+rows, len(b.matches))
+
+	for i := start; i < end; i++ {
+		entry := b.matches[i]
+		status := "ok "
+		if !entry.Success {
+			status = "err"
+		}
+		prefix := fmt.Sprintf("%s %s %6s  ", entry.Time.Local().Format("2006-01-02 15:04"), status, formatElapsed(entry.Duration))
+		query := strings.Join(strings.Fields(entry.Query), " ")
+		line := prefix + truncateCell(query, max(width-len(prefix)-2, 4))
+
+		if i == b.cursor {
+			s.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Bold(true).Render("> " + line))
+		} else {
+			s.WriteString("  " + line)
+		}
+		s.WriteString("\n")
+	}
+
+	s.WriteString("\n")
+	s.WriteString(hint.Render("Enter: recall | Up/Down: move | Esc: close"))
+	return s.String()
+}
@@ -1,21 +1,65 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// Choices of the main menu
+const (
+	menuConnect = iota
+	menuCreate
+	menuList
+)
+
 type mainMenuModel struct {
-	cursor   int
-	choices  []string
-	done     bool
-	quitting bool
+	app     *appState
+	cursor  int
+	choices []string
+	// working is set from choosing to create or list databases until that
+	// is done, and choosing waits for it. adminFor is
+	// the choice the superuser connection is opened for, and admin that
+	// connection while the create form is shown.
+	working  bool
+	adminFor int
+	admin    *AdminConnection
+}
+
+// adminConnectMsg opens the superuser connection, with the password the
+// user typed when it is not nil
+type adminConnectMsg struct {
+	password *string
+}
+
+// adminConnectedMsg carries the outcome of the ConnectAdmin and SaveAdmin
+// hooks. It has neither a connection nor an error when the user cancelled.
+type adminConnectedMsg struct {
+	conn   *AdminConnection
+	status string
+	err    error
 }
 
-func initialMainMenuModel() mainMenuModel {
+// databasesMsg carries the databases listed as the superuser
+type databasesMsg struct {
+	names  []string
+	status string
+	err    error
+}
+
+// databaseCreatedMsg carries the outcome of creating a database
+type databaseCreatedMsg struct {
+	result CreateResult
+	err    error
+}
+
+func initialMainMenuModel(app *appState) mainMenuModel {
 	return mainMenuModel{
+		app:     app,
 		choices: []string{"Connect to a DB", "create a new DB", "List all DBs"},
 	}
 }
@@ -26,11 +70,52 @@ func (m mainMenuModel) Init() tea.Cmd {
 
 func (m mainMenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case adminConnectMsg:
+		connect := m.app.hooks.ConnectAdmin
+		return m, tea.Sequence(setStatus("Connecting as the superuser..."), func() tea.Msg {
+			conn, err := connect(msg.password)
+			return adminConnectedMsg{conn: conn, err: err}
+		})
+
+	case AdminResult:
+		if msg.Quitting {
+			m.working = false
+			return m, setStatus("Cancelled: operation aborted by user.")
+		}
+		save := m.app.hooks.SaveAdmin
+		return m, tea.Sequence(setStatus("Connecting as the superuser..."), func() tea.Msg {
+			conn, status, err := save(msg)
+			return adminConnectedMsg{conn: conn, status: status, err: err}
+		})
+
+	case adminConnectedMsg:
+		return m.adminConnected(msg)
+
+	case CreateResult:
+		return m.createDatabase(msg)
+
+	case databaseCreatedMsg:
+		m.working = false
+		if msg.err != nil {
+			return m, setStatus("Error: failed to create database/user: %v", msg.err)
+		}
+		return m, setStatus("Success: created database '%s' and user '%s'.", msg.result.DBName, msg.result.User)
+
+	case databasesMsg:
+		m.working = false
+		if msg.err != nil {
+			return m, setStatus("Could not fetch database list: %v", msg.err)
+		}
+		cmd := push(dbListModel{dbNames: msg.names})
+		if msg.status != "" {
+			cmd = tea.Sequence(cmd, setStatus("%s", msg.status))
+		}
+		return m, cmd
+
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "ctrl+c", "q":
-			m.quitting = true
-			return m, tea.Quit
+		case "q", "esc":
+			return m, back(nil)
 		case "up", "k":
 			if m.cursor > 0 {
 				m.cursor--
@@ -40,17 +125,91 @@ func (m mainMenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.cursor++
 			}
 		case "enter":
-			m.done = true
-			return m, tea.Quit
+			return m.choose()
 		}
 	}
 	return m, nil
 }
 
-func (m mainMenuModel) View() string {
-	if m.done || m.quitting {
-		return ""
+// choose starts the flow of the choice under the cursor
+func (m mainMenuModel) choose() (tea.Model, tea.Cmd) {
+	if m.working {
+		return m, nil
+	}
+	switch m.cursor {
+	case menuConnect:
+		// Connect flow - pick a saved connection or add a new one
+		saved, err := config.ListSavedConnections()
+		if err != nil {
+			return m, setStatus("Error: could not load saved connections: %v", err)
+		}
+		return m, push(initialConnectionPickerModel(m.app, saved))
+	case menuCreate, menuList:
+		m.working = true
+		m.adminFor = m.cursor
+		return m, m.app.withVault(adminConnectMsg{})
 	}
+	return m, nil
+}
+
+// adminConnected goes on with the choice the superuser connection was
+// opened for, or asks for what opening it needs
+func (m mainMenuModel) adminConnected(msg adminConnectedMsg) (tea.Model, tea.Cmd) {
+	var needed *PasswordNeededError
+	switch {
+	case errors.Is(msg.err, ErrNoAdminConnection):
+		return m, tea.Sequence(push(initialAdminFormModel()), setStatus("No saved superuser credentials found."))
+	case errors.As(msg.err, &needed):
+		return m, push(newPasswordPrompt("Connect as the superuser",
+			fmt.Sprintf("Password for '%s': ", needed.User),
+			func(password string) tea.Msg { return adminConnectMsg{password: &password} },
+			adminConnectedMsg{}))
+	case msg.err != nil:
+		m.working = false
+		return m, setStatus("Error: %v", msg.err)
+	case msg.conn == nil:
+		m.working = false
+		return m, setStatus("Cancelled: operation aborted by user.")
+	}
+
+	conn := msg.conn
+	if m.adminFor == menuList {
+		return m, func() tea.Msg {
+			defer conn.DB.Close()
+			names, err := db.ListDatabases(conn.DB, conn.Params.DBType)
+			return databasesMsg{names: names, status: msg.status, err: err}
+		}
+	}
+
+	m.admin = conn
+	cmd := push(initialCreateFormModel(hasSchemas(conn.Params.DBType)))
+	if msg.status != "" {
+		cmd = tea.Sequence(cmd, setStatus("%s", msg.status))
+	}
+	return m, cmd
+}
+
+// createDatabase creates the database and user of the create form as the
+// superuser, then closes the superuser connection
+func (m mainMenuModel) createDatabase(result CreateResult) (tea.Model, tea.Cmd) {
+	admin := m.admin
+	m.admin = nil
+	if admin == nil {
+		return m, nil
+	}
+	if result.Quitting {
+		admin.DB.Close()
+		m.working = false
+		return m, setStatus("Cancelled: database creation aborted by user.")
+	}
+	return m, tea.Sequence(setStatus("Creating database '%s'...", result.DBName), func() tea.Msg {
+		defer admin.DB.Close()
+		err := db.CreateDBAndUser(admin.DB, admin.Params, result.DBName, result.User, result.Password, result.Schemas)
+		return databaseCreatedMsg{result: result, err: err}
+	})
+}
+
+func (m mainMenuModel) View() string {
 	var b strings.Builder
 	b.WriteString("What would you like to do?\n\n")
 
@@ -65,18 +224,3 @@ func (m mainMenuModel) View() string {
 	b.WriteString("\n(press q to quit)")
 	return b.String()
 }
-
-func RunMainMenu() (int, error) {
-	p := tea.NewProgram(initialMainMenuModel())
-	m, err := p.Run()
-	if err != nil {
-		return -1, err
-	}
-
-	model := m.(mainMenuModel)
-	if model.quitting {
-		return -1, nil
-	}
-
-	return model.cursor, nil
-}
@@ -0,0 +1,74 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// passwordPrompt asks for a password or passphrase without echoing it. It
+// goes back with the message submit builds from the answer, which may be
+// empty, or with cancel on Esc.
+type passwordPrompt struct {
+	title  string
+	label  string
+	input  textinput.Model
+	err    string
+	submit func(password string) tea.Msg
+	cancel tea.Msg
+}
+
+func newPasswordPrompt(title, label string, submit func(password string) tea.Msg, cancel tea.Msg) passwordPrompt {
+	input := textinput.New()
+	input.Cursor.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	input.Prompt = ""
+	input.CharLimit = 1024
+	input.EchoMode = textinput.EchoPassword
+	input.EchoCharacter = '•'
+	input.Focus()
+	return passwordPrompt{title: title, label: label, input: input, submit: submit, cancel: cancel}
+}
+
+func (m passwordPrompt) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// typing is always set, as every key goes to the input
+func (m passwordPrompt) typing() bool {
+	return true
+}
+
+func (m passwordPrompt) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case appKeys.quit:
+			return m, quitApp
+		case "esc":
+			return m, back(m.cancel)
+		case "enter":
+			return m, back(m.submit(m.input.Value()))
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m passwordPrompt) View() string {
+	var b strings.Builder
+	b.WriteString(m.title)
+	b.WriteString("\n\n")
+	b.WriteString(m.label)
+	b.WriteString(m.input.View())
+	b.WriteString("\n")
+	if m.err != "" {
+		b.WriteString("\n")
+		b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("Error: " + m.err))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n(Enter to submit, Esc to cancel)")
+	return b.String()
+}
@@ -0,0 +1,168 @@
+package tui
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxCellWidth caps the width of a result column, longer values are truncated
+const maxCellWidth = 40
+
+// formatValue renders a result value for display
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05.999999999Z07:00")
+	case []byte:
+		return `\x` + hex.EncodeToString(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// formatCell renders a value on a single line, truncated to width
+func formatCell(value any, width int) string {
+	s := strings.NewReplacer("\r\n", " ", "\n", " ", "\t", " ").Replace(formatValue(value))
+	return truncateCell(s, width)
+}
+
+// resultColumnWidths sizes each column to its title and values, up to maxCellWidth
+func resultColumnWidths(data *db.ResultSet) []int {
+	widths := make([]int, len(data.Columns))
+	for i, col := range data.Columns {
+		widths[i] = min(len([]rune(col.Name)), maxCellWidth)
+	}
+	for _, row := range data.Rows {
+		for i, value := range row {
+			widths[i] = max(widths[i], len([]rune(formatCell(value, maxCellWidth))))
+		}
+	}
+	return widths
+}
+
+// renderResultTable draws a result set as a box-drawn table sized to its
+// contents
+func renderResultTable(data *db.ResultSet) string {
+	if len(data.Columns) == 0 {
+		return ""
+	}
+	widths := resultColumnWidths(data)
+
+	var b strings.Builder
+	writeRow := func(cells []string) {
+		b.WriteString("│")
+		for i, cell := range cells {
+			b.WriteString(" " + cell + strings.Repeat(" ", widths[i]-len([]rune(cell))) + " │")
+		}
+		b.WriteString("\n")
+	}
+
+	titles := make([]string, len(data.Columns))
+	for i, col := range data.Columns {
+		titles[i] = truncateCell(col.Name, widths[i])
+	}
+	writeRow(titles)
+
+	b.WriteString("├")
+	for i, width := range widths {
+		b.WriteString(strings.Repeat("─", width+2))
+		if i < len(widths)-1 {
+			b.WriteString("┼")
+		}
+	}
+	b.WriteString("┤\n")
+
+	for _, row := range data.Rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = formatCell(value, widths[i])
+		}
+		writeRow(cells)
+	}
+	return b.String()
+}
+
+// renderQueryResult formats the outcome of a query for the results panel
+func renderQueryResult(result db.QueryResult) string {
+	if !result.Success {
+		return result.Error
+	}
+
+	var b strings.Builder
+	b.WriteString("Query executed successfully!\n\n")
+	switch {
+	case result.Data == nil:
+		b.WriteString(result.CommandTag)
+		if result.HasRowsAffected {
+			b.WriteString(fmt.Sprintf("\nRows affected: %d", result.RowsAffected))
+		}
+		b.WriteString(fmt.Sprintf(" (%s)", formatElapsed(result.Elapsed)))
+		return b.String()
+	case len(result.Data.Columns) == 0:
+		// Statements such as WITH ... DELETE without RETURNING
+		b.WriteString(fmt.Sprintf("No rows returned (%s)", formatElapsed(result.Elapsed)))
+		return b.String()
+	}
+
+	b.WriteString(renderResultTable(result.Data))
+	if result.Data.Truncated {
+		b.WriteString(fmt.Sprintf("\n... (showing first %d rows only)\n", db.MaxResultRows))
+	}
+	b.WriteString(fmt.Sprintf("\nTotal rows: %d (%s)", result.RowCount, formatElapsed(result.Elapsed)))
+	return b.String()
+}
+
+// FormatScriptResult renders the result of a script as the SQL editor shows
+// it, for printing outside of it
+func FormatScriptResult(script db.ScriptResult) string {
+	return renderScriptResult(script)
+}
+
+// renderScriptResult renders the result of every statement of a script,
+// each under its position and the start of its SQL, followed by a summary.
+// A single statement is rendered on its own.
+func renderScriptResult(script db.ScriptResult) string {
+	if len(script.Results) == 0 {
+		return "No statements to execute."
+	}
+	if len(script.Results) == 1 && script.Skipped == 0 {
+		return renderQueryResult(script.Results[0])
+	}
+
+	total := len(script.Results) + script.Skipped
+	headerStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true)
+
+	var b strings.Builder
+	for i, result := range script.Results {
+		statement := strings.Join(strings.Fields(result.Statement), " ")
+		b.WriteString(headerStyle.Render(fmt.Sprintf("[%d/%d] %s", i+1, total, truncateCell(statement, maxCellWidth))))
+		b.WriteString("\n")
+		b.WriteString(renderQueryResult(result))
+		b.WriteString("\n\n")
+	}
+
+	b.WriteString(fmt.Sprintf("%d of %d statements succeeded", len(script.Results)-script.Failed(), total))
+	if script.Skipped > 0 {
+		b.WriteString(fmt.Sprintf(", %d skipped", script.Skipped))
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// schemaSelectorModel picks the schemas whose tables are browsed. Choosing
+// none means every schema.
+type schemaSelectorModel struct {
+	schemas  []string
+	selected map[string]bool
+	cursor   int
+}
+
+// schemasChosenMsg is the result of the schema selector: the schemas to
+// browse, empty for all of them
+type schemasChosenMsg struct {
+	schemas []string
+}
+
+func initialSchemaSelectorModel(schemas, selected []string) schemaSelectorModel {
+	m := schemaSelectorModel{schemas: schemas, selected: make(map[string]bool)}
+	for _, schema := range selected {
+		m.selected[schema] = true
+	}
+	return m
+}
+
+func (m schemaSelectorModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m schemaSelectorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc":
+			return m, back(nil)
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.schemas)-1 {
+				m.cursor++
+			}
+		case " ", "x":
+			if m.cursor < len(m.schemas) {
+				schema := m.schemas[m.cursor]
+				m.selected[schema] = !m.selected[schema]
+			}
+		case "a":
+			// Select every schema, or none when they all are
+			all := len(m.chosen()) == len(m.schemas)
+			for _, schema := range m.schemas {
+				m.selected[schema] = !all
+			}
+		case "enter":
+			return m, back(schemasChosenMsg{schemas: m.chosen()})
+		}
+	}
+	return m, nil
+}
+
+// chosen returns the selected schemas in listing order
+func (m schemaSelectorModel) chosen() []string {
+	schemas := []string{}
+	for _, schema := range m.schemas {
+		if m.selected[schema] {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+func (m schemaSelectorModel) View() string {
+	var b strings.Builder
+
+	headerStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("205")).
+		Bold(true).
+		MarginBottom(1)
+	b.WriteString(headerStyle.Render("Schemas to browse"))
+	b.WriteString("\n\n")
+
+	if len(m.schemas) == 0 {
+		noDataStyle := lipgloss.NewStyle().
+			Foreground(lipgloss.Color("8")).
+			Italic(true)
+		b.WriteString(noDataStyle.Render("No schemas found in this database."))
+		b.WriteString("\n\n")
+	}
+
+	schemaStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	for i, schema := range m.schemas {
+		cursor := " "
+		if m.cursor == i {
+			cursor = ">"
+		}
+		check := "[ ]"
+		if m.selected[schema] {
+			check = "[x]"
+		}
+		b.WriteString(fmt.Sprintf("%s %s %s\n", cursor, check, schemaStyle.Render(schema)))
+	}
+
+	b.WriteString("\n(Space to toggle, a for all, Enter to confirm, q to cancel; none selected shows every schema)")
+	return b.String()
+}
+
+// describeSchemas lists the schemas being browsed for a header
+func describeSchemas(schemas []string) string {
+	if len(schemas) == 0 {
+		return "all"
+	}
+	return strings.Join(schemas, ", ")
+}
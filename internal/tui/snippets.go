@@ -0,0 +1,300 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// snippetPicker lists the snippets of a connection, filtered by a fuzzy
+// search on their names. It is shown inside the SQL editor.
+type snippetPicker struct {
+	open     bool
+	snippets []config.Snippet
+	matches  []config.Snippet
+	cursor   int
+	filter   textinput.Model
+	err      string
+}
+
+func newSnippetPicker() snippetPicker {
+	filter := textinput.New()
+	filter.Prompt = "Search: "
+	filter.Placeholder = "type to filter"
+	filter.CharLimit = 255
+	return snippetPicker{filter: filter}
+}
+
+func (p *snippetPicker) show(snippets []config.Snippet, err error) {
+	p.open = true
+	p.snippets = snippets
+	p.err = ""
+	if err != nil {
+		p.err = err.Error()
+	}
+	p.filter.SetValue("")
+	p.filter.Focus()
+	p.applyFilter()
+}
+
+func (p *snippetPicker) hide() {
+	p.open = false
+	p.filter.Blur()
+}
+
+// update handles a key while the picker is open. It returns the chosen
+// snippet once the user picks one.
+func (p *snippetPicker) update(msg tea.KeyMsg) (*config.Snippet, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		p.hide()
+		return nil, nil
+	case "enter":
+		p.hide()
+		if p.cursor < len(p.matches) {
+			snippet := p.matches[p.cursor]
+			return &snippet, nil
+		}
+		return nil, nil
+	case "up", "ctrl+p":
+		if p.cursor > 0 {
+			p.cursor--
+		}
+		return nil, nil
+	case "down", "ctrl+n":
+		if p.cursor < len(p.matches)-1 {
+			p.cursor++
+		}
+		return nil, nil
+	}
+
+	previous := p.filter.Value()
+	var cmd tea.Cmd
+	p.filter, cmd = p.filter.Update(msg)
+	if p.filter.Value() != previous {
+		p.applyFilter()
+	}
+	return nil, cmd
+}
+
+// applyFilter keeps the snippets whose name fuzzily matches the filter,
+// best match first
+func (p *snippetPicker) applyFilter() {
+	p.cursor = 0
+	pattern := strings.TrimSpace(p.filter.Value())
+	if pattern == "" {
+		p.matches = p.snippets
+		return
+	}
+
+	type scored struct {
+		snippet config.Snippet
+		score   int
+	}
+	var found []scored
+	for _, snippet := range p.snippets {
+		if score, ok := fuzzyScore(pattern, snippet.Name); ok {
+			found = append(found, scored{snippet, score})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].score > found[j].score
+	})
+
+	p.matches = make([]config.Snippet, len(found))
+	for i, f := range found {
+		p.matches[i] = f.snippet
+	}
+}
+
+// view renders the picker to fit the given size
+func (p snippetPicker) view(width, height int) string {
+	var s strings.Builder
+	s.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("6")).Bold(true).Render("Snippets"))
+	s.WriteString("\n")
+	s.WriteString(p.filter.View())
+	s.WriteString("\n\n")
+
+	hint := lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Italic(true)
+	switch {
+	case p.err != "":
+		s.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("Error: " + p.err))
+		s.WriteString("\n")
+	case len(p.snippets) == 0:
+		s.WriteString(hint.Render("No snippets yet, add one with 'maxim snippet add'"))
+		s.WriteString("\n")
+	case len(p.matches) == 0:
+		s.WriteString(hint.Render("No matching snippets"))
+		s.WriteString("\n")
+	}
+
+	rows := max(height-5, 1)
+	start := 0
+	if p.cursor >= rows {
+		start = p.cursor - rows + 1
+	}
+	end := min(start+rows, len(p.matches))
+
+	for i := start; i < end; i++ {
+		snippet := p.matches[i]
+		about := snippet.Description
+		if about == "" {
+			about = strings.Join(strings.Fields(snippet.Query), " ")
+		}
+		line := truncateCell(fmt.Sprintf("%s  %s", snippet.Name, about), max(width-2, 4))
+
+		if i == p.cursor {
+			s.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Bold(true).Render("> " + line))
+		} else {
+			s.WriteString("  " + line)
+		}
+		s.WriteString("\n")
+	}
+
+	s.WriteString("\n")
+	s.WriteString(hint.Render("Enter: run | Up/Down: move | Esc: close"))
+	return s.String()
+}
+
+// paramForm asks for the values of the placeholders of a query, one input
+// per placeholder, and is used both inside the SQL editor and on its own
+type paramForm struct {
+	open   bool
+	title  string
+	query  string
+	names  []string
+	inputs []textinput.Model
+	focus  int
+}
+
+func newParamForm(title, query string, names []string) paramForm {
+	f := paramForm{open: true, title: title, query: query, names: names}
+	for _, name := range names {
+		t := textinput.New()
+		t.Cursor.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+		t.CharLimit = 4096
+		t.Prompt = ""
+		t.Placeholder = "value for " + name
+		f.inputs = append(f.inputs, t)
+	}
+	if len(f.inputs) > 0 {
+		f.inputs[0].Focus()
+	}
+	return f
+}
+
+// update handles a message while the form is open. It reports whether the
+// form was submitted; Esc closes it without submitting.
+func (f *paramForm) update(msg tea.Msg) (bool, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.Type {
+		case tea.KeyEsc, tea.KeyCtrlC:
+			f.open = false
+			return false, nil
+		case tea.KeyEnter:
+			if f.focus == len(f.inputs)-1 {
+				f.open = false
+				return true, nil
+			}
+			f.setFocus(f.focus + 1)
+			return false, nil
+		case tea.KeyTab, tea.KeyDown, tea.KeyCtrlN:
+			f.setFocus((f.focus + 1) % len(f.inputs))
+			return false, nil
+		case tea.KeyShiftTab, tea.KeyUp, tea.KeyCtrlP:
+			f.setFocus((f.focus + len(f.inputs) - 1) % len(f.inputs))
+			return false, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	f.inputs[f.focus], cmd = f.inputs[f.focus].Update(msg)
+	return false, cmd
+}
+
+func (f *paramForm) setFocus(index int) {
+	f.inputs[f.focus].Blur()
+	f.focus = index
+	f.inputs[f.focus].Focus()
+}
+
+// values returns the entered value of each placeholder
+func (f paramForm) values() map[string]string {
+	values := make(map[string]string, len(f.names))
+	for i, name := range f.names {
+		values[name] = f.inputs[i].Value()
+	}
+	return values
+}
+
+func (f paramForm) view() string {
+	width := 0
+	for _, name := range f.names {
+		width = max(width, len(name))
+	}
+
+	var b strings.Builder
+	b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("6")).Bold(true).Render("Parameters for " + f.title))
+	b.WriteString("\n\n")
+	for i, name := range f.names {
+		b.WriteString(fmt.Sprintf("%-*s  ", width+1, name+":"))
+		b.WriteString(f.inputs[i].View())
+		b.WriteRune('\n')
+	}
+	b.WriteString("\n")
+	b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Italic(true).
+		Render("Values are sent as bound parameters. Enter on the last field runs, Esc cancels."))
+	return b.String()
+}
+
+// paramFormScreen shows a paramForm as a screen of its own. It goes back
+// with the entered paramValuesMsg, or with nothing when the user closed it.
+type paramFormScreen struct {
+	form paramForm
+}
+
+// paramValuesMsg holds the value entered for each placeholder
+type paramValuesMsg map[string]string
+
+// RunParamForm asks for the values of the given placeholders of a snippet.
+// The values are nil when the user quit.
+func RunParamForm(title string, names []string) (map[string]string, error) {
+	result, err := runApp(&appState{}, paramFormScreen{form: newParamForm(title, "", names)})
+	if err != nil {
+		return nil, err
+	}
+	values, _ := result.(paramValuesMsg)
+	return values, nil
+}
+
+func (m paramFormScreen) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// typing is always set, as the form takes text
+func (m paramFormScreen) typing() bool {
+	return true
+}
+
+func (m paramFormScreen) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == appKeys.quit {
+		return m, quitApp
+	}
+	submitted, cmd := m.form.update(msg)
+	switch {
+	case submitted:
+		return m, back(paramValuesMsg(m.form.values()))
+	case !m.form.open:
+		return m, back(nil)
+	}
+	return m, cmd
+}
+
+func (m paramFormScreen) View() string {
+	return m.form.view()
+}
@@ -1,12 +1,17 @@
 package tui
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/config"
 	"github.com/ASHUTOSH-SWAIN-GIT/maxim/internal/db"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -15,15 +20,107 @@ import (
 type sqlEditorModel struct {
 	textarea textarea.Model
 	viewport viewport.Model
+	spinner  spinner.Model
 	ready    bool
-	db       *sql.DB
+	session  *db.Session
+	connName string
 	dbName   string
+	banner   string
+
+	// history records every executed statement, nil when the history file
+	// cannot be located; browser recalls past queries from it
+	history *config.History
+	browser historyBrowser
+
+	// snippets picks a saved snippet to run and params asks for the values
+	// of its placeholders
+	snippets snippetPicker
+	params   paramForm
+
+	// schema feeds the completion popup. It is loaded from pool in the
+	// background, so it is nil until the first load finishes. watcher
+	// keeps it in step with schema changes; stale is set when its last
+	// refresh failed.
+	pool          *sql.DB
+	dbType        string
+	schema        *db.SchemaCache
+	schemaLoading bool
+	schemaErr     string
+	watcher       *db.SchemaWatcher
+	stale         bool
+	completion    completionPopup
+	// searchPath is the search path the session switched to with SET
+	// search_path, which the pool the schema is loaded from does not see.
+	// It is nil until then.
+	searchPath []string
+
 	results  string
 	error    string
 	quitting bool
+
+	// timeout is the statement timeout of the connection, zero for none
+	timeout time.Duration
+	// continueOnError runs the rest of a script after a statement fails
+	continueOnError bool
+
+	// running is set while a query is in flight, started is when it was
+	// sent and cancel stops it. canceling is set once a cancel was asked for.
+	running   bool
+	canceling bool
+	cancel    context.CancelFunc
+	started   time.Time
+
+	// confirmQuit is set while asking whether to commit or roll back the
+	// open transaction before quitting, quitAfter when the editor quits as
+	// soon as the running query is done
+	confirmQuit bool
+	quitAfter   bool
+
+	// pendingQuery waits for the user to confirm each of its destructive
+	// statements in pendingChecks by typing the name shown into confirm.
+	// pendingParams holds the values of its placeholders when it is a
+	// snippet.
+	pendingQuery  string
+	pendingParams map[string]string
+	pendingChecks []db.StatementClass
+	confirm       textinput.Model
+	confirmErr    string
+}
+
+// queryDoneMsg carries the result of a script run by startQuery.
+// keepInput is set for snippets, which leave the textarea alone. searchPath
+// is the search path of the session after a script that may have changed it.
+type queryDoneMsg struct {
+	result     db.ScriptResult
+	historyErr error
+	keepInput  bool
+	searchPath []string
+}
+
+// schemaLoadedMsg carries the schema loaded by loadSchema and its watcher,
+// nil when the schema cannot be watched
+type schemaLoadedMsg struct {
+	schema  *db.SchemaCache
+	watcher *db.SchemaWatcher
+	err     error
 }
 
-func initialSQLEditorModel(db *sql.DB, dbName string) sqlEditorModel {
+// schemaChangedMsg reports a refresh of the schema by watcher. ok is false
+// once the watcher is closed.
+type schemaChangedMsg struct {
+	watcher *db.SchemaWatcher
+	change  db.SchemaChange
+	ok      bool
+}
+
+// txDoneMsg reports a commit or rollback started by endTransaction
+type txDoneMsg struct {
+	commit bool
+	quit   bool
+	err    error
+}
+
+func initialSQLEditorModel(session *db.Session, pool *sql.DB, connName string, details config.ConnectionDetails) sqlEditorModel {
 	ta := textarea.New()
 	ta.Placeholder = "Enter your SQL query here...\n\nExample:\nSELECT * FROM users;\nINSERT INTO users (name) VALUES ('John');\nUPDATE users SET name = 'Jane' WHERE id = 1;"
 	ta.Focus()
@@ -38,24 +135,79 @@ func initialSQLEditorModel(db *sql.DB, dbName string) sqlEditorModel {
 		"Instructions:\n" +
 		"• Type your SQL queries in the left panel\n" +
 		"• Press Ctrl+E to execute the query\n" +
+		"• Separate statements with semicolons to run a script\n" +
+		"• Press Ctrl+X to cancel a running query\n" +
+		"• Press Ctrl+T to stop or continue a script after an error\n" +
+		"• Press Ctrl+O to turn autocommit off and on\n" +
+		"• Press Ctrl+S to commit and Ctrl+Z to roll back\n" +
+		"• Press Ctrl+Y to search and recall past queries\n" +
+		"• Press Ctrl+G to run a saved snippet\n" +
+		"• Press Tab or Ctrl+Space to complete a table, column or keyword\n" +
+		"• The schema follows changes to the database, Ctrl+L reloads it\n" +
 		"• Results will appear in this panel\n" +
 		"• Press Ctrl+R to clear results\n" +
-		"• Press Esc to quit\n\n" +
+		"• Press Esc to go back\n\n" +
 		"Example queries:\n" +
 		"SELECT * FROM users;\n" +
 		"INSERT INTO users (name) VALUES ('John');\n" +
 		"UPDATE users SET name = 'Jane' WHERE id = 1;")
 
+	sp := spinner.New()
+	sp.Spinner = spinner.MiniDot
+	sp.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+
+	confirm := textinput.New()
+	confirm.Prompt = "> "
+	confirm.CharLimit = 255
+
 	return sqlEditorModel{
 		textarea: ta,
 		viewport: vp,
-		db:       db,
-		dbName:   dbName,
+		spinner:  sp,
+		confirm:  confirm,
+		session:  session,
+		pool:     pool,
+		dbType:   details.Engine(),
+		connName: connName,
+		dbName:   details.DBName,
+		browser:  newHistoryBrowser(),
+		snippets: newSnippetPicker(),
+		banner:   environmentBanner(details),
+		timeout:  details.Timeout(),
+
+		schemaLoading: true,
 	}
 }
 
 func (m sqlEditorModel) Init() tea.Cmd {
-	return textarea.Blink
+	return tea.Batch(textarea.Blink, m.loadSchema())
+}
+
+// loadSchema loads the tables, columns and functions for completion from a
+// command, on a pool connection of its own so queries are not held up, and
+// starts watching them for changes
+func (m sqlEditorModel) loadSchema() tea.Cmd {
+	pool, dbType := m.pool, m.dbType
+	return func() tea.Msg {
+		schema, err := db.NewSchemaCache(pool, dbType)
+		if err != nil {
+			return schemaLoadedMsg{err: err}
+		}
+		// Completion works without the watcher, only without refreshes
+		watcher, _ := schema.Watch(pool, db.WatchOptions{Notify: true})
+		return schemaLoadedMsg{schema: schema, watcher: watcher}
+	}
+}
+
+// waitSchemaChange waits for the next refresh of the schema by watcher
+func waitSchemaChange(watcher *db.SchemaWatcher) tea.Cmd {
+	if watcher == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		change, ok := <-watcher.Changes()
+		return schemaChangedMsg{watcher: watcher, change: change, ok: ok}
+	}
 }
 
 func (m sqlEditorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -91,21 +243,168 @@ func (m sqlEditorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.viewport.Height = msg.Height - verticalMarginHeight
 		}
 
+	case spinner.TickMsg:
+		// Stop ticking once the query is done
+		if !m.running {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case queryDoneMsg:
+		m.finishQuery(msg.result, !msg.keepInput)
+		if msg.searchPath != nil {
+			m.searchPath = msg.searchPath
+			if m.schema != nil {
+				m.schema.SetSearchPath(m.searchPath)
+			}
+		}
+		if msg.historyErr != nil {
+			m.viewport.SetContent(m.results + m.error + "\n\nCould not save query history: " + msg.historyErr.Error())
+		}
+		if m.quitAfter {
+			m.quitAfter = false
+			return m, m.quit()
+		}
+		return m, nil
+
+	case schemaLoadedMsg:
+		m.schemaLoading = false
+		m.schemaErr = ""
+		if msg.err != nil {
+			m.schemaErr = msg.err.Error()
+			return m, nil
+		}
+		m.schema = msg.schema
+		if m.searchPath != nil {
+			m.schema.SetSearchPath(m.searchPath)
+		}
+		if m.watcher != nil {
+			m.watcher.Close()
+		}
+		m.watcher = msg.watcher
+		m.stale = false
+		return m, waitSchemaChange(m.watcher)
+
+	case schemaChangedMsg:
+		// Changes from the watcher of a schema since reloaded are stale
+		if !msg.ok || msg.watcher != m.watcher {
+			return m, nil
+		}
+		m.stale = msg.change.Err != nil
+		return m, waitSchemaChange(m.watcher)
+
+	case txDoneMsg:
+		m.finishTransaction(msg)
+		if msg.quit && m.session.Status() == db.TxIdle {
+			return m, m.leave()
+		}
+		return m, nil
+
 	case tea.KeyMsg:
+		if m.confirmQuit {
+			switch msg.String() {
+			case "c":
+				return m, m.endTransaction(true, true)
+			case "r":
+				return m, m.endTransaction(false, true)
+			case "esc":
+				m.confirmQuit = false
+			}
+			return m, nil
+		}
+		if len(m.pendingChecks) > 0 {
+			return m, m.updateConfirm(msg)
+		}
+		if m.browser.open {
+			query, cmd := m.browser.update(msg)
+			if !m.browser.open {
+				m.textarea.Focus()
+				if query != "" {
+					m.textarea.SetValue(query)
+				}
+			}
+			return m, cmd
+		}
+		if m.snippets.open {
+			snippet, cmd := m.snippets.update(msg)
+			if !m.snippets.open {
+				m.textarea.Focus()
+				if snippet != nil {
+					return m, m.chooseSnippet(*snippet)
+				}
+			}
+			return m, cmd
+		}
+		if m.completion.open {
+			if completion, handled := m.completion.update(msg); handled {
+				if completion != "" {
+					replaceWord(&m.textarea, completion)
+				}
+				return m, nil
+			}
+		}
+		if m.params.open {
+			submitted, cmd := m.params.update(msg)
+			if !m.params.open {
+				m.textarea.Focus()
+				if submitted {
+					return m, m.runQuery(m.params.query, m.params.values())
+				}
+			}
+			return m, cmd
+		}
+
 		switch msg.Type {
 		case tea.KeyCtrlC:
-			m.quitting = true
-			return m, tea.Quit
+			// Like psql, Ctrl+C stops a running query before it quits
+			if m.running {
+				m.cancelQuery()
+				return m, nil
+			}
+			return m, m.quit()
 		case tea.KeyEsc:
-			m.quitting = true
-			return m, tea.Quit
+			return m, m.quit()
+		case tea.KeyCtrlS, tea.KeyCtrlZ:
+			if m.running {
+				return m, nil
+			}
+			return m, m.endTransaction(msg.Type == tea.KeyCtrlS, false)
+		case tea.KeyCtrlY:
+			m.openHistory()
+			return m, textinput.Blink
+		case tea.KeyTab, tea.KeyCtrlAt:
+			m.complete()
+			return m, nil
+		case tea.KeyCtrlL:
+			if m.schemaLoading {
+				return m, nil
+			}
+			m.schemaLoading = true
+			return m, m.loadSchema()
+		case tea.KeyCtrlG:
+			if m.running {
+				return m, nil
+			}
+			m.openSnippets()
+			return m, textinput.Blink
+		case tea.KeyCtrlO:
+			m.session.SetAutocommit(!m.session.Autocommit())
+			return m, nil
+		case tea.KeyCtrlX:
+			m.cancelQuery()
+			return m, nil
+		case tea.KeyCtrlT:
+			m.continueOnError = !m.continueOnError
+			return m, nil
 		case tea.KeyCtrlE:
 			// Execute SQL query
 			query := strings.TrimSpace(m.textarea.Value())
-			if query != "" {
-				m.executeQuery(query)
+			if query == "" || m.running {
+				return m, nil
 			}
-			return m, nil
+			return m, m.runQuery(query, nil)
 		case tea.KeyCtrlR:
 			// Clear results
 			m.results = ""
@@ -123,25 +422,309 @@ func (m sqlEditorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(tiCmd, vpCmd)
 }
 
-func (m *sqlEditorModel) executeQuery(query string) {
+// runQuery runs a query once its destructive statements are confirmed.
+// params holds the values of the placeholders of a snippet, and is nil for
+// a query typed into the editor.
+func (m *sqlEditorModel) runQuery(query string, params map[string]string) tea.Cmd {
+	if checks := m.destructiveStatements(query); len(checks) > 0 {
+		m.askConfirmation(query, params, checks)
+		return textinput.Blink
+	}
+	return m.startQuery(query, params)
+}
+
+// startQuery sends the query from a command, off the Update loop, so the
+// editor stays responsive and the query can be canceled
+func (m *sqlEditorModel) startQuery(query string, params map[string]string) tea.Cmd {
+	ctx := m.startRunning()
+	session, continueOnError := m.session, m.continueOnError
+	history, connName, dbName := m.history, m.connName, m.dbName
+	run := func() tea.Msg {
+		var result db.ScriptResult
+		if params != nil {
+			result = session.ExecuteWithParams(ctx, query, params, continueOnError)
+		} else {
+			result = session.Execute(ctx, query, continueOnError)
+		}
+		msg := queryDoneMsg{result: result, keepInput: params != nil}
+		if strings.Contains(strings.ToLower(query), "search_path") {
+			msg.searchPath, _ = session.SearchPath(context.Background())
+		}
+		if history != nil {
+			msg.historyErr = history.Append(HistoryEntries(result, connName, dbName)...)
+		}
+		return msg
+	}
+	return tea.Batch(m.spinner.Tick, run)
+}
+
+// destructiveStatements returns the statements of a script that need a
+// typed confirmation. A read-only session refuses them anyway, so it needs
+// none.
+func (m sqlEditorModel) destructiveStatements(query string) []db.StatementClass {
+	if m.session.ReadOnly() {
+		return nil
+	}
+	var checks []db.StatementClass
+	for _, statement := range m.session.Split(query) {
+		if class := m.session.Classify(statement); class.Destructive != "" {
+			checks = append(checks, class)
+		}
+	}
+	return checks
+}
+
+func (m *sqlEditorModel) askConfirmation(query string, params map[string]string, checks []db.StatementClass) {
+	m.pendingQuery = query
+	m.pendingParams = params
+	m.pendingChecks = checks
+	m.confirmErr = ""
+	m.confirm.SetValue("")
+	m.confirm.Focus()
+	m.textarea.Blur()
+}
+
+// updateConfirm handles the keys while a destructive statement waits for
+// confirmation. The script runs once every statement has been confirmed.
+func (m *sqlEditorModel) updateConfirm(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.clearConfirmation()
+		m.viewport.SetContent("Execution canceled, nothing was run.")
+		return nil
+	case tea.KeyEnter:
+		if strings.TrimSpace(m.confirm.Value()) != confirmWord(m.pendingChecks[0]) {
+			m.confirmErr = "That does not match, nothing was run."
+			return nil
+		}
+		m.pendingChecks = m.pendingChecks[1:]
+		m.confirmErr = ""
+		m.confirm.SetValue("")
+		if len(m.pendingChecks) > 0 {
+			return nil
+		}
+		query, params := m.pendingQuery, m.pendingParams
+		m.clearConfirmation()
+		return m.startQuery(query, params)
+	}
+
+	var cmd tea.Cmd
+	m.confirm, cmd = m.confirm.Update(msg)
+	return cmd
+}
+
+func (m *sqlEditorModel) clearConfirmation() {
+	m.pendingQuery = ""
+	m.pendingParams = nil
+	m.pendingChecks = nil
+	m.confirmErr = ""
+	m.confirm.Blur()
+	m.textarea.Focus()
+}
+
+// confirmWord is what the user types to confirm a destructive statement:
+// the object it acts on, or its verb when the object is not known
+func confirmWord(class db.StatementClass) string {
+	if class.Target != "" {
+		return class.Target
+	}
+	return strings.Fields(class.Destructive)[0]
+}
+
+// HistoryEntries turns the statements run by a script into history
+// entries. Skipped statements never ran and are left out.
+func HistoryEntries(result db.ScriptResult, connName, dbName string) []config.HistoryEntry {
+	entries := make([]config.HistoryEntry, 0, len(result.Results))
+	now := time.Now()
+	for _, r := range result.Results {
+		rows := int64(r.RowCount)
+		if r.HasRowsAffected {
+			rows = r.RowsAffected
+		}
+		entries = append(entries, config.HistoryEntry{
+			Time:       now,
+			Connection: connName,
+			Database:   dbName,
+			Query:      r.Statement,
+			Duration:   r.Elapsed,
+			Rows:       rows,
+			Success:    r.Success,
+			Error:      r.Error,
+		})
+	}
+	return entries
+}
+
+// openHistory loads the history into the browser
+func (m *sqlEditorModel) openHistory() {
+	if m.history == nil {
+		m.browser.show(nil, fmt.Errorf("query history is not available"))
+	} else {
+		m.browser.show(m.history.Load())
+	}
+	m.textarea.Blur()
+}
+
+// complete opens the completion popup for the word at the cursor
+func (m *sqlEditorModel) complete() {
+	if m.schema == nil {
+		if m.schemaErr != "" {
+			m.viewport.SetContent("Completion is not available, the schema failed to load:\n" + m.schemaErr)
+		}
+		return
+	}
+	offset, _ := cursorOffset(m.textarea)
+	m.completion.show(m.schema.Complete(m.textarea.Value(), offset))
+}
+
+// openSnippets loads the snippets of the connection into the picker
+func (m *sqlEditorModel) openSnippets() {
+	m.snippets.show(config.SnippetsFor(m.connName))
+	m.textarea.Blur()
+}
+
+// chooseSnippet runs the chosen snippet, asking for the values of its
+// placeholders first when it has any
+func (m *sqlEditorModel) chooseSnippet(snippet config.Snippet) tea.Cmd {
+	names := m.session.Params(snippet.Query)
+	if len(names) == 0 {
+		return m.runQuery(snippet.Query, map[string]string{})
+	}
+	m.params = newParamForm(snippet.Name, snippet.Query, names)
+	m.textarea.Blur()
+	return textinput.Blink
+}
+
+// endTransaction commits or rolls back the open transaction from a command,
+// and quits afterwards when quit is set
+func (m *sqlEditorModel) endTransaction(commit, quit bool) tea.Cmd {
+	m.confirmQuit = false
+	ctx := m.startRunning()
+	session := m.session
+	run := func() tea.Msg {
+		var err error
+		if commit {
+			err = session.Commit(ctx)
+		} else {
+			err = session.Rollback(ctx)
+		}
+		return txDoneMsg{commit: commit, quit: quit, err: err}
+	}
+	return tea.Batch(m.spinner.Tick, run)
+}
+
+// startRunning marks the editor busy and returns the context for the work,
+// bounded by the statement timeout
+func (m *sqlEditorModel) startRunning() context.Context {
+	ctx, cancel := statementContext(m.timeout)
+	m.running = true
+	m.canceling = false
+	m.cancel = cancel
+	m.started = time.Now()
+	return ctx
+}
+
+// stopRunning releases the context of the finished work
+func (m *sqlEditorModel) stopRunning() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.running = false
+	m.canceling = false
+	m.cancel = nil
+}
+
+// quit leaves the editor. A running query is canceled first, and an open
+// transaction is only left after the user chose to commit or roll it back.
+func (m *sqlEditorModel) quit() tea.Cmd {
+	if m.running {
+		m.cancelQuery()
+		m.quitAfter = true
+		return nil
+	}
+	if m.session.Status() != db.TxIdle {
+		m.confirmQuit = true
+		return nil
+	}
+	return m.leave()
+}
+
+// leave goes back to the previous screen, leaving the session to the next
+// editor
+func (m *sqlEditorModel) leave() tea.Cmd {
+	m.quitting = true
+	if m.watcher != nil {
+		m.watcher.Close()
+	}
+	return back(nil)
+}
+
+// typing is always set: the editor takes every key, and Ctrl+C cancels a
+// running query before it leaves
+func (m sqlEditorModel) typing() bool {
+	return true
+}
+
+// statementContext returns a context that is canceled after timeout, or
+// only when cancel is called when timeout is zero
+func statementContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// cancelQuery stops the running query, if any. The result arrives as a
+// queryDoneMsg once the driver gives up on it.
+func (m *sqlEditorModel) cancelQuery() {
+	if !m.running || m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.canceling = true
+}
+
+// finishQuery shows the result of a query, clearing the textarea after a
+// successful run when clearInput is set
+func (m *sqlEditorModel) finishQuery(result db.ScriptResult, clearInput bool) {
+	m.stopRunning()
+
 	// Clear previous results
 	m.results = ""
 	m.error = ""
 
-	// Execute the query using the separated database logic
-	result := db.ExecuteQuery(m.db, query)
-
-	if result.Success {
-		m.results = result.Data
+	switch {
+	case result.Failed() == 0 && result.Skipped == 0:
+		m.results = renderScriptResult(result)
 		m.viewport.SetContent(m.results)
 		// Clear the textarea after successful execution
-		m.textarea.SetValue("")
-	} else {
-		m.error = result.Error
+		if clearInput {
+			m.textarea.SetValue("")
+		}
+	default:
+		m.error = renderScriptResult(result)
 		m.viewport.SetContent(m.error)
 	}
 }
 
+func (m *sqlEditorModel) finishTransaction(msg txDoneMsg) {
+	m.stopRunning()
+
+	m.results = ""
+	m.error = ""
+	switch {
+	case msg.err != nil:
+		m.error = "Error: " + msg.err.Error()
+		m.viewport.SetContent(m.error)
+	case msg.commit:
+		m.results = "Transaction committed."
+		m.viewport.SetContent(m.results)
+	default:
+		m.results = "Transaction rolled back."
+		m.viewport.SetContent(m.results)
+	}
+}
+
 func (m sqlEditorModel) headerView() string {
 	title := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("6")).
@@ -151,20 +734,141 @@ func (m sqlEditorModel) headerView() string {
 	instructions := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("8")).
 		Italic(true).
-		Render("Ctrl+E: Execute | Ctrl+R: Clear | Esc: Quit")
+		Render("Ctrl+E: Execute | Ctrl+X: Cancel | Ctrl+T: On error | Ctrl+R: Clear | Esc: Back")
+
+	top := lipgloss.JoinHorizontal(lipgloss.Top, title, instructions)
+	if m.running {
+		status := fmt.Sprintf("%s Running %s", m.spinner.View(), formatElapsed(time.Since(m.started)))
+		if m.canceling {
+			status += " (canceling...)"
+		} else if m.timeout > 0 {
+			status += fmt.Sprintf(" (timeout %s)", m.timeout)
+		}
+		running := lipgloss.NewStyle().
+			Foreground(lipgloss.Color("3")).
+			Render(status)
+		top = lipgloss.JoinHorizontal(lipgloss.Top, title, instructions, "  ", running)
+	}
 
-	return lipgloss.JoinHorizontal(lipgloss.Top, title, instructions)
+	lines := []string{top, m.sessionView()}
+	if m.banner != "" {
+		lines = append([]string{m.banner}, lines...)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// sessionView shows the autocommit mode and transaction state, or the
+// commit or rollback question when quitting with a transaction open
+func (m sqlEditorModel) sessionView() string {
+	if m.confirmQuit {
+		return lipgloss.NewStyle().
+			Foreground(lipgloss.Color("9")).
+			Bold(true).
+			Render("A transaction is open: c to commit, r to roll back, Esc to keep editing")
+	}
+
+	autocommit := "on"
+	if !m.session.Autocommit() {
+		autocommit = "off"
+	}
+
+	status := m.session.Status()
+	statusStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	switch status {
+	case db.TxActive:
+		statusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true)
+	case db.TxFailed:
+		statusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true)
+	}
+
+	hint := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("8")).
+		Italic(true)
+	readOnly := ""
+	if m.session.ReadOnly() {
+		readOnly = lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true).Render("Read only") + hint.Render(" | ")
+	}
+	return readOnly + hint.Render(fmt.Sprintf("Autocommit: %s | Transaction: ", autocommit)) +
+		statusStyle.Render(status.String()) +
+		hint.Render(" | Ctrl+O: Autocommit | Ctrl+S: Commit | Ctrl+Z: Rollback")
 }
 
 func (m sqlEditorModel) footerView() string {
 	info := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("8")).
 		Italic(true).
-		Render("Left: SQL Query | Right: Results")
+		Render(fmt.Sprintf("Left: SQL Query | Right: Results | On error: %s | Schema: %s",
+			m.onErrorMode(), m.schemaStatus()))
 
 	return info
 }
 
+// schemaStatus describes the schema used for completion
+func (m sqlEditorModel) schemaStatus() string {
+	switch {
+	case m.schemaLoading:
+		return "loading..."
+	case m.schemaErr != "":
+		return "failed to load, Ctrl+L to retry"
+	case m.schema == nil:
+		return "not loaded"
+	case m.stale:
+		return fmt.Sprintf("%d tables, refresh failed, Ctrl+L to reload", m.schema.TableCount())
+	}
+	return fmt.Sprintf("%d tables, Tab to complete", m.schema.TableCount())
+}
+
+// confirmView asks for the name of the object the next destructive
+// statement acts on, shown in place of the results
+func (m sqlEditorModel) confirmView() string {
+	check := m.pendingChecks[0]
+	warning := fmt.Sprintf("%s will run", check.Destructive)
+	if check.Target != "" {
+		warning = fmt.Sprintf("%s on %s will run", check.Destructive, check.Target)
+	}
+	if len(m.pendingChecks) > 1 {
+		warning += fmt.Sprintf(" (%d more to confirm)", len(m.pendingChecks)-1)
+	}
+
+	var b strings.Builder
+	b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true).Render(warning))
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf("Type %s to run it, or press Esc to cancel:\n", confirmWord(check)))
+	b.WriteString(m.confirm.View())
+	if m.confirmErr != "" {
+		b.WriteString("\n")
+		b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render(m.confirmErr))
+	}
+	return b.String()
+}
+
+// onErrorMode describes what a script does after a failed statement
+func (m sqlEditorModel) onErrorMode() string {
+	if m.continueOnError {
+		return "continue"
+	}
+	return "stop"
+}
+
+// resultsView is the content of the right panel
+func (m sqlEditorModel) resultsView() string {
+	panel := lipgloss.NewStyle().
+		Width(m.viewport.Width).
+		Height(m.viewport.Height)
+	switch {
+	case m.browser.open:
+		return panel.Render(m.browser.view(m.viewport.Width, m.viewport.Height))
+	case m.snippets.open:
+		return panel.Render(m.snippets.view(m.viewport.Width, m.viewport.Height))
+	case m.params.open:
+		return panel.Render(m.params.view())
+	}
+	if len(m.pendingChecks) == 0 {
+		return m.viewport.View()
+	}
+	return panel.Render(m.confirmView())
+}
+
 func (m sqlEditorModel) View() string {
 	if m.quitting {
 		return ""
@@ -178,13 +882,19 @@ func (m sqlEditorModel) View() string {
 	headerContent := m.headerView()
 	footerContent := m.footerView()
 
+	editor := m.textarea.View()
+	if m.completion.open {
+		_, row := cursorOffset(m.textarea)
+		editor = m.completion.overlay(editor, m.textarea.Width(), min(row, m.textarea.Height()-1))
+	}
+
 	// Create left panel (SQL Query) with minimal styling to avoid clipping
 	leftPanel := lipgloss.NewStyle().
 		Border(lipgloss.NormalBorder()).
 		BorderForeground(lipgloss.Color("6")).
 		Padding(0, 1).
 		Width(m.textarea.Width() + 2).
-		Render(m.textarea.View())
+		Render(editor)
 
 	// Create right panel (Results) with minimal styling to avoid clipping
 	rightPanel := lipgloss.NewStyle().
@@ -192,7 +902,7 @@ func (m sqlEditorModel) View() string {
 		BorderForeground(lipgloss.Color("6")).
 		Padding(0, 1).
 		Width(m.viewport.Width + 2).
-		Render(m.viewport.View())
+		Render(m.resultsView())
 
 	// Join panels horizontally
 	panels := lipgloss.JoinHorizontal(lipgloss.Top, leftPanel, rightPanel)
@@ -209,8 +919,7 @@ func (m sqlEditorModel) View() string {
 	return content
 }
 
-func RunSQLEditor(db *sql.DB, dbName string) error {
-	p := tea.NewProgram(initialSQLEditorModel(db, dbName))
-	_, err := p.Run()
-	return err
+// formatElapsed shows a duration to a tenth of a second
+func formatElapsed(d time.Duration) string {
+	return fmt.Sprintf("%.1fs", d.Seconds())
 }
@@ -11,7 +11,12 @@ import (
 type tableListModel struct {
 	tables []string
 	cursor int
-	done   bool
+}
+
+// tableChosenMsg is the result of the table list: the index of the table
+// picked
+type tableChosenMsg struct {
+	index int
 }
 
 func initialTableListModel(tables []string) tableListModel {
@@ -28,8 +33,8 @@ func (m tableListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "ctrl+c", "q", "esc":
-			return m, tea.Quit
+		case "q", "esc":
+			return m, back(nil)
 		case "up", "k":
 			if m.cursor > 0 {
 				m.cursor--
@@ -39,18 +44,16 @@ func (m tableListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.cursor++
 			}
 		case "enter":
-			m.done = true
-			return m, tea.Quit
+			if m.cursor < len(m.tables) {
+				return m, back(tableChosenMsg{index: m.cursor})
+			}
+			return m, back(nil)
 		}
 	}
 	return m, nil
 }
 
 func (m tableListModel) View() string {
-	if m.done {
-		return ""
-	}
-
 	var b strings.Builder
 
 	// Header
@@ -58,7 +61,7 @@ func (m tableListModel) View() string {
 		Foreground(lipgloss.Color("205")).
 		Bold(true).
 		MarginBottom(1)
-	b.WriteString(headerStyle.Render("📋 Tables in Database"))
+	b.WriteString(headerStyle.Render("Tables in Database"))
 	b.WriteString("\n\n")
 
 	if len(m.tables) == 0 {
@@ -80,20 +83,6 @@ func (m tableListModel) View() string {
 		}
 	}
 
-	b.WriteString("\n(press Enter to select, q to quit)")
+	b.WriteString("\n(press Enter to select, q to go back)")
 	return b.String()
 }
-
-func RunTableList(tables []string) (string, error) {
-	p := tea.NewProgram(initialTableListModel(tables))
-	m, err := p.Run()
-	if err != nil {
-		return "", err
-	}
-
-	model := m.(tableListModel)
-	if model.done && model.cursor < len(model.tables) {
-		return model.tables[model.cursor], nil
-	}
-	return "", fmt.Errorf("no table selected")
-}